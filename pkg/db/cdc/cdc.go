@@ -0,0 +1,398 @@
+// Package cdc streams row changes out of Postgres using logical replication
+// and the built-in pgoutput plugin, without triggers.
+//
+// A Stream owns a replication connection, a publication naming the tables to
+// watch and a replication slot that remembers how far the consumer got.
+// Changes are delivered to a Handler one event at a time and a transaction is
+// acknowledged to the server only after the handler has accepted every event
+// in it. Delivery is therefore at least once: after a crash or a handler error
+// the stream resumes from the last acknowledged transaction and may repeat
+// events, so handlers should be idempotent.
+package cdc
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/jwbonnell/go-libs/pkg/db"
+	"github.com/jwbonnell/go-libs/pkg/logx"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgproto3"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Op is the kind of change an Event describes.
+type Op string
+
+const (
+	OpInsert   Op = "insert"
+	OpUpdate   Op = "update"
+	OpDelete   Op = "delete"
+	OpTruncate Op = "truncate"
+)
+
+// Event is a single row change.
+type Event struct {
+	Op     Op
+	Schema string
+	Table  string
+
+	// Values holds the new row for inserts and updates, keyed by column name.
+	// TOASTed columns that an update did not touch are not included.
+	Values map[string]any
+
+	// Old holds the previous row for updates and deletes. With the default
+	// replica identity only the primary key columns are present, and updates
+	// that don't change the key don't carry an old row at all. Use REPLICA
+	// IDENTITY FULL on the table to receive complete old rows.
+	Old map[string]any
+
+	XID        uint32
+	CommitLSN  LSN
+	CommitTime time.Time
+}
+
+// Handler processes an event. Returning an error stops the stream without
+// acknowledging the transaction the event belongs to.
+type Handler func(ctx context.Context, e Event) error
+
+// Config describes the publication and slot a Stream consumes.
+type Config struct {
+	// Slot is the name of the replication slot, created if it doesn't exist.
+	// It may only contain lower case letters, numbers and underscores.
+	Slot string
+
+	// Publication is the name of the publication, created if it doesn't exist.
+	Publication string
+
+	// Tables are the tables the publication is created for, optionally schema
+	// qualified ("public.users"). When empty the publication covers all tables.
+	// An existing publication is used as is.
+	Tables []string
+
+	// StatusInterval is how often the stream reports its position to the
+	// server. Defaults to 10 seconds.
+	StatusInterval time.Duration
+}
+
+var slotName = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+// Stream is a logical replication consumer. It is not safe for concurrent use.
+type Stream struct {
+	conn    *pgconn.PgConn
+	cfg     Config
+	log     *logx.Logger
+	typeMap *pgtype.Map
+
+	relations map[uint32]*relationMessage
+	streaming bool
+	inTx      bool
+	begin     beginMessage
+
+	received LSN // last WAL position received from the server
+	acked    LSN // last WAL position handled and safe to discard
+}
+
+// Connect opens a replication connection described by connCfg and makes sure
+// the publication and slot in cfg exist.
+func Connect(ctx context.Context, connCfg db.ConnectionConfig, cfg Config, log *logx.Logger) (*Stream, error) {
+	if !slotName.MatchString(cfg.Slot) {
+		return nil, fmt.Errorf("invalid slot name %q", cfg.Slot)
+	}
+	if cfg.Publication == "" {
+		return nil, errors.New("publication name is required")
+	}
+	if cfg.StatusInterval <= 0 {
+		cfg.StatusInterval = 10 * time.Second
+	}
+
+	pgCfg, err := pgconn.ParseConfig(connCfg.URL())
+	if err != nil {
+		return nil, fmt.Errorf("parse config: %w", err)
+	}
+	pgCfg.RuntimeParams["replication"] = "database"
+
+	conn, err := pgconn.ConnectConfig(ctx, pgCfg)
+	if err != nil {
+		return nil, fmt.Errorf("connect: %w", err)
+	}
+
+	s := &Stream{
+		conn:      conn,
+		cfg:       cfg,
+		log:       log,
+		typeMap:   pgtype.NewMap(),
+		relations: make(map[uint32]*relationMessage),
+	}
+
+	if err := s.createPublication(ctx); err != nil {
+		conn.Close(ctx)
+		return nil, err
+	}
+	if err := s.createSlot(ctx); err != nil {
+		conn.Close(ctx)
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Close closes the replication connection. Changes that were handled but not
+// yet reported to the server are reported first on a best effort basis.
+func (s *Stream) Close(ctx context.Context) error {
+	if s.streaming {
+		_ = s.sendStatus()
+	}
+	return s.conn.Close(ctx)
+}
+
+// Acked returns the WAL position up to which changes have been handled.
+func (s *Stream) Acked() LSN {
+	return s.acked
+}
+
+// Run starts streaming from the slot's last confirmed position and delivers
+// events to h until ctx is cancelled or an error occurs. It always returns a
+// non-nil error; after it returns the Stream must be closed and a new one
+// connected to resume.
+func (s *Stream) Run(ctx context.Context, h Handler) error {
+	if err := s.start(ctx); err != nil {
+		return err
+	}
+
+	nextStatus := time.Now().Add(s.cfg.StatusInterval)
+	for {
+		if !time.Now().Before(nextStatus) {
+			if err := s.sendStatus(); err != nil {
+				return err
+			}
+			nextStatus = time.Now().Add(s.cfg.StatusInterval)
+		}
+
+		rctx, cancel := context.WithDeadline(ctx, nextStatus)
+		msg, err := s.conn.ReceiveMessage(rctx)
+		cancel()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if pgconn.Timeout(err) {
+				continue
+			}
+			return fmt.Errorf("receive message: %w", err)
+		}
+
+		switch msg := msg.(type) {
+		case *pgproto3.CopyData:
+			if err := s.handleCopyData(ctx, h, msg.Data); err != nil {
+				return err
+			}
+		case *pgproto3.ErrorResponse:
+			return pgconn.ErrorResponseToPgError(msg)
+		default:
+			return fmt.Errorf("unexpected message %T", msg)
+		}
+	}
+}
+
+func (s *Stream) createPublication(ctx context.Context) error {
+	target := "ALL TABLES"
+	if len(s.cfg.Tables) > 0 {
+		tables := make([]string, len(s.cfg.Tables))
+		for i, t := range s.cfg.Tables {
+			tables[i] = pgx.Identifier(strings.Split(t, ".")).Sanitize()
+		}
+		target = "TABLE " + strings.Join(tables, ", ")
+	}
+
+	sql := fmt.Sprintf("CREATE PUBLICATION %s FOR %s", pgx.Identifier{s.cfg.Publication}.Sanitize(), target)
+	if _, err := s.conn.Exec(ctx, sql).ReadAll(); err != nil && !isDuplicate(err) {
+		return fmt.Errorf("create publication: %w", err)
+	}
+	return nil
+}
+
+func (s *Stream) createSlot(ctx context.Context) error {
+	sql := fmt.Sprintf("CREATE_REPLICATION_SLOT %s LOGICAL pgoutput NOEXPORT_SNAPSHOT", s.cfg.Slot)
+	if _, err := s.conn.Exec(ctx, sql).ReadAll(); err != nil && !isDuplicate(err) {
+		return fmt.Errorf("create replication slot: %w", err)
+	}
+	return nil
+}
+
+// start issues START_REPLICATION. Starting at 0/0 makes the server resume
+// from the slot's confirmed_flush_lsn, the last position acknowledged by any
+// previous Stream on the same slot.
+func (s *Stream) start(ctx context.Context) error {
+	sql := fmt.Sprintf("START_REPLICATION SLOT %s LOGICAL 0/0 (proto_version '1', publication_names '%s')",
+		s.cfg.Slot, strings.ReplaceAll(s.cfg.Publication, "'", "''"))
+
+	s.conn.Frontend().Send(&pgproto3.Query{String: sql})
+	if err := s.conn.Frontend().Flush(); err != nil {
+		return fmt.Errorf("start replication: %w", err)
+	}
+
+	for {
+		msg, err := s.conn.ReceiveMessage(ctx)
+		if err != nil {
+			return fmt.Errorf("start replication: %w", err)
+		}
+		switch msg := msg.(type) {
+		case *pgproto3.CopyBothResponse:
+			s.streaming = true
+			s.log.Info(ctx, "cdc: replication started", "slot", s.cfg.Slot, "publication", s.cfg.Publication)
+			return nil
+		case *pgproto3.ErrorResponse:
+			return fmt.Errorf("start replication: %w", pgconn.ErrorResponseToPgError(msg))
+		case *pgproto3.NoticeResponse, *pgproto3.ParameterStatus:
+			continue
+		default:
+			return fmt.Errorf("start replication: unexpected message %T", msg)
+		}
+	}
+}
+
+func (s *Stream) handleCopyData(ctx context.Context, h Handler, data []byte) error {
+	if len(data) == 0 {
+		return errShortMessage
+	}
+
+	r := &reader{buf: data[1:]}
+	switch data[0] {
+	case 'k': // primary keepalive
+		walEnd := LSN(r.uint64())
+		r.uint64() // server time
+		replyRequested := r.uint8() == 1
+		if r.err != nil {
+			return fmt.Errorf("decode keepalive: %w", r.err)
+		}
+
+		// Outside a transaction everything up to the server's position has
+		// been handled, which lets the slot advance past WAL for tables that
+		// aren't in the publication.
+		if !s.inTx && walEnd > s.acked {
+			s.received = max(s.received, walEnd)
+			s.acked = walEnd
+		}
+		if replyRequested {
+			return s.sendStatus()
+		}
+		return nil
+
+	case 'w': // XLogData
+		walStart := LSN(r.uint64())
+		r.uint64() // server WAL end
+		r.uint64() // server time
+		if r.err != nil {
+			return fmt.Errorf("decode xlogdata: %w", r.err)
+		}
+		s.received = max(s.received, walStart)
+		return s.handleMessage(ctx, h, r.buf)
+
+	default:
+		return fmt.Errorf("unknown copy data message %q", data[0])
+	}
+}
+
+func (s *Stream) handleMessage(ctx context.Context, h Handler, data []byte) error {
+	msg, err := decodeMessage(data)
+	if err != nil {
+		return err
+	}
+
+	switch msg := msg.(type) {
+	case *beginMessage:
+		s.inTx = true
+		s.begin = *msg
+		return nil
+
+	case *commitMessage:
+		s.inTx = false
+		s.acked = max(s.acked, msg.endLSN)
+		return nil
+
+	case *relationMessage:
+		s.relations[msg.id] = msg
+		return nil
+
+	case *insertMessage:
+		return s.deliver(ctx, h, OpInsert, msg.relationID, msg.tuple, nil)
+
+	case *updateMessage:
+		return s.deliver(ctx, h, OpUpdate, msg.relationID, msg.tuple, msg.old)
+
+	case *deleteMessage:
+		return s.deliver(ctx, h, OpDelete, msg.relationID, nil, msg.old)
+
+	case *truncateMessage:
+		for _, id := range msg.relationIDs {
+			if err := s.deliver(ctx, h, OpTruncate, id, nil, nil); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	return nil
+}
+
+func (s *Stream) deliver(ctx context.Context, h Handler, op Op, relationID uint32, tuple, old []tupleColumn) error {
+	rel, ok := s.relations[relationID]
+	if !ok {
+		return fmt.Errorf("%s for unknown relation %d", op, relationID)
+	}
+
+	values, err := decodeTuple(s.typeMap, rel, tuple)
+	if err != nil {
+		return err
+	}
+	oldValues, err := decodeTuple(s.typeMap, rel, old)
+	if err != nil {
+		return err
+	}
+
+	e := Event{
+		Op:         op,
+		Schema:     rel.namespace,
+		Table:      rel.name,
+		Values:     values,
+		Old:        oldValues,
+		XID:        s.begin.xid,
+		CommitLSN:  s.begin.finalLSN,
+		CommitTime: s.begin.commitTime,
+	}
+	if err := h(ctx, e); err != nil {
+		return fmt.Errorf("handle %s on %s.%s: %w", op, rel.namespace, rel.name, err)
+	}
+	return nil
+}
+
+// sendStatus sends a standby status update reporting what was received and
+// what was handled.
+func (s *Stream) sendStatus() error {
+	data := make([]byte, 0, 34)
+	data = append(data, 'r')
+	data = binary.BigEndian.AppendUint64(data, uint64(s.received))
+	data = binary.BigEndian.AppendUint64(data, uint64(s.acked))
+	data = binary.BigEndian.AppendUint64(data, uint64(s.acked))
+	data = binary.BigEndian.AppendUint64(data, uint64(pgMicros(time.Now())))
+	data = append(data, 0) // no reply requested
+
+	s.conn.Frontend().Send(&pgproto3.CopyData{Data: data})
+	if err := s.conn.Frontend().Flush(); err != nil {
+		return fmt.Errorf("send standby status: %w", err)
+	}
+	return nil
+}
+
+func isDuplicate(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "42710"
+}
@@ -0,0 +1,213 @@
+package cdc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jwbonnell/go-libs/pkg/db"
+	"github.com/jwbonnell/go-libs/pkg/logx"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/ory/dockertest/v3"
+)
+
+func TestCDCTestSuite(t *testing.T) {
+	suite.Run(t, new(CDCTestSuite))
+}
+
+type CDCTestSuite struct {
+	suite.Suite
+	log     *logx.Logger
+	connCfg db.ConnectionConfig
+	db      *db.DB
+	cleanup func()
+}
+
+func (s *CDCTestSuite) SetupSuite() {
+	s.log = logx.NewCILogger("integration-tests")
+	connCfg, cleanup, err := setupPostgres(s.log)
+	if err != nil {
+		panic(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	d, err := db.New(ctx, connCfg, s.log)
+	if err != nil {
+		panic(err)
+	}
+
+	s.connCfg = connCfg
+	s.cleanup = cleanup
+	s.db = d
+}
+
+func (s *CDCTestSuite) TearDownSuite() {
+	s.cleanup()
+	if s.db != nil {
+		s.db.Close()
+	}
+}
+
+func (s *CDCTestSuite) TestStreamAndResume_Integration() {
+	ctx := s.T().Context()
+	_, err := s.db.Pool().Exec(ctx, `CREATE TABLE items (id int PRIMARY KEY, name text NOT NULL, price numeric)`)
+	s.Require().NoError(err)
+
+	cfg := Config{Slot: "items_slot", Publication: "items_pub", Tables: []string{"public.items"}, StatusInterval: 100 * time.Millisecond}
+
+	// First consumer sees inserts, updates and deletes in order.
+	events := s.consume(cfg, 3, nil, func() {
+		_, err := s.db.Pool().Exec(ctx, `
+			INSERT INTO items (id, name, price) VALUES (1, 'apple', 1.5);
+			UPDATE items SET name = 'green apple' WHERE id = 1;
+			DELETE FROM items WHERE id = 1;`)
+		s.Require().NoError(err)
+	})
+	s.Require().Equal(OpInsert, events[0].Op)
+	s.Require().Equal("items", events[0].Table)
+	s.Require().Equal(int32(1), events[0].Values["id"])
+	s.Require().Equal("apple", events[0].Values["name"])
+	s.Require().Equal(OpUpdate, events[1].Op)
+	s.Require().Equal("green apple", events[1].Values["name"])
+	s.Require().Equal(OpDelete, events[2].Op)
+	s.Require().Equal(int32(1), events[2].Old["id"])
+
+	// A handler failure leaves the transaction unacknowledged...
+	failed := s.consume(cfg, 1, errors.New("search index down"), func() {
+		_, err := s.db.Pool().Exec(ctx, `INSERT INTO items (id, name) VALUES (2, 'pear')`)
+		s.Require().NoError(err)
+	})
+	s.Require().Equal("pear", failed[0].Values["name"])
+
+	// ...so the next consumer resumes from the last confirmed LSN and gets it
+	// again, but not the changes that were already acknowledged.
+	resumed := s.consume(cfg, 2, nil, func() {
+		_, err := s.db.Pool().Exec(ctx, `INSERT INTO items (id, name) VALUES (3, 'plum')`)
+		s.Require().NoError(err)
+	})
+	s.Require().Equal("pear", resumed[0].Values["name"])
+	s.Require().Equal("plum", resumed[1].Values["name"])
+}
+
+// consume connects a Stream, runs change after replication has started and
+// collects n events. When handlerErr is set the handler fails on the first
+// event after recording it.
+func (s *CDCTestSuite) consume(cfg Config, n int, handlerErr error, change func()) []Event {
+	ctx, cancel := context.WithTimeout(s.T().Context(), 30*time.Second)
+	defer cancel()
+
+	stream, err := Connect(ctx, s.connCfg, cfg, s.log)
+	s.Require().NoError(err)
+	defer stream.Close(context.Background())
+
+	got := make(chan Event, n)
+	runCtx, stop := context.WithCancel(ctx)
+	done := make(chan error, 1)
+	go func() {
+		done <- stream.Run(runCtx, func(ctx context.Context, e Event) error {
+			got <- e
+			return handlerErr
+		})
+	}()
+
+	change()
+
+	var events []Event
+	stopped := false
+	for len(events) < n {
+		select {
+		case e := <-got:
+			events = append(events, e)
+		case err := <-done:
+			if handlerErr == nil {
+				s.Require().FailNow(fmt.Sprintf("stream stopped: %v", err))
+			}
+			s.Require().ErrorIs(err, handlerErr)
+			stopped = true
+		case <-ctx.Done():
+			s.Require().FailNow(fmt.Sprintf("timed out after %d of %d events", len(events), n))
+		}
+	}
+
+	stop()
+	if !stopped {
+		<-done
+	}
+	return events
+}
+
+/*
+ * Setup
+	   ____    __
+	  / __/__ / /___ _____
+	 _\ \/ -_) __/ // / _ \
+	/___/\__/\__/\_,_/ .__/
+					/_/
+*/
+
+func setupPostgres(log *logx.Logger) (connCfg db.ConnectionConfig, cleanup func(), err error) {
+	testPool, err := dockertest.NewPool("")
+	if err != nil {
+		return db.ConnectionConfig{}, func() {}, err
+	}
+
+	resource, err := testPool.RunWithOptions(&dockertest.RunOptions{
+		Repository: "postgres",
+		Tag:        "15-alpine",
+		Env: []string{
+			"POSTGRES_USER=postgres",
+			"POSTGRES_PASSWORD=secret",
+			"POSTGRES_DB=testdb",
+		},
+		Cmd: []string{"postgres", "-c", "wal_level=logical"},
+	})
+	if err != nil {
+		return db.ConnectionConfig{}, func() {}, err
+	}
+
+	// Expire container after 10 minutes to avoid leaks in CI
+	err = resource.Expire(600)
+	if err != nil {
+		return db.ConnectionConfig{}, func() {}, err
+	}
+
+	connCfg = db.ConnectionConfig{
+		User:       "postgres",
+		Password:   "secret",
+		Host:       fmt.Sprintf("localhost:%s", resource.GetPort("5432/tcp")),
+		Name:       "testdb",
+		DisableTLS: true,
+	}
+
+	// Exponential backoff to wait for Postgres readiness
+	testPool.MaxWait = 2 * time.Minute
+	err = testPool.Retry(func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		d, err := db.New(ctx, connCfg, log)
+		if err != nil {
+			return err
+		}
+		d.Close()
+		return nil
+	})
+	if err != nil {
+		if err := testPool.Purge(resource); err != nil {
+			return db.ConnectionConfig{}, func() {}, err
+		}
+		return db.ConnectionConfig{}, func() {}, err
+	}
+
+	cleanup = func() {
+		if err := testPool.Purge(resource); err != nil {
+			log.Error(context.Background(), fmt.Sprintf("could not purge resource: %v", err))
+		}
+	}
+
+	return connCfg, cleanup, nil
+}
@@ -0,0 +1,22 @@
+package cdc
+
+import (
+	"fmt"
+)
+
+// LSN is a Postgres log sequence number, a position in the write-ahead log.
+type LSN uint64
+
+// String formats the LSN the way Postgres does, e.g. "16/B374D848".
+func (lsn LSN) String() string {
+	return fmt.Sprintf("%X/%X", uint32(lsn>>32), uint32(lsn))
+}
+
+// ParseLSN parses an LSN in the "16/B374D848" format used by Postgres.
+func ParseLSN(s string) (LSN, error) {
+	var hi, lo uint32
+	if _, err := fmt.Sscanf(s, "%X/%X", &hi, &lo); err != nil {
+		return 0, fmt.Errorf("parse lsn %q: %w", s, err)
+	}
+	return LSN(uint64(hi)<<32 | uint64(lo)), nil
+}
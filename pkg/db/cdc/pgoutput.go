@@ -0,0 +1,284 @@
+package cdc
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// This file decodes the messages of the pgoutput logical decoding plugin,
+// protocol version 1. See
+// https://www.postgresql.org/docs/current/protocol-logicalrep-message-formats.html
+
+var errShortMessage = errors.New("message too short")
+
+// pgEpoch is the zero point of timestamps sent by the server.
+var pgEpoch = time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+func pgTime(micros int64) time.Time {
+	return pgEpoch.Add(time.Duration(micros) * time.Microsecond)
+}
+
+func pgMicros(t time.Time) int64 {
+	return t.Sub(pgEpoch).Microseconds()
+}
+
+type beginMessage struct {
+	finalLSN   LSN
+	commitTime time.Time
+	xid        uint32
+}
+
+type commitMessage struct {
+	commitLSN  LSN
+	endLSN     LSN
+	commitTime time.Time
+}
+
+type relationColumn struct {
+	name    string
+	typeOID uint32
+	key     bool
+}
+
+type relationMessage struct {
+	id        uint32
+	namespace string
+	name      string
+	columns   []relationColumn
+}
+
+// tupleColumn is a single column of a row image. kind is 'n' for NULL, 'u'
+// for an unchanged TOASTed value that was not sent, and 't' for text data.
+type tupleColumn struct {
+	kind byte
+	data []byte
+}
+
+type insertMessage struct {
+	relationID uint32
+	tuple      []tupleColumn
+}
+
+type updateMessage struct {
+	relationID uint32
+	old        []tupleColumn
+	tuple      []tupleColumn
+}
+
+type deleteMessage struct {
+	relationID uint32
+	old        []tupleColumn
+}
+
+type truncateMessage struct {
+	relationIDs []uint32
+}
+
+// decodeMessage decodes a single pgoutput message. Message types the stream
+// doesn't need (origin, type, logical messages) decode to nil.
+func decodeMessage(data []byte) (any, error) {
+	if len(data) == 0 {
+		return nil, errShortMessage
+	}
+
+	r := &reader{buf: data[1:]}
+	var msg any
+	switch data[0] {
+	case 'B':
+		msg = &beginMessage{
+			finalLSN:   LSN(r.uint64()),
+			commitTime: pgTime(int64(r.uint64())),
+			xid:        r.uint32(),
+		}
+	case 'C':
+		r.uint8() // flags, currently unused
+		msg = &commitMessage{
+			commitLSN:  LSN(r.uint64()),
+			endLSN:     LSN(r.uint64()),
+			commitTime: pgTime(int64(r.uint64())),
+		}
+	case 'R':
+		rel := &relationMessage{
+			id:        r.uint32(),
+			namespace: r.string(),
+			name:      r.string(),
+		}
+		r.uint8() // replica identity setting
+		n := int(r.uint16())
+		for i := 0; i < n && r.err == nil; i++ {
+			flags := r.uint8()
+			col := relationColumn{name: r.string(), typeOID: r.uint32(), key: flags&1 == 1}
+			r.uint32() // type modifier
+			rel.columns = append(rel.columns, col)
+		}
+		msg = rel
+	case 'I':
+		ins := &insertMessage{relationID: r.uint32()}
+		if r.uint8() != 'N' && r.err == nil {
+			return nil, fmt.Errorf("insert: expected new tuple")
+		}
+		ins.tuple = r.tuple()
+		msg = ins
+	case 'U':
+		upd := &updateMessage{relationID: r.uint32()}
+		kind := r.uint8()
+		if kind == 'K' || kind == 'O' {
+			upd.old = r.tuple()
+			kind = r.uint8()
+		}
+		if kind != 'N' && r.err == nil {
+			return nil, fmt.Errorf("update: expected new tuple")
+		}
+		upd.tuple = r.tuple()
+		msg = upd
+	case 'D':
+		del := &deleteMessage{relationID: r.uint32()}
+		kind := r.uint8()
+		if kind != 'K' && kind != 'O' && r.err == nil {
+			return nil, fmt.Errorf("delete: expected old tuple")
+		}
+		del.old = r.tuple()
+		msg = del
+	case 'T':
+		n := int(r.uint32())
+		r.uint8() // options
+		trunc := &truncateMessage{}
+		for i := 0; i < n && r.err == nil; i++ {
+			trunc.relationIDs = append(trunc.relationIDs, r.uint32())
+		}
+		msg = trunc
+	case 'O', 'Y', 'M':
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown message type %q", data[0])
+	}
+
+	if r.err != nil {
+		return nil, fmt.Errorf("decode %q message: %w", data[0], r.err)
+	}
+	return msg, nil
+}
+
+// decodeTuple converts a row image into column values keyed by column name,
+// using m to decode the text representation of each column by type OID.
+// Values of types m doesn't know are returned as strings. Unchanged TOAST
+// columns are left out.
+func decodeTuple(m *pgtype.Map, rel *relationMessage, tuple []tupleColumn) (map[string]any, error) {
+	if tuple == nil {
+		return nil, nil
+	}
+	if len(tuple) != len(rel.columns) {
+		return nil, fmt.Errorf("relation %s.%s: got %d columns, want %d", rel.namespace, rel.name, len(tuple), len(rel.columns))
+	}
+
+	values := make(map[string]any, len(tuple))
+	for i, col := range tuple {
+		rc := rel.columns[i]
+		switch col.kind {
+		case 'n':
+			values[rc.name] = nil
+		case 'u':
+			continue
+		case 't':
+			typ, ok := m.TypeForOID(rc.typeOID)
+			if !ok {
+				values[rc.name] = string(col.data)
+				continue
+			}
+			v, err := typ.Codec.DecodeValue(m, rc.typeOID, pgtype.TextFormatCode, col.data)
+			if err != nil {
+				return nil, fmt.Errorf("decode column %s: %w", rc.name, err)
+			}
+			values[rc.name] = v
+		default:
+			return nil, fmt.Errorf("column %s: unknown tuple data kind %q", rc.name, col.kind)
+		}
+	}
+	return values, nil
+}
+
+// reader reads big endian values from a message, remembering the first error
+// so callers can check once at the end.
+type reader struct {
+	buf []byte
+	err error
+}
+
+func (r *reader) next(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if len(r.buf) < n {
+		r.err = errShortMessage
+		return nil
+	}
+	b := r.buf[:n]
+	r.buf = r.buf[n:]
+	return b
+}
+
+func (r *reader) uint8() byte {
+	b := r.next(1)
+	if b == nil {
+		return 0
+	}
+	return b[0]
+}
+
+func (r *reader) uint16() uint16 {
+	b := r.next(2)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint16(b)
+}
+
+func (r *reader) uint32() uint32 {
+	b := r.next(4)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint32(b)
+}
+
+func (r *reader) uint64() uint64 {
+	b := r.next(8)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint64(b)
+}
+
+func (r *reader) string() string {
+	if r.err != nil {
+		return ""
+	}
+	for i, c := range r.buf {
+		if c == 0 {
+			s := string(r.buf[:i])
+			r.buf = r.buf[i+1:]
+			return s
+		}
+	}
+	r.err = errShortMessage
+	return ""
+}
+
+func (r *reader) tuple() []tupleColumn {
+	n := int(r.uint16())
+	cols := make([]tupleColumn, 0, n)
+	for i := 0; i < n && r.err == nil; i++ {
+		col := tupleColumn{kind: r.uint8()}
+		if col.kind == 't' || col.kind == 'b' {
+			size := int(r.uint32())
+			// Copy the data, the message buffer is reused by the connection.
+			col.data = append([]byte(nil), r.next(size)...)
+		}
+		cols = append(cols, col)
+	}
+	return cols
+}
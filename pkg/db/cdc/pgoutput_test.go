@@ -0,0 +1,181 @@
+package cdc
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/stretchr/testify/require"
+)
+
+// msg builds pgoutput messages for tests.
+type msg []byte
+
+func newMsg(typ byte) msg                 { return msg{typ} }
+func (m msg) u8(v byte) msg               { return append(m, v) }
+func (m msg) u16(v uint16) msg            { return binary.BigEndian.AppendUint16(m, v) }
+func (m msg) u32(v uint32) msg            { return binary.BigEndian.AppendUint32(m, v) }
+func (m msg) u64(v uint64) msg            { return binary.BigEndian.AppendUint64(m, v) }
+func (m msg) str(v string) msg            { return append(append(m, v...), 0) }
+func (m msg) text(v string) msg           { return m.u8('t').u32(uint32(len(v))).bytes(v) }
+func (m msg) bytes(v string) msg          { return append(m, v...) }
+func (m msg) xlog(walStart uint64) []byte { return append(msg{'w'}.u64(walStart).u64(0).u64(0), m...) }
+
+var commitTime = time.Date(2025, time.March, 1, 12, 0, 0, 0, time.UTC)
+
+func beginMsg(finalLSN uint64, xid uint32) msg {
+	return newMsg('B').u64(finalLSN).u64(uint64(pgMicros(commitTime))).u32(xid)
+}
+
+func commitMsg(commitLSN, endLSN uint64) msg {
+	return newMsg('C').u8(0).u64(commitLSN).u64(endLSN).u64(uint64(pgMicros(commitTime)))
+}
+
+// usersRelation describes public.users (id int8 key, name text, profile jsonb, tag custom type).
+func usersRelation() msg {
+	return newMsg('R').u32(16384).str("public").str("users").u8('d').u16(4).
+		u8(1).str("id").u32(pgtype.Int8OID).u32(0xffffffff).
+		u8(0).str("name").u32(pgtype.TextOID).u32(0xffffffff).
+		u8(0).str("profile").u32(pgtype.JSONBOID).u32(0xffffffff).
+		u8(0).str("tag").u32(99999).u32(0xffffffff)
+}
+
+func TestLSN_ParseAndString(t *testing.T) {
+	lsn, err := ParseLSN("16/B374D848")
+	require.NoError(t, err)
+	require.Equal(t, LSN(0x16B374D848), lsn)
+	require.Equal(t, "16/B374D848", lsn.String())
+
+	_, err = ParseLSN("nope")
+	require.Error(t, err)
+}
+
+func TestDecodeMessage_Relation(t *testing.T) {
+	m, err := decodeMessage(usersRelation())
+	require.NoError(t, err)
+
+	rel := m.(*relationMessage)
+	require.Equal(t, uint32(16384), rel.id)
+	require.Equal(t, "public", rel.namespace)
+	require.Equal(t, "users", rel.name)
+	require.Len(t, rel.columns, 4)
+	require.True(t, rel.columns[0].key)
+	require.Equal(t, "name", rel.columns[1].name)
+	require.Equal(t, uint32(pgtype.TextOID), rel.columns[1].typeOID)
+}
+
+func TestDecodeMessage_BeginCommit(t *testing.T) {
+	m, err := decodeMessage(beginMsg(100, 7))
+	require.NoError(t, err)
+	require.Equal(t, &beginMessage{finalLSN: 100, commitTime: commitTime, xid: 7}, m)
+
+	m, err = decodeMessage(commitMsg(100, 120))
+	require.NoError(t, err)
+	require.Equal(t, &commitMessage{commitLSN: 100, endLSN: 120, commitTime: commitTime}, m)
+}
+
+func TestDecodeMessage_Errors(t *testing.T) {
+	_, err := decodeMessage(newMsg('B').u64(1))
+	require.ErrorIs(t, err, errShortMessage)
+
+	_, err = decodeMessage(newMsg('Z'))
+	require.Error(t, err)
+
+	m, err := decodeMessage(newMsg('O').u64(1).str("origin"))
+	require.NoError(t, err)
+	require.Nil(t, m)
+}
+
+func TestDecodeTuple(t *testing.T) {
+	m, err := decodeMessage(usersRelation())
+	require.NoError(t, err)
+	rel := m.(*relationMessage)
+
+	m, err = decodeMessage(newMsg('U').u32(16384).
+		u8('K').u16(4).text("1").u8('n').u8('n').u8('n').
+		u8('N').u16(4).text("2").text("Alice").u8('u').text("gold"))
+	require.NoError(t, err)
+	upd := m.(*updateMessage)
+
+	values, err := decodeTuple(pgtype.NewMap(), rel, upd.tuple)
+	require.NoError(t, err)
+	require.Equal(t, map[string]any{"id": int64(2), "name": "Alice", "tag": "gold"}, values)
+
+	old, err := decodeTuple(pgtype.NewMap(), rel, upd.old)
+	require.NoError(t, err)
+	require.Equal(t, map[string]any{"id": int64(1), "name": nil, "profile": nil, "tag": nil}, old)
+
+	_, err = decodeTuple(pgtype.NewMap(), rel, upd.tuple[:2])
+	require.Error(t, err)
+}
+
+func TestStream_DeliversEventsAndAcksOnCommit(t *testing.T) {
+	s := &Stream{typeMap: pgtype.NewMap(), relations: map[uint32]*relationMessage{}}
+
+	var events []Event
+	h := func(ctx context.Context, e Event) error {
+		events = append(events, e)
+		return nil
+	}
+
+	feed := func(walStart uint64, m msg) {
+		t.Helper()
+		require.NoError(t, s.handleCopyData(t.Context(), h, m.xlog(walStart)))
+	}
+
+	feed(90, beginMsg(100, 7))
+	feed(90, usersRelation())
+	feed(91, newMsg('I').u32(16384).u8('N').u16(4).text("1").text("Alice").text(`{"vip":true}`).text("gold"))
+	feed(92, newMsg('D').u32(16384).u8('K').u16(4).text("3").u8('n').u8('n').u8('n'))
+	feed(93, newMsg('T').u32(1).u8(0).u32(16384))
+	require.Equal(t, LSN(0), s.Acked(), "nothing is acknowledged before the commit")
+
+	feed(100, commitMsg(100, 120))
+	require.Equal(t, LSN(120), s.Acked())
+
+	require.Len(t, events, 3)
+	require.Equal(t, OpInsert, events[0].Op)
+	require.Equal(t, "public", events[0].Schema)
+	require.Equal(t, "users", events[0].Table)
+	require.Equal(t, uint32(7), events[0].XID)
+	require.Equal(t, LSN(100), events[0].CommitLSN)
+	require.Equal(t, commitTime, events[0].CommitTime)
+	require.Equal(t, map[string]any{"vip": true}, events[0].Values["profile"])
+
+	require.Equal(t, OpDelete, events[1].Op)
+	require.Nil(t, events[1].Values)
+	require.Equal(t, int64(3), events[1].Old["id"])
+
+	require.Equal(t, OpTruncate, events[2].Op)
+
+	// Keepalives outside a transaction move the acknowledged position forward.
+	require.NoError(t, s.handleCopyData(t.Context(), h, msg{'k'}.u64(200).u64(0).u8(0)))
+	require.Equal(t, LSN(200), s.Acked())
+}
+
+func TestStream_HandlerErrorIsNotAcknowledged(t *testing.T) {
+	s := &Stream{typeMap: pgtype.NewMap(), relations: map[uint32]*relationMessage{}}
+	boom := errors.New("boom")
+	h := func(ctx context.Context, e Event) error { return boom }
+
+	require.NoError(t, s.handleCopyData(t.Context(), h, beginMsg(100, 7).xlog(90)))
+	require.NoError(t, s.handleCopyData(t.Context(), h, usersRelation().xlog(90)))
+
+	err := s.handleCopyData(t.Context(), h, newMsg('I').u32(16384).u8('N').u16(4).text("1").text("A").u8('n').u8('n').xlog(91))
+	require.ErrorIs(t, err, boom)
+
+	// A keepalive arriving mid-transaction must not acknowledge it.
+	require.NoError(t, s.handleCopyData(t.Context(), h, msg{'k'}.u64(200).u64(0).u8(0)))
+	require.Equal(t, LSN(0), s.Acked())
+}
+
+func TestStream_UnknownRelation(t *testing.T) {
+	s := &Stream{typeMap: pgtype.NewMap(), relations: map[uint32]*relationMessage{}}
+	h := func(ctx context.Context, e Event) error { return nil }
+
+	err := s.handleCopyData(t.Context(), h, newMsg('I').u32(1).u8('N').u16(0).xlog(1))
+	require.ErrorContains(t, err, "unknown relation 1")
+}
@@ -1,5 +1,7 @@
 package db
 
+import "net/url"
+
 type ConnectionConfig struct {
 	User         string
 	Password     string
@@ -9,4 +11,32 @@ type ConnectionConfig struct {
 	MaxIdleConns int
 	MaxOpenConns int
 	DisableTLS   bool
+
+	// TenantSchemaPrefix is prepended to a tenant ID to build the name of the
+	// schema holding that tenant's tables. Defaults to "tenant_".
+	TenantSchemaPrefix string
+}
+
+// URL returns the postgres:// connection string described by cfg.
+func (cfg ConnectionConfig) URL() string {
+	sslMode := "required"
+	if cfg.DisableTLS {
+		sslMode = "disable"
+	}
+
+	q := make(url.Values)
+	q.Set("sslmode", sslMode)
+	q.Set("timezone", "utc")
+	if cfg.Schema != "" {
+		q.Set("search_path", cfg.Schema)
+	}
+
+	u := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(cfg.User, cfg.Password),
+		Host:     cfg.Host,
+		Path:     cfg.Name,
+		RawQuery: q.Encode(),
+	}
+	return u.String()
 }
@@ -3,51 +3,55 @@ package db
 import (
 	"context"
 	"fmt"
-	"net/url"
 	"time"
 
 	"github.com/jwbonnell/go-libs/pkg/db/queriers"
 	"github.com/jwbonnell/go-libs/pkg/logx"
+	"github.com/jwbonnell/go-libs/pkg/tracing"
 
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 // DB wraps a pgxpool.Pool and provides simple helpers.
 type DB struct {
-	pool *pgxpool.Pool
-	log  *logx.Logger
+	pool        *pgxpool.Pool
+	log         *logx.Logger
+	tenants     *tenantScope
+	sessionVars queriers.SessionVarsFn
+	tracer      *tracing.Tracer
 }
 
+// Pool returns a Querier backed by the connection pool. Queries run with a
+// tenant in the context (see queriers.WithTenant) are scoped to that tenant's
+// schema.
 func (d *DB) Pool() *queriers.PoolQuerier {
 	return &queriers.PoolQuerier{
-		Q:   d.pool,
-		Log: d.log,
+		Q:            d.pool,
+		Log:          d.log,
+		TenantSchema: d.TenantSchema,
+		SessionVars:  d.sessionVars,
+		Tracer:       d.tracer,
 	}
 }
 
-// New creates a new DB pool. connString is a standard PG connection string.
-func New(ctx context.Context, cfg ConnectionConfig, log *logx.Logger) (*DB, error) {
-	sslMode := "required"
-	if cfg.DisableTLS {
-		sslMode = "disable"
-	}
-
-	q := make(url.Values)
-	q.Set("sslmode", sslMode)
-	q.Set("timezone", "utc")
-	if cfg.Schema != "" {
-		q.Set("search_path", cfg.Schema)
-	}
+// RegisterSessionVars installs fn as the extractor of session variables that
+// every transaction started through Pool().Begin applies with SET LOCAL, for
+// use by row-level-security policies reading current_setting(). It should be
+// called once during startup, before the DB is shared between goroutines.
+func (d *DB) RegisterSessionVars(fn queriers.SessionVarsFn) {
+	d.sessionVars = fn
+}
 
-	u := url.URL{
-		Scheme:   "postgres",
-		User:     url.UserPassword(cfg.User, cfg.Password),
-		Host:     cfg.Host,
-		Path:     cfg.Name,
-		RawQuery: q.Encode(),
-	}
+// WithTracing records a client span for every statement run through Pool(),
+// as a child of the span in the statement's context. Like RegisterSessionVars
+// it should be called during startup.
+func (d *DB) WithTracing(tracer *tracing.Tracer) {
+	d.tracer = tracer
+}
 
-	pgxCfg, err := pgxpool.ParseConfig(u.String())
+// New creates a new DB pool. connString is a standard PG connection string.
+func New(ctx context.Context, cfg ConnectionConfig, log *logx.Logger) (*DB, error) {
+	pgxCfg, err := pgxpool.ParseConfig(cfg.URL())
 	if err != nil {
 		return nil, fmt.Errorf("parse config: %w", err)
 	}
@@ -59,6 +63,11 @@ func New(ctx context.Context, cfg ConnectionConfig, log *logx.Logger) (*DB, erro
 	pgxCfg.MinConns = 1
 	pgxCfg.MaxConnLifetime = time.Hour
 
+	tenants := newTenantScope(cfg.TenantSchemaPrefix)
+	pgxCfg.PrepareConn = tenants.prepareConn
+	pgxCfg.AfterRelease = tenants.afterRelease
+	pgxCfg.BeforeClose = tenants.beforeClose
+
 	pool, err := pgxpool.NewWithConfig(ctx, pgxCfg)
 	if err != nil {
 		return nil, fmt.Errorf("create pool: %w", err)
@@ -71,8 +80,9 @@ func New(ctx context.Context, cfg ConnectionConfig, log *logx.Logger) (*DB, erro
 	}
 
 	return &DB{
-		pool: pool,
-		log:  log,
+		pool:    pool,
+		log:     log,
+		tenants: tenants,
 	}, nil
 }
 
@@ -4,10 +4,12 @@ import (
 	"context"
 	"fmt"
 	"net/url"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/jwbonnell/go-libs/pkg/db/queriers"
 	"github.com/jwbonnell/go-libs/pkg/logx"
 	"github.com/stretchr/testify/suite"
 
@@ -128,6 +130,35 @@ func (s *DBTestSuite) TestQueries_Integration() {
 	var usr3 User
 	err = QueryOne[User](s.T().Context(), s.db.Pool(), "SELECT uuid, id, name, email, address, properties FROM users WHERE name = @name AND email = @email", &usr3, pgx.NamedArgs{"name": "Unknown", "email": "unknown@example.com"})
 	s.Require().ErrorIs(err, pgx.ErrNoRows)
+
+	// Test QueryOne - more than one row returned
+	var usr4 User
+	err = QueryOne[User](s.T().Context(), s.db.Pool(), "SELECT uuid, id, name, email, address, properties FROM users", &usr4, nil)
+	s.Require().ErrorIs(err, ErrTooManyRows)
+}
+
+func (s *DBTestSuite) TestQueryFirst_Integration() {
+	var usr User
+	err := QueryFirst[User](s.T().Context(), s.db.Pool(), "SELECT uuid, id, name, email, address, properties FROM users ORDER BY name", &usr, nil)
+	s.Require().NoError(err)
+	s.Require().Equal("Alice", usr.Name)
+
+	err = QueryFirst[User](s.T().Context(), s.db.Pool(), "SELECT uuid, id, name, email, address, properties FROM users WHERE name = @name", &usr, pgx.NamedArgs{"name": "Unknown"})
+	s.Require().ErrorIs(err, pgx.ErrNoRows)
+}
+
+func (s *DBTestSuite) TestQueryMaybe_Integration() {
+	usr, err := QueryMaybe[User](s.T().Context(), s.db.Pool(), "SELECT uuid, id, name, email, address, properties FROM users WHERE name = @name", pgx.NamedArgs{"name": "Bob"})
+	s.Require().NoError(err)
+	s.Require().NotNil(usr)
+	s.Require().Equal("San Francisco", usr.Address.City)
+
+	usr, err = QueryMaybe[User](s.T().Context(), s.db.Pool(), "SELECT uuid, id, name, email, address, properties FROM users WHERE name = @name", pgx.NamedArgs{"name": "Unknown"})
+	s.Require().NoError(err)
+	s.Require().Nil(usr)
+
+	_, err = QueryMaybe[User](s.T().Context(), s.db.Pool(), "SELECT uuid, id, name, email, address, properties FROM users", nil)
+	s.Require().ErrorIs(err, ErrTooManyRows)
 }
 
 func (s *DBTestSuite) TestInsert_Integration() {
@@ -308,6 +339,159 @@ func (s *DBTestSuite) TestTransactionRollback_Integration() {
 	s.Require().ErrorIs(err, pgx.ErrNoRows)
 }
 
+func (s *DBTestSuite) TestTenantSchemas_Integration() {
+	ctx := s.T().Context()
+	migrations := []string{
+		`CREATE TABLE notes (id bigserial PRIMARY KEY, body text NOT NULL)`,
+		`ALTER TABLE notes ADD COLUMN author text NOT NULL DEFAULT 'unknown'`,
+	}
+
+	for _, tenant := range []string{"acme", "globex"} {
+		s.Require().NoError(s.db.MigrateTenant(ctx, tenant, migrations...))
+		// Re-running is a no-op once every migration has been applied.
+		s.Require().NoError(s.db.MigrateTenant(ctx, tenant, migrations...))
+	}
+
+	type Note struct {
+		ID     int64  `db:"id"`
+		Body   string `db:"body"`
+		Author string `db:"author"`
+	}
+
+	acme := queriers.WithTenant(ctx, "acme")
+	globex := queriers.WithTenant(ctx, "globex")
+
+	_, err := s.db.Pool().Exec(acme, "INSERT INTO notes (body) VALUES ('acme note')")
+	s.Require().NoError(err)
+
+	tx, err := s.db.Pool().Begin(globex)
+	s.Require().NoError(err)
+	_, err = tx.Exec(globex, "INSERT INTO notes (body, author) VALUES ('globex note', 'hank')")
+	s.Require().NoError(err)
+	s.Require().NoError(tx.Commit(globex))
+
+	var acmeNotes []Note
+	s.Require().NoError(Query[Note](acme, s.db.Pool(), "SELECT id, body, author FROM notes", &acmeNotes, nil))
+	s.Require().Len(acmeNotes, 1)
+	s.Require().Equal("acme note", acmeNotes[0].Body)
+
+	var globexNote Note
+	s.Require().NoError(QueryOne[Note](globex, s.db.Pool(), "SELECT id, body, author FROM notes", &globexNote, nil))
+	s.Require().Equal("hank", globexNote.Author)
+
+	// Connections returned to the pool must not keep the tenant search_path.
+	for i := 0; i < 5; i++ {
+		var users []User
+		s.Require().NoError(Query[User](ctx, s.db.Pool(), "SELECT uuid, id, name, email, address, properties FROM users", &users, nil))
+		s.Require().Len(users, 2)
+
+		_, err = s.db.Pool().Exec(ctx, "SELECT 1 FROM notes")
+		s.Require().Error(err)
+	}
+}
+
+type sessionUserKey struct{}
+
+func (s *DBTestSuite) TestSessionVars_Integration() {
+	ctx := s.T().Context()
+	s.db.RegisterSessionVars(func(ctx context.Context) map[string]string {
+		userID, ok := ctx.Value(sessionUserKey{}).(string)
+		if !ok {
+			return nil
+		}
+		return map[string]string{"app.user_id": userID, "role": "app_user"}
+	})
+	defer s.db.RegisterSessionVars(nil)
+
+	_, err := s.db.Pool().Exec(ctx, `
+		DO $$ BEGIN
+			CREATE ROLE app_user NOLOGIN;
+		EXCEPTION WHEN duplicate_object THEN NULL;
+		END $$;
+		DROP TABLE IF EXISTS documents;
+		CREATE TABLE documents (id bigserial PRIMARY KEY, owner_id text NOT NULL, title text NOT NULL);
+		ALTER TABLE documents ENABLE ROW LEVEL SECURITY;
+		CREATE POLICY documents_owner ON documents USING (owner_id = current_setting('app.user_id'));
+		GRANT SELECT ON documents TO app_user;
+		INSERT INTO documents (owner_id, title) VALUES ('alice', 'a1'), ('alice', 'a2'), ('bob', 'b1');`)
+	s.Require().NoError(err)
+
+	currentUser := func(q queriers.Querier) string {
+		var v string
+		rows, err := q.Query(ctx, "SELECT COALESCE(current_setting('app.user_id', true), '')")
+		s.Require().NoError(err)
+		v, err = pgx.CollectExactlyOneRow(rows, pgx.RowTo[string])
+		s.Require().NoError(err)
+		return v
+	}
+
+	// Policies only see the rows of the user in the context.
+	for user, want := range map[string]int{"alice": 2, "bob": 1, "carol": 0} {
+		uctx := context.WithValue(ctx, sessionUserKey{}, user)
+		tx, err := s.db.Pool().Begin(uctx)
+		s.Require().NoError(err)
+		s.Require().Equal(user, currentUser(tx))
+
+		var count int
+		rows, err := tx.Query(uctx, "SELECT count(*) FROM documents")
+		s.Require().NoError(err)
+		count, err = pgx.CollectExactlyOneRow(rows, pgx.RowTo[int])
+		s.Require().NoError(err)
+		s.Require().Equal(want, count, user)
+		s.Require().NoError(tx.Commit(uctx))
+	}
+
+	// Once a transaction ends, nothing remains on the pooled connections.
+	for i := 0; i < 10; i++ {
+		s.Require().Empty(currentUser(s.db.Pool()))
+
+		tx, err := s.db.Pool().Begin(ctx)
+		s.Require().NoError(err)
+		s.Require().Empty(currentUser(tx))
+		s.Require().NoError(tx.Rollback(ctx))
+	}
+
+	// Concurrent transactions each see only their own values.
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(user string) {
+			defer wg.Done()
+			uctx := context.WithValue(ctx, sessionUserKey{}, user)
+			tx, err := s.db.Pool().Begin(uctx)
+			if err != nil {
+				errs <- err
+				return
+			}
+			defer func() { _ = tx.Rollback(uctx) }()
+
+			rows, err := tx.Query(uctx, "SELECT current_setting('app.user_id'), pg_sleep(0.01)::text")
+			if err != nil {
+				errs <- err
+				return
+			}
+			got, err := pgx.CollectExactlyOneRow(rows, func(row pgx.CollectableRow) (string, error) {
+				var v, sleep string
+				err := row.Scan(&v, &sleep)
+				return v, err
+			})
+			if err != nil {
+				errs <- err
+				return
+			}
+			if got != user {
+				errs <- fmt.Errorf("user %s saw app.user_id %s", user, got)
+			}
+		}(fmt.Sprintf("user-%d", i))
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		s.Require().NoError(err)
+	}
+}
+
 /*
  * Setup
 	   ____    __
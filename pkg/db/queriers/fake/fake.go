@@ -0,0 +1,332 @@
+// Package fake provides an in-memory queriers.Querier for unit testing code
+// that talks to Postgres without starting a database.
+//
+// Expectations are registered up front and matched against every call by SQL
+// regular expression and arguments:
+//
+//	q := fake.New(t)
+//	q.ExpectQuery(`SELECT .* FROM users WHERE id = @id`).
+//		WithArgs(pgx.NamedArgs{"id": 1}).
+//		WillReturnRows(fake.NewRows("id", "name").AddRow(int64(1), "Alice"))
+//
+// Calls that match no expectation fail with an error, and New registers a
+// cleanup that fails the test if any expectation was not met.
+package fake
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/jwbonnell/go-libs/pkg/db/queriers"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// ErrUnexpectedCall is returned for any call that matches no expectation.
+var ErrUnexpectedCall = errors.New("fake: unexpected call")
+
+// Kind identifies the Querier method a call or expectation refers to.
+type Kind string
+
+const (
+	KindQuery    Kind = "query"
+	KindExec     Kind = "exec"
+	KindBegin    Kind = "begin"
+	KindCommit   Kind = "commit"
+	KindRollback Kind = "rollback"
+)
+
+// Call records a single invocation made against the fake.
+type Call struct {
+	Kind Kind
+	SQL  string
+	Args []any
+	// Tx is the depth of the transaction the call was made in, 0 when it was
+	// made directly on the Querier.
+	Tx int
+}
+
+// Querier is a fake queriers.Querier. The zero value is not usable, create
+// one with New.
+type Querier struct {
+	mu           sync.Mutex
+	expectations []*Expectation
+	calls        []Call
+	unexpected   []string
+}
+
+var _ queriers.Querier = (*Querier)(nil)
+
+// New creates a fake Querier. When t is not nil, a cleanup is registered that
+// fails the test if any expectation was not met or any unexpected call was made.
+func New(t testing.TB) *Querier {
+	q := &Querier{}
+	if t != nil {
+		t.Helper()
+		t.Cleanup(func() {
+			if err := q.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+	return q
+}
+
+// ExpectQuery registers an expectation for Query calls whose SQL matches the
+// regular expression sqlRegex.
+func (q *Querier) ExpectQuery(sqlRegex string) *Expectation {
+	return q.expect(KindQuery, sqlRegex)
+}
+
+// ExpectExec registers an expectation for Exec calls whose SQL matches the
+// regular expression sqlRegex.
+func (q *Querier) ExpectExec(sqlRegex string) *Expectation {
+	return q.expect(KindExec, sqlRegex)
+}
+
+// ExpectBegin registers an expectation for a Begin call, on the Querier or on
+// a transaction (savepoint).
+func (q *Querier) ExpectBegin() *Expectation {
+	return q.expect(KindBegin, "")
+}
+
+// ExpectCommit registers an expectation for a transaction Commit.
+func (q *Querier) ExpectCommit() *Expectation {
+	return q.expect(KindCommit, "")
+}
+
+// ExpectRollback registers an expectation for a transaction Rollback.
+func (q *Querier) ExpectRollback() *Expectation {
+	return q.expect(KindRollback, "")
+}
+
+func (q *Querier) expect(kind Kind, sqlRegex string) *Expectation {
+	e := &Expectation{kind: kind, times: 1}
+	if sqlRegex != "" {
+		e.sql = regexp.MustCompile(sqlRegex)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.expectations = append(q.expectations, e)
+	return e
+}
+
+// Calls returns every call made against the fake, including calls made inside
+// transactions, in the order they happened.
+func (q *Querier) Calls() []Call {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return append([]Call(nil), q.calls...)
+}
+
+// ExpectationsWereMet returns an error describing every expectation that was
+// not satisfied and every call that matched no expectation.
+func (q *Querier) ExpectationsWereMet() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var problems []string
+	for _, e := range q.expectations {
+		if e.calls < e.times {
+			problems = append(problems, fmt.Sprintf("expected %s, called %d of %d times", e, e.calls, e.times))
+		}
+	}
+	problems = append(problems, q.unexpected...)
+
+	if len(problems) == 0 {
+		return nil
+	}
+	return fmt.Errorf("fake: expectations not met:\n\t%s", strings.Join(problems, "\n\t"))
+}
+
+// Query records the call and returns the rows of the first matching expectation.
+func (q *Querier) Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+	return q.query(0, sql, args)
+}
+
+// Exec records the call and returns the result of the first matching expectation.
+func (q *Querier) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	return q.exec(0, sql, args)
+}
+
+// Begin records the call and starts a fake transaction.
+func (q *Querier) Begin(ctx context.Context) (*queriers.TxQuerier, error) {
+	tx, err := q.begin(1)
+	if err != nil {
+		return nil, err
+	}
+	return queriers.NewTxQuerier(tx, nil), nil
+}
+
+func (q *Querier) query(depth int, sql string, args []any) (pgx.Rows, error) {
+	e, err := q.match(Call{Kind: KindQuery, SQL: sql, Args: args, Tx: depth})
+	if err != nil {
+		return nil, err
+	}
+	if e.err != nil {
+		return nil, e.err
+	}
+	if e.rows == nil {
+		return NewRows().rows(), nil
+	}
+	return e.rows.rows(), nil
+}
+
+func (q *Querier) exec(depth int, sql string, args []any) (pgconn.CommandTag, error) {
+	e, err := q.match(Call{Kind: KindExec, SQL: sql, Args: args, Tx: depth})
+	if err != nil {
+		return pgconn.CommandTag{}, err
+	}
+	return e.result, e.err
+}
+
+func (q *Querier) begin(depth int) (*tx, error) {
+	e, err := q.match(Call{Kind: KindBegin, Tx: depth - 1})
+	if err != nil {
+		return nil, err
+	}
+	if e.err != nil {
+		return nil, e.err
+	}
+	return &tx{q: q, depth: depth}, nil
+}
+
+// match records c and consumes the first expectation that accepts it.
+func (q *Querier) match(c Call) (*Expectation, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.calls = append(q.calls, c)
+	for _, e := range q.expectations {
+		if e.calls < e.times && e.matches(c) {
+			e.calls++
+			return e, nil
+		}
+	}
+
+	desc := string(c.Kind)
+	if c.SQL != "" {
+		desc = fmt.Sprintf("%s %q with args %v", c.Kind, c.SQL, c.Args)
+	}
+	q.unexpected = append(q.unexpected, "unexpected "+desc)
+	return nil, fmt.Errorf("%w: %s", ErrUnexpectedCall, desc)
+}
+
+// ArgMatcher can be passed to Expectation.WithArgs in place of a literal value
+// to match an argument by predicate.
+type ArgMatcher interface {
+	Match(v any) bool
+}
+
+type anyArg struct{}
+
+func (anyArg) Match(any) bool { return true }
+
+// AnyArg returns an ArgMatcher that accepts any argument.
+func AnyArg() ArgMatcher {
+	return anyArg{}
+}
+
+// Expectation describes a call the fake expects and how it should respond.
+type Expectation struct {
+	kind   Kind
+	sql    *regexp.Regexp
+	args   []any
+	rows   *Rows
+	result pgconn.CommandTag
+	err    error
+	times  int
+	calls  int
+}
+
+// WithArgs restricts the expectation to calls made with exactly these
+// arguments. Values are compared with reflect.DeepEqual unless they implement
+// ArgMatcher. pgx.NamedArgs are compared key by key, so ArgMatcher values can
+// be used inside them too.
+func (e *Expectation) WithArgs(args ...any) *Expectation {
+	e.args = args
+	return e
+}
+
+// WillReturnRows sets the rows returned by a matching Query.
+func (e *Expectation) WillReturnRows(rows *Rows) *Expectation {
+	e.rows = rows
+	return e
+}
+
+// WillReturnResult sets the command tag returned by a matching Exec, for
+// example pgconn.NewCommandTag("UPDATE 1").
+func (e *Expectation) WillReturnResult(tag pgconn.CommandTag) *Expectation {
+	e.result = tag
+	return e
+}
+
+// WillReturnError makes a matching call fail with err.
+func (e *Expectation) WillReturnError(err error) *Expectation {
+	e.err = err
+	return e
+}
+
+// Times sets how many calls the expectation accepts. It defaults to one.
+func (e *Expectation) Times(n int) *Expectation {
+	e.times = n
+	return e
+}
+
+func (e *Expectation) String() string {
+	if e.sql == nil {
+		return string(e.kind)
+	}
+	return fmt.Sprintf("%s matching %q", e.kind, e.sql)
+}
+
+func (e *Expectation) matches(c Call) bool {
+	if e.kind != c.Kind {
+		return false
+	}
+	if e.sql != nil && !e.sql.MatchString(c.SQL) {
+		return false
+	}
+	if e.args == nil {
+		return true
+	}
+	if len(e.args) != len(c.Args) {
+		return false
+	}
+	for i := range e.args {
+		if !argMatches(e.args[i], c.Args[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func argMatches(want, got any) bool {
+	if m, ok := want.(ArgMatcher); ok {
+		return m.Match(got)
+	}
+
+	wantNamed, ok := want.(pgx.NamedArgs)
+	if !ok {
+		return reflect.DeepEqual(want, got)
+	}
+	gotNamed, ok := got.(pgx.NamedArgs)
+	if !ok || len(wantNamed) != len(gotNamed) {
+		return false
+	}
+	for k, v := range wantNamed {
+		gv, ok := gotNamed[k]
+		if !ok || !argMatches(v, gv) {
+			return false
+		}
+	}
+	return true
+}
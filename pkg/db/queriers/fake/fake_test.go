@@ -0,0 +1,154 @@
+package fake_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jwbonnell/go-libs/pkg/db"
+	"github.com/jwbonnell/go-libs/pkg/db/queriers"
+	"github.com/jwbonnell/go-libs/pkg/db/queriers/fake"
+	"github.com/stretchr/testify/require"
+)
+
+type user struct {
+	ID      int64   `db:"id"`
+	Name    string  `db:"name"`
+	Email   *string `db:"email"`
+	Address address `db:"address"`
+}
+
+type address struct {
+	City string `json:"city"`
+}
+
+// createUser is a typical service function written against queriers.Querier.
+func createUser(ctx context.Context, q queriers.Querier, name string) error {
+	tx, err := q.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	if _, err := tx.Exec(ctx, "INSERT INTO users (name) VALUES ($1)", name); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, "INSERT INTO audit (event) VALUES ($1)", "user created"); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func TestQuery_ReturnsScriptedRows(t *testing.T) {
+	q := fake.New(t)
+	q.ExpectQuery(`SELECT .* FROM users WHERE name = @name`).
+		WithArgs(pgx.NamedArgs{"name": "Alice"}).
+		WillReturnRows(fake.NewRows("id", "name", "email", "address").
+			AddRow(int32(1), "Alice", "alice@example.com", []byte(`{"city":"Anchorage"}`)))
+
+	var got user
+	err := db.QueryOne[user](t.Context(), q, "SELECT id, name, email, address FROM users WHERE name = @name", &got, pgx.NamedArgs{"name": "Alice"})
+	require.NoError(t, err)
+	require.Equal(t, int64(1), got.ID)
+	require.Equal(t, "Alice", got.Name)
+	require.Equal(t, "alice@example.com", *got.Email)
+	require.Equal(t, "Anchorage", got.Address.City)
+
+	calls := q.Calls()
+	require.Len(t, calls, 1)
+	require.Equal(t, fake.KindQuery, calls[0].Kind)
+	require.Equal(t, []any{pgx.NamedArgs{"name": "Alice"}}, calls[0].Args)
+}
+
+func TestQuery_MultipleRowsAndNulls(t *testing.T) {
+	q := fake.New(t)
+	q.ExpectQuery(`FROM users`).
+		WillReturnRows(fake.NewRows("id", "name", "email", "address").
+			AddRow(int64(1), "Alice", nil, address{City: "Anchorage"}).
+			AddRow(int64(2), "Bob", "bob@example.com", address{City: "Portland"})).
+		Times(2)
+
+	var got []user
+	require.NoError(t, db.Query[user](t.Context(), q, "SELECT * FROM users", &got, nil))
+	require.Len(t, got, 2)
+	require.Nil(t, got[0].Email)
+	require.Equal(t, "Portland", got[1].Address.City)
+
+	var one user
+	err := db.QueryOne[user](t.Context(), q, "SELECT * FROM users", &one, nil)
+	require.ErrorIs(t, err, db.ErrTooManyRows)
+}
+
+func TestQuery_NoRowsAndErrors(t *testing.T) {
+	q := fake.New(t)
+	boom := errors.New("boom")
+	q.ExpectQuery(`FROM users`).WithArgs(pgx.NamedArgs{"name": fake.AnyArg()}).WillReturnRows(fake.NewRows("id", "name", "email", "address"))
+	q.ExpectQuery(`FROM users`).WillReturnError(boom)
+	q.ExpectQuery(`FROM accounts`).WillReturnRows(fake.NewRows("id").AddRow(1).AddRow(2).RowError(1, boom))
+
+	got, err := db.QueryMaybe[user](t.Context(), q, "SELECT * FROM users WHERE name = @name", pgx.NamedArgs{"name": "nobody"})
+	require.NoError(t, err)
+	require.Nil(t, got)
+
+	_, err = q.Query(t.Context(), "SELECT * FROM users")
+	require.ErrorIs(t, err, boom)
+
+	rows, err := q.Query(t.Context(), "SELECT id FROM accounts")
+	require.NoError(t, err)
+	_, err = pgx.CollectRows(rows, pgx.RowTo[int])
+	require.ErrorIs(t, err, boom)
+}
+
+func TestTransaction_Commit(t *testing.T) {
+	q := fake.New(t)
+	q.ExpectBegin()
+	q.ExpectExec(`INSERT INTO users`).WithArgs("Alice").WillReturnResult(pgconn.NewCommandTag("INSERT 0 1"))
+	q.ExpectExec(`INSERT INTO audit`).WithArgs(fake.AnyArg())
+	q.ExpectCommit()
+
+	require.NoError(t, createUser(t.Context(), q, "Alice"))
+
+	calls := q.Calls()
+	require.Len(t, calls, 4)
+	require.Equal(t, fake.KindBegin, calls[0].Kind)
+	require.Equal(t, 1, calls[1].Tx)
+	require.Equal(t, fake.KindCommit, calls[3].Kind)
+}
+
+func TestTransaction_RollbackOnError(t *testing.T) {
+	q := fake.New(t)
+	q.ExpectBegin()
+	q.ExpectExec(`INSERT INTO users`).WillReturnError(errors.New("duplicate key"))
+	q.ExpectRollback()
+
+	err := createUser(t.Context(), q, "Alice")
+	require.EqualError(t, err, "duplicate key")
+}
+
+func TestTransaction_BeginError(t *testing.T) {
+	q := fake.New(t)
+	q.ExpectBegin().WillReturnError(errors.New("too many connections"))
+
+	err := createUser(t.Context(), q, "Alice")
+	require.EqualError(t, err, "too many connections")
+}
+
+func TestExpectationsWereMet(t *testing.T) {
+	q := fake.New(nil)
+	q.ExpectExec(`DELETE FROM users`)
+	q.ExpectQuery(`SELECT`).Times(2)
+
+	_, err := q.Query(t.Context(), "SELECT 1")
+	require.NoError(t, err)
+
+	_, err = q.Exec(t.Context(), "UPDATE users SET name = 'x'")
+	require.ErrorIs(t, err, fake.ErrUnexpectedCall)
+
+	err = q.ExpectationsWereMet()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), `exec matching "DELETE FROM users", called 0 of 1 times`)
+	require.Contains(t, err.Error(), `query matching "SELECT", called 1 of 2 times`)
+	require.Contains(t, err.Error(), `unexpected exec "UPDATE users SET name = 'x'"`)
+}
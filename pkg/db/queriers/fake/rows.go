@@ -0,0 +1,222 @@
+package fake
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Rows is a scripted result set returned by a Query expectation. Every
+// matching call gets its own cursor over the same values, so one Rows can back
+// an expectation that is matched several times.
+type Rows struct {
+	columns []string
+	values  [][]any
+	errAt   int
+	err     error
+}
+
+// NewRows creates an empty result set with the given column names. Column
+// names are what pgx.RowToStructByName matches struct fields against.
+func NewRows(columns ...string) *Rows {
+	return &Rows{columns: columns, errAt: -1}
+}
+
+// AddRow appends a row. It panics if the number of values does not match the
+// number of columns, which is always a mistake in the test itself.
+func (r *Rows) AddRow(values ...any) *Rows {
+	if len(values) != len(r.columns) {
+		panic(fmt.Sprintf("fake: AddRow got %d values for %d columns", len(values), len(r.columns)))
+	}
+	r.values = append(r.values, values)
+	return r
+}
+
+// RowError makes iteration fail with err when it reaches row i (zero based),
+// simulating an error that occurs part way through reading a result set.
+func (r *Rows) RowError(i int, err error) *Rows {
+	r.errAt = i
+	r.err = err
+	return r
+}
+
+func (r *Rows) rows() *rows {
+	fields := make([]pgconn.FieldDescription, len(r.columns))
+	for i, c := range r.columns {
+		fields[i] = pgconn.FieldDescription{Name: c}
+	}
+	return &rows{def: r, fields: fields, pos: -1}
+}
+
+// rows is a cursor over a Rows definition that implements pgx.Rows.
+type rows struct {
+	def    *Rows
+	fields []pgconn.FieldDescription
+	pos    int
+	err    error
+	closed bool
+}
+
+var _ pgx.Rows = (*rows)(nil)
+
+func (r *rows) Close() {
+	r.closed = true
+}
+
+func (r *rows) Err() error {
+	return r.err
+}
+
+func (r *rows) CommandTag() pgconn.CommandTag {
+	return pgconn.NewCommandTag(fmt.Sprintf("SELECT %d", len(r.def.values)))
+}
+
+func (r *rows) FieldDescriptions() []pgconn.FieldDescription {
+	return r.fields
+}
+
+func (r *rows) Next() bool {
+	if r.closed {
+		return false
+	}
+
+	r.pos++
+	if r.pos == r.def.errAt {
+		r.err = r.def.err
+		r.Close()
+		return false
+	}
+	if r.pos >= len(r.def.values) {
+		r.Close()
+		return false
+	}
+	return true
+}
+
+func (r *rows) Scan(dest ...any) error {
+	if r.pos < 0 || r.pos >= len(r.def.values) {
+		return fmt.Errorf("fake: scan called without a current row")
+	}
+
+	values := r.def.values[r.pos]
+	if len(dest) != len(values) {
+		return fmt.Errorf("fake: number of field descriptions must equal number of destinations, got %d and %d", len(values), len(dest))
+	}
+
+	for i := range dest {
+		if err := assign(dest[i], values[i]); err != nil {
+			return fmt.Errorf("can't scan into dest[%d] (col: %s): %w", i, r.def.columns[i], err)
+		}
+	}
+	return nil
+}
+
+func (r *rows) Values() ([]any, error) {
+	if r.pos < 0 || r.pos >= len(r.def.values) {
+		return nil, fmt.Errorf("fake: values called without a current row")
+	}
+	return append([]any(nil), r.def.values[r.pos]...), nil
+}
+
+func (r *rows) RawValues() [][]byte {
+	return nil
+}
+
+func (r *rows) Conn() *pgx.Conn {
+	return nil
+}
+
+// assign stores src into the pointer dest, loosely following the conversions
+// pgx performs: sql.Scanner destinations, pointers for NULLs, numeric and
+// string conversions, and JSON for structs, maps and slices.
+func assign(dest, src any) error {
+	if dest == nil {
+		return nil
+	}
+	if s, ok := dest.(sql.Scanner); ok {
+		return s.Scan(src)
+	}
+
+	dv := reflect.ValueOf(dest)
+	if dv.Kind() != reflect.Pointer || dv.IsNil() {
+		return fmt.Errorf("destination must be a non-nil pointer, got %T", dest)
+	}
+	return assignValue(dv.Elem(), src)
+}
+
+func assignValue(dst reflect.Value, src any) error {
+	if src == nil {
+		switch dst.Kind() {
+		case reflect.Pointer, reflect.Interface, reflect.Slice, reflect.Map:
+			dst.Set(reflect.Zero(dst.Type()))
+			return nil
+		default:
+			return fmt.Errorf("cannot scan NULL into %s", dst.Type())
+		}
+	}
+
+	sv := reflect.ValueOf(src)
+	if sv.Type().AssignableTo(dst.Type()) {
+		dst.Set(sv)
+		return nil
+	}
+
+	if dst.Kind() == reflect.Pointer {
+		v := reflect.New(dst.Type().Elem())
+		if err := assignValue(v.Elem(), src); err != nil {
+			return err
+		}
+		dst.Set(v)
+		return nil
+	}
+
+	if sameKindClass(sv.Kind(), dst.Kind()) && sv.Type().ConvertibleTo(dst.Type()) {
+		dst.Set(sv.Convert(dst.Type()))
+		return nil
+	}
+
+	switch dst.Kind() {
+	case reflect.Struct, reflect.Map, reflect.Slice:
+		var raw []byte
+		switch v := src.(type) {
+		case []byte:
+			raw = v
+		case string:
+			raw = []byte(v)
+		default:
+			b, err := json.Marshal(src)
+			if err != nil {
+				return err
+			}
+			raw = b
+		}
+		return json.Unmarshal(raw, dst.Addr().Interface())
+	}
+
+	return fmt.Errorf("cannot scan %T into %s", src, dst.Type())
+}
+
+// sameKindClass reports whether converting between the two kinds keeps the
+// meaning of the value, which rules out reflect's int to string rune
+// conversion for example.
+func sameKindClass(a, b reflect.Kind) bool {
+	class := func(k reflect.Kind) int {
+		switch k {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+			reflect.Float32, reflect.Float64:
+			return 1
+		case reflect.String:
+			return 2
+		case reflect.Bool:
+			return 3
+		default:
+			return int(k) + 100
+		}
+	}
+	return class(a) == class(b)
+}
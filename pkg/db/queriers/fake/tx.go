@@ -0,0 +1,130 @@
+package fake
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// errNotSupported is returned by the parts of pgx.Tx the fake does not model.
+var errNotSupported = errors.New("fake: not supported")
+
+// tx is a fake pgx.Tx. Statements run inside it are matched against the
+// expectations of the Querier that started it.
+type tx struct {
+	q      *Querier
+	depth  int
+	closed bool
+}
+
+var _ pgx.Tx = (*tx)(nil)
+
+func (t *tx) Begin(ctx context.Context) (pgx.Tx, error) {
+	if t.closed {
+		return nil, pgx.ErrTxClosed
+	}
+	return t.q.begin(t.depth + 1)
+}
+
+func (t *tx) Commit(ctx context.Context) error {
+	if t.closed {
+		return pgx.ErrTxClosed
+	}
+	t.closed = true
+
+	e, err := t.q.match(Call{Kind: KindCommit, Tx: t.depth})
+	if err != nil {
+		return err
+	}
+	return e.err
+}
+
+// Rollback of a transaction that was already committed or rolled back returns
+// pgx.ErrTxClosed without consuming an expectation, so the usual
+// `defer tx.Rollback(ctx)` pattern needs no extra setup.
+func (t *tx) Rollback(ctx context.Context) error {
+	if t.closed {
+		return pgx.ErrTxClosed
+	}
+	t.closed = true
+
+	e, err := t.q.match(Call{Kind: KindRollback, Tx: t.depth})
+	if err != nil {
+		return err
+	}
+	return e.err
+}
+
+func (t *tx) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	if t.closed {
+		return pgconn.CommandTag{}, pgx.ErrTxClosed
+	}
+	return t.q.exec(t.depth, sql, args)
+}
+
+func (t *tx) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	if t.closed {
+		return nil, pgx.ErrTxClosed
+	}
+	return t.q.query(t.depth, sql, args)
+}
+
+func (t *tx) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	rows, err := t.Query(ctx, sql, args...)
+	return &row{rows: rows, err: err}
+}
+
+func (t *tx) CopyFrom(ctx context.Context, tableName pgx.Identifier, columnNames []string, rowSrc pgx.CopyFromSource) (int64, error) {
+	return 0, errNotSupported
+}
+
+func (t *tx) SendBatch(ctx context.Context, b *pgx.Batch) pgx.BatchResults {
+	return batchResults{}
+}
+
+func (t *tx) LargeObjects() pgx.LargeObjects {
+	return pgx.LargeObjects{}
+}
+
+func (t *tx) Prepare(ctx context.Context, name, sql string) (*pgconn.StatementDescription, error) {
+	return nil, errNotSupported
+}
+
+func (t *tx) Conn() *pgx.Conn {
+	return nil
+}
+
+// row adapts the result of Query to pgx.Row.
+type row struct {
+	rows pgx.Rows
+	err  error
+}
+
+func (r *row) Scan(dest ...any) error {
+	if r.err != nil {
+		return r.err
+	}
+	defer r.rows.Close()
+
+	if !r.rows.Next() {
+		if err := r.rows.Err(); err != nil {
+			return err
+		}
+		return pgx.ErrNoRows
+	}
+	if err := r.rows.Scan(dest...); err != nil {
+		return err
+	}
+	r.rows.Close()
+	return r.rows.Err()
+}
+
+// batchResults fails every batch operation with errNotSupported.
+type batchResults struct{}
+
+func (batchResults) Exec() (pgconn.CommandTag, error) { return pgconn.CommandTag{}, errNotSupported }
+func (batchResults) Query() (pgx.Rows, error)         { return nil, errNotSupported }
+func (batchResults) QueryRow() pgx.Row                { return &row{err: errNotSupported} }
+func (batchResults) Close() error                     { return nil }
@@ -6,6 +6,7 @@ import (
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/jwbonnell/go-libs/pkg/logx"
+	"github.com/jwbonnell/go-libs/pkg/tracing"
 )
 
 // Querier is a minimal adapter interface that abstracts over a pgx connection
@@ -28,86 +29,171 @@ type Querier interface {
 	Begin(ctx context.Context) (*TxQuerier, error)
 }
 
+// Execer is implemented by anything that can execute a statement, such as a
+// *pgx.Conn, a pgx.Tx or any Querier.
+type Execer interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+}
+
 // PoolQuerier is a thin wrapper around *pgxpool.Pool that implements Querier.
 //
 // Fields:
 //   - Q: underlying connection pool (required).
 //   - Log: optional logger that callers or higher-level helpers can use.
+//   - TenantSchema: optional mapping from a tenant ID (see WithTenant) to the
+//     schema holding that tenant's tables. When set, transactions started
+//     with a tenant in the context are scoped to that schema with SET LOCAL.
+//   - SessionVars: optional extractor whose settings are applied with SET LOCAL
+//     to every transaction started through Begin.
+//   - Tracer: optional tracer recording a client span, with the SQL text as an
+//     attribute, for every statement run through the querier and the
+//     transactions it starts.
 type PoolQuerier struct {
-	Q   *pgxpool.Pool
-	Log *logx.Logger
+	Q            *pgxpool.Pool
+	Log          *logx.Logger
+	TenantSchema func(tenantID string) string
+	SessionVars  SessionVarsFn
+	Tracer       *tracing.Tracer
 }
 
 // Query forwards the call to the underlying pool's Query method.
 // The caller must close the returned rows.
 func (pq *PoolQuerier) Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
-	return pq.Q.Query(ctx, sql, args...)
+	return tracedQuery(ctx, pq.Tracer, sql, func(ctx context.Context) (pgx.Rows, error) {
+		return pq.Q.Query(ctx, sql, args...)
+	})
 }
 
 // QueryRow is a convenience helper forwarding to pool.QueryRow for single-row queries.
 func (pq *PoolQuerier) QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row {
-	return pq.Q.QueryRow(ctx, sql, args...)
+	ctx, span := startSpan(ctx, pq.Tracer, sql)
+	row := pq.Q.QueryRow(ctx, sql, args...)
+	if span == nil {
+		return row
+	}
+	return spanRow{Row: row, span: span}
 }
 
 // Exec forwards the call to the underlying pool's Exec method and returns the CommandTag.
 func (pq *PoolQuerier) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
-	return pq.Q.Exec(ctx, sql, args...)
+	return tracedExec(ctx, pq.Tracer, sql, func(ctx context.Context) (pgconn.CommandTag, error) {
+		return pq.Q.Exec(ctx, sql, args...)
+	})
 }
 
 // Begin starts a transaction on the pool and returns a TxQuerier that wraps it.
 func (pq *PoolQuerier) Begin(ctx context.Context) (*TxQuerier, error) {
-	tx, err := pq.Q.Begin(ctx)
+	bctx, span := startSpan(ctx, pq.Tracer, "BEGIN")
+	tx, err := pq.Q.Begin(bctx)
+	endSpan(span, err)
 	if err != nil {
 		return nil, err
 	}
 
+	if tenantID, ok := TenantFromContext(ctx); ok && pq.TenantSchema != nil {
+		if err := SetSearchPath(ctx, tx, pq.TenantSchema(tenantID), true); err != nil {
+			_ = tx.Rollback(ctx)
+			return nil, err
+		}
+	}
+
+	if pq.SessionVars != nil {
+		if err := SetLocalVars(ctx, tx, pq.SessionVars(ctx)); err != nil {
+			_ = tx.Rollback(ctx)
+			return nil, err
+		}
+	}
+
 	return &TxQuerier{
-		q:   tx,
-		log: pq.Log,
+		q:      tx,
+		log:    pq.Log,
+		tracer: pq.Tracer,
 	}, nil
 }
 
 // TxQuerier wraps a pgx.Tx and implements Querier for use inside transactions.
 //
 // The wrapper stores the pgx.Tx (interface) directly (not a pointer to an
-// interface). The optional logx field is carried through from PoolQuerier when
-// transactions are started.
+// interface). The optional logx and tracer fields are carried through from
+// PoolQuerier when transactions are started.
 type TxQuerier struct {
-	q   pgx.Tx
-	log *logx.Logger
+	q      pgx.Tx
+	log    *logx.Logger
+	tracer *tracing.Tracer
+	done   bool // committed or rolled back
+}
+
+// NewTxQuerier wraps an already started transaction. It is mostly useful for
+// Querier implementations other than PoolQuerier, such as test fakes.
+func NewTxQuerier(tx pgx.Tx, log *logx.Logger) *TxQuerier {
+	return &TxQuerier{
+		q:   tx,
+		log: log,
+	}
+}
+
+// WithTracer returns a copy of tq that records a span for every statement it
+// runs, for transactions created with NewTxQuerier.
+func (tq *TxQuerier) WithTracer(tracer *tracing.Tracer) *TxQuerier {
+	return &TxQuerier{
+		q:      tq.q,
+		log:    tq.log,
+		tracer: tracer,
+	}
 }
 
 // Query forwards to the underlying transaction's Query method.
 // Callers must close the returned rows.
 func (tq *TxQuerier) Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
-	return tq.q.Query(ctx, sql, args...)
+	return tracedQuery(ctx, tq.tracer, sql, func(ctx context.Context) (pgx.Rows, error) {
+		return tq.q.Query(ctx, sql, args...)
+	})
 }
 
 // Exec forwards to the underlying transaction's Exec method and returns the CommandTag.
 func (tq *TxQuerier) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
-	return tq.q.Exec(ctx, sql, args...)
+	return tracedExec(ctx, tq.tracer, sql, func(ctx context.Context) (pgconn.CommandTag, error) {
+		return tq.q.Exec(ctx, sql, args...)
+	})
 }
 
 // Begin starts a nested transaction (savepoint) on the current transaction, if
 // supported by pgx. It returns a new TxQuerier wrapping the nested transaction.
 func (tq *TxQuerier) Begin(ctx context.Context) (*TxQuerier, error) {
-	tx, err := tq.q.Begin(ctx)
+	bctx, span := startSpan(ctx, tq.tracer, "SAVEPOINT")
+	tx, err := tq.q.Begin(bctx)
+	endSpan(span, err)
 	if err != nil {
 		return nil, err
 	}
 
 	return &TxQuerier{
-		q:   tx,
-		log: tq.log,
+		q:      tx,
+		log:    tq.log,
+		tracer: tq.tracer,
 	}, nil
 }
 
 // Commit commits the underlying transaction.
 func (tq *TxQuerier) Commit(ctx context.Context) error {
-	return tq.q.Commit(ctx)
+	tq.done = true
+
+	ctx, span := startSpan(ctx, tq.tracer, "COMMIT")
+	err := tq.q.Commit(ctx)
+	endSpan(span, err)
+	return err
 }
 
 // Rollback rolls back the underlying transaction.
 func (tq *TxQuerier) Rollback(ctx context.Context) error {
-	return tq.q.Rollback(ctx)
+	if tq.done {
+		// The usual deferred rollback after Commit is a no-op; don't trace it.
+		return tq.q.Rollback(ctx)
+	}
+	tq.done = true
+
+	ctx, span := startSpan(ctx, tq.tracer, "ROLLBACK")
+	err := tq.q.Rollback(ctx)
+	endSpan(span, err)
+	return err
 }
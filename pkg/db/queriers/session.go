@@ -0,0 +1,40 @@
+package queriers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// SessionVarsFn extracts Postgres configuration parameters from a context,
+// keyed by setting name (for example "app.user_id" or "app.role"). It is used
+// to expose request scoped values to row-level-security policies through
+// current_setting().
+type SessionVarsFn func(ctx context.Context) map[string]string
+
+// SetLocalVars applies vars to the transaction behind q with SET LOCAL
+// semantics, so the values are discarded when the transaction ends and never
+// outlive it on a pooled connection. All settings are applied in a single
+// round trip.
+func SetLocalVars(ctx context.Context, q Execer, vars map[string]string) error {
+	if len(vars) == 0 {
+		return nil
+	}
+
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	calls := make([]string, 0, len(names))
+	args := make([]any, 0, len(names)*2)
+	for i, name := range names {
+		calls = append(calls, fmt.Sprintf("set_config($%d, $%d, true)", i*2+1, i*2+2))
+		args = append(args, name, vars[name])
+	}
+
+	_, err := q.Exec(ctx, "SELECT "+strings.Join(calls, ", "), args...)
+	return err
+}
@@ -0,0 +1,32 @@
+package queriers
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+)
+
+type tenantKey struct{}
+
+// WithTenant returns a copy of ctx that scopes every query run through a
+// tenant aware querier to the schema of the given tenant.
+func WithTenant(ctx context.Context, tenantID string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenantID)
+}
+
+// TenantFromContext returns the tenant ID stored in ctx by WithTenant.
+func TenantFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(tenantKey{}).(string)
+	if !ok || id == "" {
+		return "", false
+	}
+	return id, true
+}
+
+// SetSearchPath points the search_path of the connection behind q at schema.
+// When local is true the setting only lasts until the end of the current
+// transaction (SET LOCAL), otherwise it applies to the whole session.
+func SetSearchPath(ctx context.Context, q Execer, schema string, local bool) error {
+	_, err := q.Exec(ctx, "SELECT set_config('search_path', $1, $2)", pgx.Identifier{schema}.Sanitize(), local)
+	return err
+}
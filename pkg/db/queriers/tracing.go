@@ -0,0 +1,116 @@
+package queriers
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jwbonnell/go-libs/pkg/tracing"
+)
+
+// startSpan starts a client span for sql as a child of the span in ctx. It
+// returns a nil span, which ignores every call, when tracer is nil.
+func startSpan(ctx context.Context, tracer *tracing.Tracer, sql string) (context.Context, *tracing.Span) {
+	if tracer == nil {
+		return ctx, nil
+	}
+
+	op := operationName(sql)
+	return tracer.Start(ctx, op,
+		tracing.WithKind(tracing.SpanKindClient),
+		tracing.WithAttributes(
+			"db.system.name", "postgresql",
+			"db.operation.name", op,
+			"db.query.text", sql,
+		),
+	)
+}
+
+// endSpan finishes span, recording err unless it only reports that no rows
+// matched.
+func endSpan(span *tracing.Span, err error) {
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		span.RecordError(err)
+	}
+	span.End()
+}
+
+// operationName returns the leading keyword of sql, such as SELECT.
+func operationName(sql string) string {
+	fields := strings.Fields(sql)
+	if len(fields) == 0 {
+		return "QUERY"
+	}
+	return strings.ToUpper(strings.TrimRight(fields[0], ";("))
+}
+
+// tracedQuery runs query within a span that stays open until the returned
+// rows are closed, so it covers reading the results too.
+func tracedQuery(ctx context.Context, tracer *tracing.Tracer, sql string, query func(ctx context.Context) (pgx.Rows, error)) (pgx.Rows, error) {
+	ctx, span := startSpan(ctx, tracer, sql)
+	if span == nil {
+		return query(ctx)
+	}
+
+	rows, err := query(ctx)
+	if err != nil {
+		endSpan(span, err)
+		return nil, err
+	}
+	return &spanRows{Rows: rows, span: span}, nil
+}
+
+// tracedExec runs exec within a span recording the number of affected rows.
+func tracedExec(ctx context.Context, tracer *tracing.Tracer, sql string, exec func(ctx context.Context) (pgconn.CommandTag, error)) (pgconn.CommandTag, error) {
+	ctx, span := startSpan(ctx, tracer, sql)
+	tag, err := exec(ctx)
+	if err == nil {
+		span.SetAttributes("db.response.rows_affected", tag.RowsAffected())
+	}
+	endSpan(span, err)
+	return tag, err
+}
+
+// spanRows ends its span when the rows are closed.
+type spanRows struct {
+	pgx.Rows
+	span *tracing.Span
+	once sync.Once
+}
+
+func (r *spanRows) Next() bool {
+	if r.Rows.Next() {
+		return true
+	}
+	r.finish()
+	return false
+}
+
+func (r *spanRows) Close() {
+	r.Rows.Close()
+	r.finish()
+}
+
+func (r *spanRows) finish() {
+	r.once.Do(func() {
+		if r.Rows.Err() == nil {
+			r.span.SetAttributes("db.response.returned_rows", r.Rows.CommandTag().RowsAffected())
+		}
+		endSpan(r.span, r.Rows.Err())
+	})
+}
+
+// spanRow ends its span when the row is scanned.
+type spanRow struct {
+	pgx.Row
+	span *tracing.Span
+}
+
+func (r spanRow) Scan(dest ...any) error {
+	err := r.Row.Scan(dest...)
+	endSpan(r.span, err)
+	return err
+}
@@ -0,0 +1,109 @@
+package queriers_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jwbonnell/go-libs/pkg/db/queriers/fake"
+	"github.com/jwbonnell/go-libs/pkg/tracing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTxQuerier_WithTracerRecordsStatementSpans(t *testing.T) {
+	q := fake.New(t)
+	q.ExpectBegin()
+	q.ExpectQuery(`SELECT id FROM users`).
+		WillReturnRows(fake.NewRows("id").AddRow(int64(1)).AddRow(int64(2)))
+	q.ExpectExec(`UPDATE users`).WillReturnResult(pgconn.NewCommandTag("UPDATE 2"))
+	q.ExpectExec(`DELETE FROM users`).WillReturnError(errors.New("permission denied"))
+	q.ExpectCommit()
+
+	exp := tracing.NewInMemoryExporter()
+	tracer := tracing.NewTracer("svc", exp)
+	ctx, parent := tracer.Start(context.Background(), "GET /users")
+
+	tx, err := q.Begin(ctx)
+	require.NoError(t, err)
+	tx = tx.WithTracer(tracer)
+
+	rows, err := tx.Query(ctx, "SELECT id FROM users")
+	require.NoError(t, err)
+	for rows.Next() {
+	}
+	rows.Close()
+
+	_, err = tx.Exec(ctx, "UPDATE users SET active = true")
+	require.NoError(t, err)
+	_, err = tx.Exec(ctx, "DELETE FROM users")
+	require.Error(t, err)
+	require.NoError(t, tx.Commit(ctx))
+	parent.End()
+
+	spans := exp.Spans()
+	require.Len(t, spans, 5)
+
+	sel, upd, del, commit := spans[0], spans[1], spans[2], spans[3]
+	for _, s := range spans[:4] {
+		assert.Equal(t, parent.SpanContext().SpanID, s.Parent)
+		assert.Equal(t, tracing.SpanKindClient, s.Kind)
+		assert.Equal(t, "postgresql", s.Attributes["db.system.name"])
+	}
+
+	assert.Equal(t, "SELECT", sel.Name)
+	assert.Equal(t, "SELECT id FROM users", sel.Attributes["db.query.text"])
+	assert.Equal(t, tracing.StatusUnset, sel.Status)
+
+	assert.Equal(t, "UPDATE", upd.Name)
+	assert.Equal(t, int64(2), upd.Attributes["db.response.rows_affected"])
+
+	assert.Equal(t, "DELETE", del.Name)
+	assert.Equal(t, tracing.StatusError, del.Status)
+	assert.Equal(t, "permission denied", del.StatusMessage)
+
+	assert.Equal(t, "COMMIT", commit.Name)
+}
+
+func TestTxQuerier_NoTracer(t *testing.T) {
+	q := fake.New(t)
+	q.ExpectBegin()
+	q.ExpectExec(`UPDATE users`)
+
+	tx, err := q.Begin(context.Background())
+	require.NoError(t, err)
+	_, err = tx.Exec(context.Background(), "UPDATE users SET active = true")
+	require.NoError(t, err)
+}
+
+func TestTxQuerier_WithTracerRecordsRollback(t *testing.T) {
+	q := fake.New(t)
+	q.ExpectBegin()
+	q.ExpectRollback().WillReturnError(errors.New("connection reset"))
+	q.ExpectBegin()
+	q.ExpectCommit()
+
+	exp := tracing.NewInMemoryExporter()
+	tracer := tracing.NewTracer("svc", exp)
+	ctx := context.Background()
+
+	tx, err := q.Begin(ctx)
+	require.NoError(t, err)
+	tx = tx.WithTracer(tracer)
+	require.Error(t, tx.Rollback(ctx))
+
+	// The deferred rollback after a commit doesn't add a span.
+	tx, err = q.Begin(ctx)
+	require.NoError(t, err)
+	tx = tx.WithTracer(tracer)
+	require.NoError(t, tx.Commit(ctx))
+	_ = tx.Rollback(ctx)
+
+	spans := exp.Spans()
+	require.Len(t, spans, 2)
+	assert.Equal(t, "ROLLBACK", spans[0].Name)
+	assert.Equal(t, tracing.StatusError, spans[0].Status)
+	assert.Equal(t, "connection reset", spans[0].StatusMessage)
+	assert.Equal(t, "COMMIT", spans[1].Name)
+}
@@ -2,13 +2,20 @@ package db
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/jwbonnell/go-libs/pkg/db/queriers"
 
 	"github.com/jackc/pgx/v5"
 )
 
-// QueryOne database record
+// ErrTooManyRows is returned by QueryOne when the query matches more than one
+// row. It is the same value as pgx.ErrTooManyRows so either can be used with
+// errors.Is.
+var ErrTooManyRows = pgx.ErrTooManyRows
+
+// QueryOne database record. The query must return exactly one row: no rows
+// results in pgx.ErrNoRows and more than one row results in ErrTooManyRows.
 func QueryOne[T any](ctx context.Context, q queriers.Querier, sql string, dest *T, namedArgs pgx.NamedArgs) error {
 	rows, err := q.Query(ctx, sql, namedArgs)
 	if err != nil {
@@ -16,20 +23,46 @@ func QueryOne[T any](ctx context.Context, q queriers.Querier, sql string, dest *
 	}
 	defer rows.Close()
 
-	// Use pgx.CollectOneRow with RowToStructByName for struct mapping
 	// If T is not a struct, the RowToStructByName will fail and Scan will be required.
-	var got []T
-	got, err = pgx.CollectRows(rows, pgx.RowToStructByName[T])
+	got, err := pgx.CollectExactlyOneRow(rows, pgx.RowToStructByName[T])
 	if err != nil {
 		return fmt.Errorf("collect row: %w", err)
 	}
-	if len(got) == 0 {
-		return pgx.ErrNoRows
+	*dest = got
+	return nil
+}
+
+// QueryFirst returns the first database record of a query that may match
+// many. Remaining rows are discarded. No rows results in pgx.ErrNoRows.
+func QueryFirst[T any](ctx context.Context, q queriers.Querier, sql string, dest *T, namedArgs pgx.NamedArgs) error {
+	rows, err := q.Query(ctx, sql, namedArgs)
+	if err != nil {
+		return fmt.Errorf("query: %w", err)
 	}
-	*dest = got[0]
+	defer rows.Close()
+
+	got, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[T])
+	if err != nil {
+		return fmt.Errorf("collect row: %w", err)
+	}
+	*dest = got
 	return nil
 }
 
+// QueryMaybe database record. It behaves like QueryOne but returns a nil
+// record instead of pgx.ErrNoRows when the query matches nothing.
+func QueryMaybe[T any](ctx context.Context, q queriers.Querier, sql string, namedArgs pgx.NamedArgs) (*T, error) {
+	var dest T
+	err := QueryOne[T](ctx, q, sql, &dest, namedArgs)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &dest, nil
+}
+
 // Query multiple database records
 func Query[T any](ctx context.Context, q queriers.Querier, sql string, dest *[]T, namedArgs pgx.NamedArgs) error {
 	rows, err := q.Query(ctx, sql, namedArgs)
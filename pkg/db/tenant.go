@@ -0,0 +1,136 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jwbonnell/go-libs/pkg/db/queriers"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const defaultTenantSchemaPrefix = "tenant_"
+
+// tenantScope tracks the pooled connections whose search_path was switched to
+// a tenant schema so they can be reset before going back to the pool.
+type tenantScope struct {
+	prefix string
+	conns  sync.Map // *pgx.Conn -> struct{}
+}
+
+func newTenantScope(prefix string) *tenantScope {
+	if prefix == "" {
+		prefix = defaultTenantSchemaPrefix
+	}
+	return &tenantScope{prefix: prefix}
+}
+
+func (ts *tenantScope) schema(tenantID string) string {
+	return ts.prefix + tenantID
+}
+
+// prepareConn is installed as the pool's PrepareConn hook. When the context
+// used to acquire the connection carries a tenant, the connection's
+// search_path is pointed at the tenant schema for as long as it is checked out.
+func (ts *tenantScope) prepareConn(ctx context.Context, conn *pgx.Conn) (bool, error) {
+	tenantID, ok := queriers.TenantFromContext(ctx)
+	if !ok {
+		return true, nil
+	}
+
+	if err := queriers.SetSearchPath(ctx, conn, ts.schema(tenantID), false); err != nil {
+		return false, fmt.Errorf("set tenant search_path: %w", err)
+	}
+	ts.conns.Store(conn, struct{}{})
+	return true, nil
+}
+
+// afterRelease is installed as the pool's AfterRelease hook. It restores the
+// search_path of tenant scoped connections so they can't leak into the next
+// acquire. Connections that can't be reset are destroyed.
+func (ts *tenantScope) afterRelease(conn *pgx.Conn) bool {
+	if _, ok := ts.conns.LoadAndDelete(conn); !ok {
+		return true
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	_, err := conn.Exec(ctx, "RESET search_path")
+	return err == nil
+}
+
+func (ts *tenantScope) beforeClose(conn *pgx.Conn) {
+	ts.conns.Delete(conn)
+}
+
+// TenantSchema returns the name of the schema holding the given tenant's tables.
+func (d *DB) TenantSchema(tenantID string) string {
+	return d.tenants.schema(tenantID)
+}
+
+// CreateTenantSchema creates the schema for the given tenant if it doesn't
+// already exist.
+func (d *DB) CreateTenantSchema(ctx context.Context, tenantID string) error {
+	ident := pgx.Identifier{d.TenantSchema(tenantID)}.Sanitize()
+	if _, err := d.pool.Exec(ctx, "CREATE SCHEMA IF NOT EXISTS "+ident); err != nil {
+		return fmt.Errorf("create tenant schema: %w", err)
+	}
+	return nil
+}
+
+// MigrateTenant applies migrations to the given tenant's schema inside a
+// single transaction. Migrations are numbered by their position in the slice,
+// starting at 1, and the versions already applied are recorded in a
+// schema_migrations table within the tenant schema, so calling MigrateTenant
+// again with a longer slice only applies the new entries.
+func (d *DB) MigrateTenant(ctx context.Context, tenantID string, migrations ...string) error {
+	if err := d.CreateTenantSchema(ctx, tenantID); err != nil {
+		return err
+	}
+
+	tx, err := d.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin: %w", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	if err := queriers.SetSearchPath(ctx, tx, d.TenantSchema(tenantID), true); err != nil {
+		return fmt.Errorf("set tenant search_path: %w", err)
+	}
+
+	if _, err := tx.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version int PRIMARY KEY,
+			applied_at timestamptz NOT NULL DEFAULT now()
+		)`); err != nil {
+		return fmt.Errorf("create schema_migrations: %w", err)
+	}
+
+	// Serialise concurrent migrations of the same tenant.
+	if _, err := tx.Exec(ctx, "LOCK TABLE schema_migrations IN EXCLUSIVE MODE"); err != nil {
+		return fmt.Errorf("lock schema_migrations: %w", err)
+	}
+
+	var current int
+	if err := tx.QueryRow(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&current); err != nil {
+		return fmt.Errorf("read schema version: %w", err)
+	}
+
+	for i := current; i < len(migrations); i++ {
+		version := i + 1
+		if _, err := tx.Exec(ctx, migrations[i]); err != nil {
+			return fmt.Errorf("migration %d: %w", version, err)
+		}
+		if _, err := tx.Exec(ctx, "INSERT INTO schema_migrations (version) VALUES ($1)", version); err != nil {
+			return fmt.Errorf("record migration %d: %w", version, err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+	return nil
+}
@@ -9,6 +9,7 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"slices"
 	"time"
 )
 
@@ -18,10 +19,39 @@ type Level = slog.Level
 // the specified context.
 type TraceIDFn func(ctx context.Context) string
 
+// ContextAttrsFn represents a function that returns extra key/value pairs,
+// such as a span id, to add to every record logged with the specified
+// context.
+type ContextAttrsFn func(ctx context.Context) []any
+
 type Logger struct {
 	discard   bool
 	handler   slog.Handler
 	traceIDFn TraceIDFn
+	attrsFns  []ContextAttrsFn
+}
+
+// WithContextAttrs returns a copy of the logger that also logs the key/value
+// pairs returned by fn for each record.
+func (log *Logger) WithContextAttrs(fn ContextAttrsFn) *Logger {
+	l := *log
+	l.attrsFns = append(slices.Clip(log.attrsFns), fn)
+	return &l
+}
+
+// WithTraceID returns a copy of the logger that takes the trace ID of each
+// record from fn, falling back to the logger's own TraceIDFn where fn returns
+// "", e.g. outside a request.
+func (log *Logger) WithTraceID(fn TraceIDFn) *Logger {
+	l := *log
+	prev := log.traceIDFn
+	l.traceIDFn = func(ctx context.Context) string {
+		if id := fn(ctx); id != "" || prev == nil {
+			return id
+		}
+		return prev(ctx)
+	}
+	return &l
 }
 
 // Debug logs at LevelDebug with the given context.
@@ -81,6 +111,9 @@ func (log *Logger) write(ctx context.Context, level Level, caller int, msg strin
 	if log.traceIDFn != nil {
 		args = append(args, "trace_id", log.traceIDFn(ctx))
 	}
+	for _, fn := range log.attrsFns {
+		args = append(args, fn(ctx)...)
+	}
 	r.Add(args...)
 
 	log.handler.Handle(ctx, r)
@@ -314,3 +314,67 @@ func BenchmarkLoggerPerformance(b *testing.B) {
 		})
 	}
 }
+
+// TestLoggerWithContextAttrs tests that context attributes are added to records
+// without affecting the original logger.
+func TestLoggerWithContextAttrs(t *testing.T) {
+	var buf bytes.Buffer
+	base := New(&buf, slog.LevelDebug, "test-service", mockTraceIDFn)
+
+	type key struct{}
+	logger := base.WithContextAttrs(func(ctx context.Context) []any {
+		if v, ok := ctx.Value(key{}).(string); ok {
+			return []any{"span_id", v}
+		}
+		return nil
+	})
+
+	ctx := context.WithValue(context.Background(), key{}, "span-1")
+	logger.Info(ctx, "with span")
+	logger.Info(context.Background(), "without span")
+	base.Info(ctx, "base logger")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Len(t, lines, 3)
+
+	var entries []map[string]any
+	for _, line := range lines {
+		var e map[string]any
+		assert.NoError(t, json.Unmarshal([]byte(line), &e))
+		entries = append(entries, e)
+	}
+
+	assert.Equal(t, "span-1", entries[0]["span_id"])
+	assert.Equal(t, "test-trace-id", entries[0]["trace_id"])
+	assert.NotContains(t, entries[1], "span_id")
+	assert.NotContains(t, entries[2], "span_id")
+}
+
+// TestLoggerWithTraceIDFallback tests that the trace ID comes from the given function,
+// falling back to the logger's own.
+func TestLoggerWithTraceIDFallback(t *testing.T) {
+	var buf bytes.Buffer
+	base := New(&buf, slog.LevelDebug, "test-service", mockTraceIDFn)
+
+	type key struct{}
+	logger := base.WithTraceID(func(ctx context.Context) string {
+		v, _ := ctx.Value(key{}).(string)
+		return v
+	})
+
+	logger.Info(context.WithValue(context.Background(), key{}, "req-1"), "in request")
+	logger.Info(context.Background(), "outside request")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Len(t, lines, 2)
+
+	var entries []map[string]any
+	for _, line := range lines {
+		var e map[string]any
+		assert.NoError(t, json.Unmarshal([]byte(line), &e))
+		entries = append(entries, e)
+	}
+
+	assert.Equal(t, "req-1", entries[0]["trace_id"])
+	assert.Equal(t, "test-trace-id", entries[1]["trace_id"])
+}
@@ -0,0 +1,75 @@
+package tracing
+
+import (
+	"context"
+	"sync"
+
+	"github.com/jwbonnell/go-libs/pkg/logx"
+)
+
+// InMemoryExporter keeps ended spans in memory, mainly for tests.
+type InMemoryExporter struct {
+	mu    sync.Mutex
+	spans []SpanData
+}
+
+// NewInMemoryExporter creates an empty InMemoryExporter.
+func NewInMemoryExporter() *InMemoryExporter {
+	return &InMemoryExporter{}
+}
+
+// ExportSpan stores span.
+func (e *InMemoryExporter) ExportSpan(_ context.Context, span SpanData) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, span)
+}
+
+// Spans returns the spans exported so far, in the order they ended.
+func (e *InMemoryExporter) Spans() []SpanData {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]SpanData(nil), e.spans...)
+}
+
+// Reset discards the stored spans.
+func (e *InMemoryExporter) Reset() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = nil
+}
+
+// LogExporter writes each ended span to a logx.Logger at debug level.
+type LogExporter struct {
+	log *logx.Logger
+}
+
+// NewLogExporter creates a LogExporter writing to log.
+func NewLogExporter(log *logx.Logger) *LogExporter {
+	return &LogExporter{log: log}
+}
+
+// ExportSpan logs span with its identity, timing, status and attributes. The
+// IDs use the keys trace, span and parent so they don't clash with the
+// trace_id the logger may add itself.
+func (e *LogExporter) ExportSpan(ctx context.Context, span SpanData) {
+	args := []any{
+		"name", span.Name,
+		"trace", span.SpanContext.TraceID.String(),
+		"span", span.SpanContext.SpanID.String(),
+		"kind", span.Kind.String(),
+		"duration", span.EndTime.Sub(span.StartTime),
+		"status", span.Status.String(),
+	}
+	if span.Parent.IsValid() {
+		args = append(args, "parent", span.Parent.String())
+	}
+	if span.StatusMessage != "" {
+		args = append(args, "status_message", span.StatusMessage)
+	}
+	for k, v := range span.Attributes {
+		args = append(args, "attr."+k, v)
+	}
+
+	e.log.Debug(ctx, "tracing: span", args...)
+}
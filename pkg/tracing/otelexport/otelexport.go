@@ -0,0 +1,200 @@
+// Package otelexport sends spans recorded with package tracing to
+// OpenTelemetry exporters, such as the OTLP exporters in
+// go.opentelemetry.io/otel/exporters, so they reach any OpenTelemetry
+// compatible backend.
+//
+//	otlp, err := otlptracehttp.New(ctx)
+//	if err != nil {
+//		return err
+//	}
+//	exp := otelexport.New(otlp)
+//	defer exp.Shutdown(context.Background())
+//
+//	tracer := tracing.NewTracer("orders", exp)
+package otelexport
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/jwbonnell/go-libs/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/instrumentation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ScopeName is the instrumentation scope recorded on exported spans.
+const ScopeName = "github.com/jwbonnell/go-libs/pkg/tracing"
+
+// serviceNameKey is the attribute tracing.Tracer records its name under. It
+// is moved to the span's resource, where OpenTelemetry expects it.
+const serviceNameKey = "service.name"
+
+// Exporter is a tracing.Exporter handing spans to an OpenTelemetry span
+// processor.
+type Exporter struct {
+	processor sdktrace.SpanProcessor
+}
+
+// New returns an Exporter batching spans to exp with an OpenTelemetry batch
+// span processor configured by opts. Call Shutdown before the program exits
+// to send the spans still queued.
+func New(exp sdktrace.SpanExporter, opts ...sdktrace.BatchSpanProcessorOption) *Exporter {
+	return NewWithProcessor(sdktrace.NewBatchSpanProcessor(exp, opts...))
+}
+
+// NewWithProcessor returns an Exporter handing every ended span to p, e.g.
+// sdktrace.NewSimpleSpanProcessor in tests.
+func NewWithProcessor(p sdktrace.SpanProcessor) *Exporter {
+	return &Exporter{processor: p}
+}
+
+// ExportSpan converts span and passes it to the span processor.
+func (e *Exporter) ExportSpan(_ context.Context, span tracing.SpanData) {
+	e.processor.OnEnd(Convert(span))
+}
+
+// ForceFlush exports the spans queued by the span processor.
+func (e *Exporter) ForceFlush(ctx context.Context) error {
+	return e.processor.ForceFlush(ctx)
+}
+
+// Shutdown flushes the queued spans and shuts the span processor and its
+// exporter down. Spans ended afterwards are dropped.
+func (e *Exporter) Shutdown(ctx context.Context) error {
+	return e.processor.Shutdown(ctx)
+}
+
+// Convert returns span as an OpenTelemetry read-only span.
+func Convert(span tracing.SpanData) sdktrace.ReadOnlySpan {
+	sc := spanContext(span.SpanContext.TraceID, span.SpanContext.SpanID, span.SpanContext.Sampled, false)
+
+	stub := tracetest.SpanStub{
+		Name:                 span.Name,
+		SpanContext:          sc,
+		SpanKind:             spanKind(span.Kind),
+		StartTime:            span.StartTime,
+		EndTime:              span.EndTime,
+		Status:               status(span.Status, span.StatusMessage),
+		InstrumentationScope: instrumentation.Scope{Name: ScopeName},
+		Resource:             resource.Empty(),
+	}
+	if span.Parent.IsValid() {
+		stub.Parent = spanContext(span.SpanContext.TraceID, span.Parent, span.SpanContext.Sampled, true)
+	}
+
+	attrs := make(map[string]any, len(span.Attributes))
+	for k, v := range span.Attributes {
+		if k == serviceNameKey {
+			stub.Resource = resource.NewSchemaless(attribute.String(serviceNameKey, fmt.Sprint(v)))
+			continue
+		}
+		attrs[k] = v
+	}
+	stub.Attributes = attributes(attrs)
+
+	for _, ev := range span.Events {
+		stub.Events = append(stub.Events, sdktrace.Event{
+			Name:       ev.Name,
+			Time:       ev.Time,
+			Attributes: attributes(ev.Attributes),
+		})
+	}
+
+	return stub.Snapshot()
+}
+
+func spanContext(traceID tracing.TraceID, spanID tracing.SpanID, sampled, remote bool) trace.SpanContext {
+	var flags trace.TraceFlags
+	if sampled {
+		flags = trace.FlagsSampled
+	}
+	return trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID(traceID),
+		SpanID:     trace.SpanID(spanID),
+		TraceFlags: flags,
+		Remote:     remote,
+	})
+}
+
+func spanKind(k tracing.SpanKind) trace.SpanKind {
+	switch k {
+	case tracing.SpanKindServer:
+		return trace.SpanKindServer
+	case tracing.SpanKindClient:
+		return trace.SpanKindClient
+	default:
+		return trace.SpanKindInternal
+	}
+}
+
+func status(c tracing.StatusCode, msg string) sdktrace.Status {
+	switch c {
+	case tracing.StatusOK:
+		return sdktrace.Status{Code: codes.Ok}
+	case tracing.StatusError:
+		return sdktrace.Status{Code: codes.Error, Description: msg}
+	default:
+		return sdktrace.Status{Code: codes.Unset}
+	}
+}
+
+// attributes converts m to key/values sorted by key. Values of types
+// OpenTelemetry has no attribute type for are formatted with fmt.Sprint.
+func attributes(m map[string]any) []attribute.KeyValue {
+	if len(m) == 0 {
+		return nil
+	}
+
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+
+	kvs := make([]attribute.KeyValue, 0, len(keys))
+	for _, k := range keys {
+		kvs = append(kvs, attributeValue(k, m[k]))
+	}
+	return kvs
+}
+
+func attributeValue(k string, v any) attribute.KeyValue {
+	switch v := v.(type) {
+	case string:
+		return attribute.String(k, v)
+	case bool:
+		return attribute.Bool(k, v)
+	case int:
+		return attribute.Int(k, v)
+	case int32:
+		return attribute.Int64(k, int64(v))
+	case int64:
+		return attribute.Int64(k, v)
+	case uint32:
+		return attribute.Int64(k, int64(v))
+	case float32:
+		return attribute.Float64(k, float64(v))
+	case float64:
+		return attribute.Float64(k, v)
+	case []string:
+		return attribute.StringSlice(k, v)
+	case []bool:
+		return attribute.BoolSlice(k, v)
+	case []int:
+		return attribute.IntSlice(k, v)
+	case []int64:
+		return attribute.Int64Slice(k, v)
+	case []float64:
+		return attribute.Float64Slice(k, v)
+	case fmt.Stringer:
+		return attribute.String(k, v.String())
+	default:
+		return attribute.String(k, fmt.Sprint(v))
+	}
+}
@@ -0,0 +1,74 @@
+package otelexport
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jwbonnell/go-libs/pkg/tracing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestExporter_ConvertsSpans(t *testing.T) {
+	otel := tracetest.NewInMemoryExporter()
+	exp := NewWithProcessor(sdktrace.NewSimpleSpanProcessor(otel))
+	tracer := tracing.NewTracer("orders", exp)
+
+	ctx, root := tracer.Start(context.Background(), "GET /orders", tracing.WithKind(tracing.SpanKindServer))
+	_, child := tracer.Start(ctx, "SELECT", tracing.WithKind(tracing.SpanKindClient),
+		tracing.WithAttributes("db.query.text", "SELECT 1", "db.response.returned_rows", int64(1)))
+	child.RecordError(errors.New("canceled"))
+	child.End()
+	root.End()
+
+	spans := otel.GetSpans()
+	require.Len(t, spans, 2)
+	c, r := spans[0], spans[1]
+
+	assert.Equal(t, "GET /orders", r.Name)
+	assert.Equal(t, trace.SpanKindServer, r.SpanKind)
+	assert.Equal(t, trace.TraceID(root.SpanContext().TraceID), r.SpanContext.TraceID())
+	assert.Equal(t, trace.SpanID(root.SpanContext().SpanID), r.SpanContext.SpanID())
+	assert.True(t, r.SpanContext.IsSampled())
+	assert.False(t, r.Parent.IsValid())
+	assert.Empty(t, r.Attributes)
+	assert.Equal(t, codes.Unset, r.Status.Code)
+	assert.Equal(t, ScopeName, r.InstrumentationScope.Name)
+	name, ok := r.Resource.Set().Value("service.name")
+	require.True(t, ok)
+	assert.Equal(t, "orders", name.AsString())
+
+	assert.Equal(t, trace.SpanKindClient, c.SpanKind)
+	assert.Equal(t, r.SpanContext.TraceID(), c.Parent.TraceID())
+	assert.Equal(t, r.SpanContext.SpanID(), c.Parent.SpanID())
+	assert.Equal(t, []attribute.KeyValue{
+		attribute.String("db.query.text", "SELECT 1"),
+		attribute.Int64("db.response.returned_rows", 1),
+	}, c.Attributes)
+	assert.Equal(t, sdktrace.Status{Code: codes.Error, Description: "canceled"}, c.Status)
+	require.Len(t, c.Events, 1)
+	assert.Equal(t, "exception", c.Events[0].Name)
+	assert.Equal(t, []attribute.KeyValue{attribute.String("exception.message", "canceled")}, c.Events[0].Attributes)
+}
+
+func TestExporter_BatchesUntilShutdown(t *testing.T) {
+	otel := tracetest.NewInMemoryExporter()
+	exp := New(otel)
+	tracer := tracing.NewTracer("orders", exp)
+
+	_, span := tracer.Start(context.Background(), "job")
+	span.End()
+	require.NoError(t, exp.ForceFlush(context.Background()))
+	assert.Len(t, otel.GetSpans(), 1)
+
+	// Shutdown also shuts down the OpenTelemetry exporter, which forgets its
+	// spans.
+	require.NoError(t, exp.Shutdown(context.Background()))
+	assert.Empty(t, otel.GetSpans())
+}
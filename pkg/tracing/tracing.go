@@ -0,0 +1,413 @@
+// Package tracing provides lightweight distributed tracing compatible with the
+// W3C Trace Context format used by OpenTelemetry. Spans are created with a
+// Tracer, carried in a context.Context and handed to a pluggable Exporter when
+// they end. Package otelexport provides an Exporter feeding OpenTelemetry span
+// exporters, such as OTLP.
+//
+// Every method is safe to call on a nil *Tracer or *Span, which makes tracing
+// optional for instrumented code: with no tracer configured nothing is
+// recorded.
+package tracing
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TraceID identifies a trace.
+type TraceID [16]byte
+
+// IsValid reports whether the ID is not all zeros.
+func (id TraceID) IsValid() bool { return id != TraceID{} }
+
+// String returns the ID as 32 lowercase hex characters.
+func (id TraceID) String() string { return hex.EncodeToString(id[:]) }
+
+// SpanID identifies a span within a trace.
+type SpanID [8]byte
+
+// IsValid reports whether the ID is not all zeros.
+func (id SpanID) IsValid() bool { return id != SpanID{} }
+
+// String returns the ID as 16 lowercase hex characters.
+func (id SpanID) String() string { return hex.EncodeToString(id[:]) }
+
+// SpanContext is the part of a span that propagates across process boundaries.
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+	Remote  bool
+}
+
+// IsValid reports whether both IDs are set.
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+// Traceparent formats sc as a W3C traceparent header value.
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return fmt.Sprintf("00-%s-%s-%s", sc.TraceID, sc.SpanID, flags)
+}
+
+// ParseTraceparent parses a W3C traceparent header value. Future versions of
+// the format are accepted as long as they start with the version 00 fields.
+func ParseTraceparent(h string) (SpanContext, bool) {
+	parts := strings.Split(strings.TrimSpace(h), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return SpanContext{}, false
+	}
+	if parts[0] == "00" && len(parts) != 4 {
+		return SpanContext{}, false
+	}
+	if !isLowerHex(parts[0]) || !isLowerHex(parts[1]) || !isLowerHex(parts[2]) || !isLowerHex(parts[3]) {
+		return SpanContext{}, false
+	}
+
+	var sc SpanContext
+	var flags [1]byte
+	if len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return SpanContext{}, false
+	}
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil {
+		return SpanContext{}, false
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil {
+		return SpanContext{}, false
+	}
+	if _, err := hex.Decode(flags[:], []byte(parts[3])); err != nil {
+		return SpanContext{}, false
+	}
+	sc.Sampled = flags[0]&1 == 1
+	sc.Remote = true
+
+	if !sc.IsValid() {
+		return SpanContext{}, false
+	}
+	return sc, true
+}
+
+func isLowerHex(s string) bool {
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// SpanKind describes the relationship between a span and its peers.
+type SpanKind int
+
+const (
+	SpanKindInternal SpanKind = iota
+	SpanKindServer
+	SpanKindClient
+)
+
+func (k SpanKind) String() string {
+	switch k {
+	case SpanKindServer:
+		return "server"
+	case SpanKindClient:
+		return "client"
+	default:
+		return "internal"
+	}
+}
+
+// StatusCode is the outcome of the operation a span describes.
+type StatusCode int
+
+const (
+	StatusUnset StatusCode = iota
+	StatusOK
+	StatusError
+)
+
+func (c StatusCode) String() string {
+	switch c {
+	case StatusOK:
+		return "ok"
+	case StatusError:
+		return "error"
+	default:
+		return "unset"
+	}
+}
+
+// Event is a timestamped annotation on a span.
+type Event struct {
+	Name       string
+	Time       time.Time
+	Attributes map[string]any
+}
+
+// SpanData is the immutable record of an ended span handed to an Exporter.
+type SpanData struct {
+	Name          string
+	SpanContext   SpanContext
+	Parent        SpanID
+	Kind          SpanKind
+	StartTime     time.Time
+	EndTime       time.Time
+	Attributes    map[string]any
+	Events        []Event
+	Status        StatusCode
+	StatusMessage string
+}
+
+// Exporter receives spans as they end. Implementations must be safe for
+// concurrent use.
+type Exporter interface {
+	ExportSpan(ctx context.Context, span SpanData)
+}
+
+// Tracer creates spans and sends the sampled ones to its exporter.
+type Tracer struct {
+	name     string
+	exporter Exporter
+}
+
+// NewTracer creates a Tracer. name identifies the instrumented service and is
+// recorded on every span as the "service.name" attribute.
+func NewTracer(name string, exporter Exporter) *Tracer {
+	return &Tracer{name: name, exporter: exporter}
+}
+
+// StartOption configures a span at start.
+type StartOption func(*Span)
+
+// WithKind sets the kind of the span. The default is SpanKindInternal.
+func WithKind(kind SpanKind) StartOption {
+	return func(s *Span) { s.data.Kind = kind }
+}
+
+// WithAttributes sets attributes on the span from alternating key/value pairs.
+func WithAttributes(kv ...any) StartOption {
+	return func(s *Span) { s.setAttributes(kv) }
+}
+
+// Start begins a span named name as a child of the span (or remote span
+// context) in ctx, or as the root of a new trace. The returned context
+// carries the new span. On a nil Tracer it returns ctx and a nil Span.
+func (t *Tracer) Start(ctx context.Context, name string, opts ...StartOption) (context.Context, *Span) {
+	if t == nil {
+		return ctx, nil
+	}
+
+	parent := SpanContextFromContext(ctx)
+	sc := SpanContext{TraceID: parent.TraceID, SpanID: newSpanID(), Sampled: true}
+	if parent.IsValid() {
+		sc.Sampled = parent.Sampled
+	} else {
+		sc.TraceID = newTraceID()
+	}
+
+	s := &Span{
+		tracer: t,
+		data: SpanData{
+			Name:        name,
+			SpanContext: sc,
+			Parent:      parent.SpanID,
+			StartTime:   time.Now(),
+			Attributes:  map[string]any{"service.name": t.name},
+		},
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+// Span is an operation in progress. It is safe for concurrent use.
+type Span struct {
+	tracer *Tracer
+
+	mu    sync.Mutex
+	data  SpanData
+	ended bool
+}
+
+// SpanContext returns the propagation identity of the span.
+func (s *Span) SpanContext() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.data.SpanContext
+}
+
+// SetName replaces the span name.
+func (s *Span) SetName(name string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Name = name
+}
+
+// SetAttributes sets attributes from alternating key/value pairs.
+func (s *Span) SetAttributes(kv ...any) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.setAttributes(kv)
+}
+
+func (s *Span) setAttributes(kv []any) {
+	for i := 0; i+1 < len(kv); i += 2 {
+		key, ok := kv[i].(string)
+		if !ok {
+			key = fmt.Sprint(kv[i])
+		}
+		s.data.Attributes[key] = kv[i+1]
+	}
+}
+
+// AddEvent records a named event with attributes from alternating key/value
+// pairs.
+func (s *Span) AddEvent(name string, kv ...any) {
+	if s == nil {
+		return
+	}
+	e := Event{Name: name, Time: time.Now(), Attributes: map[string]any{}}
+	for i := 0; i+1 < len(kv); i += 2 {
+		e.Attributes[fmt.Sprint(kv[i])] = kv[i+1]
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Events = append(s.data.Events, e)
+}
+
+// RecordError records err as an "exception" event and marks the span as
+// failed. A nil err is ignored.
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.AddEvent("exception", "exception.message", err.Error())
+	s.SetStatus(StatusError, err.Error())
+}
+
+// SetStatus sets the outcome of the span.
+func (s *Span) SetStatus(code StatusCode, msg string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Status = code
+	s.data.StatusMessage = msg
+}
+
+// End finishes the span and exports it if it is sampled. Calls after the
+// first are ignored.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.EndTime = time.Now()
+	data := s.data
+	data.Attributes = make(map[string]any, len(s.data.Attributes))
+	for k, v := range s.data.Attributes {
+		data.Attributes[k] = v
+	}
+	data.Events = append([]Event(nil), s.data.Events...)
+	s.mu.Unlock()
+
+	if data.SpanContext.Sampled && s.tracer.exporter != nil {
+		s.tracer.exporter.ExportSpan(context.Background(), data)
+	}
+}
+
+type spanKey struct{}
+type remoteKey struct{}
+
+// SpanFromContext returns the span carried by ctx, or nil.
+func SpanFromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanKey{}).(*Span)
+	return s
+}
+
+// ContextWithRemoteSpanContext returns a copy of ctx whose next span will be
+// a child of sc, typically extracted from an inbound request with
+// ParseTraceparent.
+func ContextWithRemoteSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, remoteKey{}, sc)
+}
+
+// SpanContextFromContext returns the span context of the span in ctx, or the
+// remote span context stored with ContextWithRemoteSpanContext.
+func SpanContextFromContext(ctx context.Context) SpanContext {
+	if s := SpanFromContext(ctx); s != nil {
+		return s.SpanContext()
+	}
+	sc, _ := ctx.Value(remoteKey{}).(SpanContext)
+	return sc
+}
+
+// TraceIDFromContext returns the hex trace ID of the span in ctx, or an empty
+// string. Its signature matches logx.TraceIDFn.
+func TraceIDFromContext(ctx context.Context) string {
+	sc := SpanContextFromContext(ctx)
+	if !sc.TraceID.IsValid() {
+		return ""
+	}
+	return sc.TraceID.String()
+}
+
+// LogAttrs returns the span_id of the span in ctx as logx key/value pairs, for
+// use with logx.Logger.WithContextAttrs. The trace ID is left to the logger's
+// TraceIDFn.
+func LogAttrs(ctx context.Context) []any {
+	s := SpanFromContext(ctx)
+	if s == nil {
+		return nil
+	}
+	return []any{"span_id", s.SpanContext().SpanID.String()}
+}
+
+func newTraceID() TraceID {
+	var id TraceID
+	for !id.IsValid() {
+		for i := 0; i < len(id); i += 8 {
+			putUint64(id[i:], rand.Uint64())
+		}
+	}
+	return id
+}
+
+func newSpanID() SpanID {
+	var id SpanID
+	for !id.IsValid() {
+		putUint64(id[:], rand.Uint64())
+	}
+	return id
+}
+
+func putUint64(b []byte, v uint64) {
+	for i := 0; i < 8; i++ {
+		b[i] = byte(v >> (56 - 8*i))
+	}
+}
@@ -0,0 +1,207 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"sync"
+	"testing"
+
+	"github.com/jwbonnell/go-libs/pkg/logx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  string
+		ok      bool
+		sampled bool
+	}{
+		{"sampled", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", true, true},
+		{"not sampled", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", true, false},
+		{"future version", "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", true, true},
+		{"version 00 with extra field", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", false, false},
+		{"invalid version", "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", false, false},
+		{"uppercase", "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", false, false},
+		{"zero trace id", "00-00000000000000000000000000000000-00f067aa0ba902b7-01", false, false},
+		{"zero span id", "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", false, false},
+		{"short trace id", "00-4bf92f3577b34da6-00f067aa0ba902b7-01", false, false},
+		{"empty", "", false, false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			sc, ok := ParseTraceparent(tc.header)
+			require.Equal(t, tc.ok, ok)
+			if !ok {
+				return
+			}
+			assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", sc.TraceID.String())
+			assert.Equal(t, "00f067aa0ba902b7", sc.SpanID.String())
+			assert.Equal(t, tc.sampled, sc.Sampled)
+			assert.True(t, sc.Remote)
+		})
+	}
+}
+
+func TestTraceparent_RoundTrip(t *testing.T) {
+	h := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	sc, ok := ParseTraceparent(h)
+	require.True(t, ok)
+	assert.Equal(t, h, sc.Traceparent())
+}
+
+func TestStart_RootAndChildren(t *testing.T) {
+	exp := NewInMemoryExporter()
+	tracer := NewTracer("svc", exp)
+
+	ctx, root := tracer.Start(context.Background(), "root", WithKind(SpanKindServer), WithAttributes("a", 1))
+	_, child := tracer.Start(ctx, "child")
+	child.SetAttributes("b", "two")
+	child.AddEvent("cache miss", "key", "k1")
+	child.End()
+	root.End()
+	root.End()
+
+	spans := exp.Spans()
+	require.Len(t, spans, 2)
+	c, r := spans[0], spans[1]
+
+	assert.Equal(t, "root", r.Name)
+	assert.Equal(t, SpanKindServer, r.Kind)
+	assert.False(t, r.Parent.IsValid())
+	assert.Equal(t, map[string]any{"service.name": "svc", "a": 1}, r.Attributes)
+	assert.False(t, r.EndTime.Before(r.StartTime))
+
+	assert.Equal(t, "child", c.Name)
+	assert.Equal(t, r.SpanContext.TraceID, c.SpanContext.TraceID)
+	assert.Equal(t, r.SpanContext.SpanID, c.Parent)
+	assert.NotEqual(t, r.SpanContext.SpanID, c.SpanContext.SpanID)
+	assert.Equal(t, "two", c.Attributes["b"])
+	require.Len(t, c.Events, 1)
+	assert.Equal(t, "k1", c.Events[0].Attributes["key"])
+
+	exp.Reset()
+	assert.Empty(t, exp.Spans())
+}
+
+func TestStart_ContinuesRemoteParent(t *testing.T) {
+	exp := NewInMemoryExporter()
+	tracer := NewTracer("svc", exp)
+
+	remote, ok := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	require.True(t, ok)
+
+	ctx := ContextWithRemoteSpanContext(context.Background(), remote)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", TraceIDFromContext(ctx))
+
+	_, span := tracer.Start(ctx, "server")
+	span.End()
+
+	spans := exp.Spans()
+	require.Len(t, spans, 1)
+	assert.Equal(t, remote.TraceID, spans[0].SpanContext.TraceID)
+	assert.Equal(t, remote.SpanID, spans[0].Parent)
+	assert.False(t, spans[0].SpanContext.Remote)
+}
+
+func TestStart_UnsampledParentIsNotExported(t *testing.T) {
+	exp := NewInMemoryExporter()
+	tracer := NewTracer("svc", exp)
+
+	remote, ok := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	require.True(t, ok)
+
+	ctx, span := tracer.Start(ContextWithRemoteSpanContext(context.Background(), remote), "server")
+	_, child := tracer.Start(ctx, "child")
+	child.End()
+	span.End()
+
+	assert.False(t, span.SpanContext().Sampled)
+	assert.Empty(t, exp.Spans())
+}
+
+func TestSpan_RecordError(t *testing.T) {
+	exp := NewInMemoryExporter()
+	_, span := NewTracer("svc", exp).Start(context.Background(), "op")
+
+	span.RecordError(nil)
+	span.RecordError(errors.New("boom"))
+	span.End()
+
+	got := exp.Spans()[0]
+	assert.Equal(t, StatusError, got.Status)
+	assert.Equal(t, "boom", got.StatusMessage)
+	require.Len(t, got.Events, 1)
+	assert.Equal(t, "exception", got.Events[0].Name)
+}
+
+func TestNilTracerAndSpan(t *testing.T) {
+	var tracer *Tracer
+	ctx, span := tracer.Start(context.Background(), "op")
+	assert.Nil(t, span)
+	assert.Nil(t, SpanFromContext(ctx))
+
+	span.SetAttributes("k", "v")
+	span.SetName("x")
+	span.RecordError(errors.New("ignored"))
+	span.End()
+	assert.False(t, span.SpanContext().IsValid())
+	assert.Empty(t, TraceIDFromContext(ctx))
+	assert.Nil(t, LogAttrs(ctx))
+}
+
+func TestSpan_ConcurrentUse(t *testing.T) {
+	exp := NewInMemoryExporter()
+	ctx, root := NewTracer("svc", exp).Start(context.Background(), "root")
+	tracer := NewTracer("svc", exp)
+
+	var wg sync.WaitGroup
+	for i := range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			root.SetAttributes("k", i)
+			_, child := tracer.Start(ctx, "child")
+			child.End()
+		}()
+	}
+	wg.Wait()
+	root.End()
+
+	assert.Len(t, exp.Spans(), 11)
+}
+
+func TestLogAttrs_StampsLogRecords(t *testing.T) {
+	var buf bytes.Buffer
+	log := logx.New(&buf, slog.LevelDebug, "svc", TraceIDFromContext).WithContextAttrs(LogAttrs)
+
+	ctx, span := NewTracer("svc", nil).Start(context.Background(), "op")
+	log.Info(ctx, "hello")
+	span.End()
+
+	var entry map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+	assert.Equal(t, span.SpanContext().TraceID.String(), entry["trace_id"])
+	assert.Equal(t, span.SpanContext().SpanID.String(), entry["span_id"])
+}
+
+func TestLogExporter(t *testing.T) {
+	var buf bytes.Buffer
+	log := logx.New(&buf, slog.LevelDebug, "svc", nil)
+
+	ctx, root := NewTracer("svc", NewLogExporter(log)).Start(context.Background(), "root")
+	_, child := NewTracer("svc", NewLogExporter(log)).Start(ctx, "child", WithAttributes("db.operation.name", "SELECT"))
+	child.End()
+
+	var entry map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+	assert.Equal(t, "child", entry["name"])
+	assert.Equal(t, root.SpanContext().TraceID.String(), entry["trace"])
+	assert.Equal(t, root.SpanContext().SpanID.String(), entry["parent"])
+	assert.Equal(t, "SELECT", entry["attr.db.operation.name"])
+}
@@ -1,11 +1,17 @@
 package web
 
 import (
+	"cmp"
 	"fmt"
 	"net/http"
+	"sync/atomic"
+	"time"
 
 	"github.com/jwbonnell/go-libs/pkg/logx"
+	"github.com/jwbonnell/go-libs/pkg/tracing"
 	"github.com/jwbonnell/go-libs/pkg/web/httpx"
+	"github.com/jwbonnell/go-libs/pkg/web/middleware"
+	"github.com/jwbonnell/go-libs/pkg/web/websocket"
 )
 
 type App struct {
@@ -13,45 +19,131 @@ type App struct {
 	mux     *http.ServeMux
 	mw      []httpx.Middleware
 	origins []string
-}
+	cors    *middleware.CORSPolicy
+	secure  *middleware.SecureHeaders
+	tracer  *tracing.Tracer
+	wsOpts  websocket.Options
+	wsConns wsConns
+	routes  []RouteInfo
+
+	timeout     time.Duration
+	maxBodySize int64
 
-type AppConfig struct {
-	allowedOrigins []string
+	ready         atomic.Bool
+	shutdownHooks []ShutdownHook
 }
 
 func NewApp(log *logx.Logger, mw ...httpx.Middleware) *App {
 	return &App{
-		log: log,
-		mux: http.NewServeMux(),
-		mw:  mw,
+		log:    log,
+		mux:    http.NewServeMux(),
+		mw:     mw,
+		secure: middleware.NewSecureHeaders(hstsOnly),
 	}
 }
 
+// hstsOnly is the security header policy of a new App: two years of HSTS with
+// subdomains and preload over TLS, the only header Apps always sent. Opt in to
+// the others with WithSecureHeaders(middleware.DefaultSecureHeadersConfig()).
+var hstsOnly = middleware.SecureHeadersConfig{
+	HSTSMaxAge:            2 * 365 * 24 * time.Hour,
+	HSTSIncludeSubdomains: true,
+	HSTSPreload:           true,
+}
+
 func (a *App) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	// Max-age is set to 2 years, and is suffixed with
-	// preload, which is necessary for inclusion in all major web browsers' HSTS
-	// preload lists, like Chromium, Edge, and Firefox.
-	w.Header().Set("Strict-Transport-Security", "max-age=63072000; includeSubDomains; preload")
+	if a.secure != nil {
+		r = a.secure.Apply(w, r)
+	}
+
+	if a.cors != nil {
+		if middleware.IsPreflight(r) && a.hasRoute(r, r.Header.Get("Access-Control-Request-Method")) {
+			a.cors.Preflight(w, r)
+			return
+		}
+		a.cors.SetHeaders(w, r)
+	}
 
 	a.mux.ServeHTTP(w, r)
 }
 
 func (a *App) HandleFunc(method string, path string, handler httpx.HandlerFunc, mw ...httpx.Middleware) {
-	handler = httpx.Wrap(mw, handler)
+	a.handle(Route{Method: method, Path: path, Handler: handler, Mw: mw})
+}
+
+// handle registers rt, wrapped in its permission checks, its middleware, its
+// limits and the app's middleware.
+func (a *App) handle(rt Route) {
+	var mw []httpx.Middleware
+	if d := cmp.Or(rt.Timeout, a.timeout); d > 0 {
+		mw = append(mw, middleware.Timeout(d))
+	}
+	if n := cmp.Or(rt.MaxBodySize, a.maxBodySize); n > 0 {
+		mw = append(mw, middleware.MaxBodySize(n))
+	}
+	if rt.SecureHeaders != nil {
+		mw = append(mw, rt.SecureHeaders.Middleware())
+	}
+	mw = append(mw, rt.Mw...)
+	if len(rt.Roles) > 0 {
+		mw = append(mw, middleware.RequireRoles(rt.Roles...))
+	}
+	if len(rt.Scopes) > 0 {
+		mw = append(mw, middleware.RequireScopes(rt.Scopes...))
+	}
+	a.routes = append(a.routes, RouteInfo{Method: rt.Method, Path: rt.Path, Roles: rt.Roles, Scopes: rt.Scopes})
+
+	handler := httpx.Wrap(mw, rt.Handler)
 	handler = httpx.Wrap(a.mw, handler)
-	path = fmt.Sprintf("%s %s", method, path)
+	path := fmt.Sprintf("%s %s", rt.Method, rt.Path)
+	log := a.log.WithTraceID(httpx.TraceID)
 
 	h := func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
-		//ctx := setTracer(r.Context(), a.tracer)
-		//ctx = setWriter(ctx, w)
+		v := httpx.Values{
+			TraceID: traceIDFromRequest(r),
+			Now:     time.Now(),
+		}
+
+		var span *tracing.Span
+		if a.tracer != nil {
+			if parent, ok := tracing.ParseTraceparent(r.Header.Get(traceparentHeader)); ok {
+				ctx = tracing.ContextWithRemoteSpanContext(ctx, parent)
+			}
+			ctx, span = a.tracer.Start(ctx, path,
+				tracing.WithKind(tracing.SpanKindServer),
+				tracing.WithAttributes(
+					"http.request.method", r.Method,
+					"http.route", path,
+					"url.path", r.URL.Path,
+				),
+			)
+			defer span.End()
+
+			sc := span.SpanContext()
+			v.TraceID = sc.TraceID.String()
+			w.Header().Set(traceparentHeader, sc.Traceparent())
+		}
 
-		//otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(w.Header()))
+		ctx = httpx.SetValues(ctx, &v)
+		r = r.WithContext(ctx)
+		defer v.RunAfterResponse()
+		w.Header().Set(RequestIDHeader, v.TraceID)
 
 		resp := handler(w, r)
 
+		span.SetAttributes("http.response.status_code", resp.StatusCode)
+		// Client errors are the caller's fault, not a failure of the server.
+		if resp.StatusCode >= http.StatusInternalServerError || (resp.Err != nil && resp.StatusCode == 0) {
+			if resp.Err != nil {
+				span.RecordError(resp.Err)
+			} else {
+				span.SetStatus(tracing.StatusError, http.StatusText(resp.StatusCode))
+			}
+		}
+
 		if err := httpx.Respond(ctx, w, resp); err != nil {
-			a.log.Info(ctx, "web-respond", "ERROR", err)
+			log.Info(ctx, "web-respond", "ERROR", err)
 			return
 		}
 	}
@@ -59,11 +151,56 @@ func (a *App) HandleFunc(method string, path string, handler httpx.HandlerFunc,
 	a.mux.HandleFunc(path, h)
 }
 
+// WithCORS allows cross-origin requests from origins with the default
+// methods and headers of middleware.CORSConfig, see WithCORSPolicy.
 func (a *App) WithCORS(origins ...string) {
-	a.origins = origins
+	a.WithCORSPolicy(middleware.CORSConfig{AllowedOrigins: origins})
+}
+
+// WithCORSPolicy applies the CORS policy for cfg to every route, including
+// mounted handlers. Preflight requests for a registered route and method are
+// answered with 204 No Content before routing, so they skip the middleware;
+// preflights for unknown routes get the usual 404 or 405.
+func (a *App) WithCORSPolicy(cfg middleware.CORSConfig) {
+	a.origins = cfg.AllowedOrigins
+	a.cors = middleware.NewCORSPolicy(cfg)
+}
+
+// hasRoute reports whether a request like r but with method would be routed
+// to a registered handler.
+func (a *App) hasRoute(r *http.Request, method string) bool {
+	r2 := r.Clone(r.Context())
+	r2.Method = method
+	_, pattern := a.mux.Handler(r2)
+	return pattern != ""
+}
+
+// WithSecureHeaders replaces the security headers sent with every response,
+// only Strict-Transport-Security over TLS unless configured, with the policy
+// for cfg, e.g. middleware.DefaultSecureHeadersConfig. Routes override it
+// with Route.SecureHeaders or the Middleware of another policy.
+func (a *App) WithSecureHeaders(cfg middleware.SecureHeadersConfig) {
+	a.secure = middleware.NewSecureHeaders(cfg)
+}
+
+// WithTimeout gives the requests of every route registered afterwards a
+// deadline d from when the route's middleware starts, see middleware.Timeout.
+// Routes override it with Route.Timeout; WebSocket routes are exempt.
+func (a *App) WithTimeout(d time.Duration) {
+	a.timeout = d
+}
+
+// WithMaxBodySize limits the request bodies of every route registered
+// afterwards to n bytes, see middleware.MaxBodySize. Routes override it with
+// Route.MaxBodySize.
+func (a *App) WithMaxBodySize(n int64) {
+	a.maxBodySize = n
 }
 
-/*func (a *App) WithTracing(tracer Tracer) {
+// WithTracing starts a server span named after the route pattern for every
+// request, continuing the trace of an inbound W3C traceparent header. The
+// span's context is returned to the client in the traceparent header and its
+// trace ID becomes the request's trace ID.
+func (a *App) WithTracing(tracer *tracing.Tracer) {
 	a.tracer = tracer
 }
-*/
@@ -1,12 +1,22 @@
 package web
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/jwbonnell/go-libs/pkg/logx"
 	"github.com/jwbonnell/go-libs/pkg/web/httpx"
+	"github.com/jwbonnell/go-libs/pkg/web/middleware"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -25,7 +35,7 @@ func TestNewApp_Defaults(t *testing.T) {
 	assert.Empty(t, app.mw)
 }
 
-func TestServeHTTP_HSTSHeaderAndDelegate(t *testing.T) {
+func TestServeHTTP_HSTSOnlyByDefaultAndDelegate(t *testing.T) {
 	logger := testLogger(t)
 	app := NewApp(logger)
 
@@ -34,14 +44,40 @@ func TestServeHTTP_HSTSHeaderAndDelegate(t *testing.T) {
 		return httpx.PlainTextResponse(http.StatusOK, "pong")
 	})
 
-	req := httptest.NewRequest("GET", "http://example.test/ping", nil)
+	req := httptest.NewRequest("GET", "https://example.test/ping", nil)
 	rr := httptest.NewRecorder()
 
 	app.ServeHTTP(rr, req)
 
 	assert.Equal(t, "max-age=63072000; includeSubDomains; preload", rr.Header().Get("Strict-Transport-Security"))
+	assert.Empty(t, rr.Header().Get("X-Content-Type-Options"))
+	assert.Empty(t, rr.Header().Get("X-Frame-Options"))
+	assert.Empty(t, rr.Header().Get("Referrer-Policy"))
+	assert.Empty(t, rr.Header().Get("Cross-Origin-Opener-Policy"))
+	assert.Empty(t, rr.Header().Get("Content-Security-Policy"))
 	assert.Equal(t, http.StatusOK, rr.Code)
 	assert.Equal(t, "pong", rr.Body.String())
+
+	// Plain-HTTP servers, such as development servers, don't get HSTS.
+	rr = serve(app, "GET", "http://example.test/ping")
+	assert.Empty(t, rr.Header().Get("Strict-Transport-Security"))
+	assert.Equal(t, "pong", rr.Body.String())
+}
+
+func TestWithSecureHeaders_Defaults(t *testing.T) {
+	app := NewApp(testLogger(t))
+	app.WithSecureHeaders(middleware.DefaultSecureHeadersConfig())
+	app.HandleFunc("GET", "/ping", func(w http.ResponseWriter, r *http.Request) httpx.Response {
+		return httpx.PlainTextResponse(http.StatusOK, "pong")
+	})
+
+	rr := serve(app, "GET", "https://example.test/ping")
+	assert.Equal(t, "max-age=63072000; includeSubDomains; preload", rr.Header().Get("Strict-Transport-Security"))
+	assert.Equal(t, "nosniff", rr.Header().Get("X-Content-Type-Options"))
+	assert.Equal(t, "DENY", rr.Header().Get("X-Frame-Options"))
+	assert.Equal(t, "strict-origin-when-cross-origin", rr.Header().Get("Referrer-Policy"))
+	assert.Equal(t, "same-origin", rr.Header().Get("Cross-Origin-Opener-Policy"))
+	assert.Empty(t, rr.Header().Get("Content-Security-Policy"))
 }
 
 func TestHandleFunc_MiddlewareOrderAndRespondCalled(t *testing.T) {
@@ -96,6 +132,51 @@ func TestHandleFunc_MiddlewareOrderAndRespondCalled(t *testing.T) {
 	assert.Equal(t, "ARH", rr.Body.String())
 }
 
+func TestWithCORSPolicy_PreflightAndActualRequests(t *testing.T) {
+	logger := testLogger(t)
+	var calls int
+	auth := func(next httpx.HandlerFunc) httpx.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) httpx.Response {
+			calls++
+			return next(w, r)
+		}
+	}
+	app := NewApp(logger, auth)
+	app.WithCORSPolicy(middleware.CORSConfig{AllowedOrigins: []string{"https://*.example.com"}})
+	app.HandleFunc("PUT", "/items/{id}", func(w http.ResponseWriter, r *http.Request) httpx.Response {
+		return httpx.PlainTextResponse(http.StatusOK, "saved")
+	})
+
+	preflight := func(method, target string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("OPTIONS", target, nil)
+		req.Header.Set("Origin", "https://app.example.com")
+		req.Header.Set("Access-Control-Request-Method", method)
+		rr := httptest.NewRecorder()
+		app.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// Preflights for registered routes are answered before any middleware.
+	rr := preflight("PUT", "/items/1")
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+	assert.Equal(t, "https://app.example.com", rr.Header().Get("Access-Control-Allow-Origin"))
+	assert.Contains(t, rr.Header().Get("Access-Control-Allow-Methods"), "PUT")
+	assert.Zero(t, calls)
+
+	// Unknown routes and methods are left to the mux.
+	assert.Equal(t, http.StatusNotFound, preflight("PUT", "/nope").Code)
+	assert.Equal(t, http.StatusMethodNotAllowed, preflight("DELETE", "/items/1").Code)
+
+	req := httptest.NewRequest("PUT", "/items/1", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	rr = httptest.NewRecorder()
+	app.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "https://app.example.com", rr.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "Origin", rr.Header().Get("Vary"))
+	assert.Equal(t, 1, calls)
+}
+
 func TestWithCORS_SetsOrigins(t *testing.T) {
 	logger := testLogger(t)
 	app := NewApp(logger)
@@ -104,6 +185,25 @@ func TestWithCORS_SetsOrigins(t *testing.T) {
 	assert.Equal(t, []string{"https://example.com", "https://foo.test"}, app.origins)
 }
 
+func TestWithCORS_AllowsOrigins(t *testing.T) {
+	app := NewApp(testLogger(t))
+	app.WithCORS("https://app.example.com")
+	app.HandleFunc("GET", "/items", func(w http.ResponseWriter, r *http.Request) httpx.Response {
+		return httpx.PlainTextResponse(http.StatusOK, "ok")
+	})
+
+	for origin, want := range map[string]string{
+		"https://app.example.com":  "https://app.example.com",
+		"https://evil.example.com": "",
+	} {
+		req := httptest.NewRequest("GET", "/items", nil)
+		req.Header.Set("Origin", origin)
+		rr := httptest.NewRecorder()
+		app.ServeHTTP(rr, req)
+		assert.Equal(t, want, rr.Header().Get("Access-Control-Allow-Origin"), origin)
+	}
+}
+
 func TestHandleFunc_RespondErrorLogged(t *testing.T) {
 	// This test ensures that when httpx.Respond returns an error, the app logs it.
 	// We create a handler that returns a non-nil httpx.Response which causes httpx.Respond to error.
@@ -131,3 +231,216 @@ func TestHandleFunc_RespondErrorLogged(t *testing.T) {
 	assert.NotNil(t, rr)
 	// If a body was written, it's fine; ensure call completed.
 }
+
+func TestHandleFunc_InstallsRequestValues(t *testing.T) {
+	var buf bytes.Buffer
+	logger := logx.New(&buf, slog.LevelInfo, "unit-tests", httpx.TraceID)
+	app := NewApp(logger, middleware.Logger(logger))
+
+	var seen *httpx.Values
+	app.HandleFunc("GET", "/v", func(w http.ResponseWriter, r *http.Request) httpx.Response {
+		seen = httpx.GetValues(r.Context())
+		logger.Info(r.Context(), "inside handler")
+		return httpx.PlainTextResponse(http.StatusCreated, "ok")
+	})
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    string
+	}{
+		{name: "generated", want: ""},
+		{name: "request id", headers: map[string]string{"X-Request-ID": "req-123"}, want: "req-123"},
+		{
+			name:    "traceparent wins",
+			headers: map[string]string{"X-Request-ID": "req-123", "traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+			want:    "4bf92f3577b34da6a3ce929d0e0e4736",
+		},
+		{name: "invalid traceparent", headers: map[string]string{"traceparent": "00-00000000000000000000000000000000-00f067aa0ba902b7-01"}, want: ""},
+		{name: "invalid request id", headers: map[string]string{"X-Request-ID": "bad id\n"}, want: ""},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			buf.Reset()
+			req := httptest.NewRequest("GET", "/v", nil)
+			for k, v := range tc.headers {
+				req.Header.Set(k, v)
+			}
+			rr := httptest.NewRecorder()
+			app.ServeHTTP(rr, req)
+
+			got := rr.Header().Get(RequestIDHeader)
+			if tc.want == "" {
+				_, err := uuid.Parse(got)
+				require.NoError(t, err, "expected a generated uuid, got %q", got)
+			} else {
+				require.Equal(t, tc.want, got)
+			}
+			require.Equal(t, got, seen.TraceID)
+			require.Equal(t, http.StatusCreated, seen.StatusCode)
+
+			// Both the handler's log line and the request log carry the trace ID.
+			lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+			require.Len(t, lines, 2)
+			for _, line := range lines {
+				var entry map[string]any
+				require.NoError(t, json.Unmarshal([]byte(line), &entry))
+				assert.Equal(t, got, entry["trace_id"])
+			}
+			var entry map[string]any
+			require.NoError(t, json.Unmarshal([]byte(lines[1]), &entry))
+			assert.Equal(t, float64(http.StatusCreated), entry["statuscode"])
+		})
+	}
+}
+
+func TestHandleFunc_TraceIDLoggedWithoutTraceIDFn(t *testing.T) {
+	var buf bytes.Buffer
+	logger := logx.New(&buf, slog.LevelInfo, "unit-tests", nil)
+	app := NewApp(logger, middleware.Logger(logger), middleware.Errors(logger))
+	app.HandleFunc("GET", "/fail", func(w http.ResponseWriter, r *http.Request) httpx.Response {
+		return httpx.ErrorResponse(errors.New("boom"), http.StatusInternalServerError)
+	})
+
+	req := httptest.NewRequest("GET", "/fail", nil)
+	req.Header.Set(RequestIDHeader, "req-123")
+	app.ServeHTTP(httptest.NewRecorder(), req)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 2, buf.String())
+	for _, line := range lines {
+		var entry map[string]any
+		require.NoError(t, json.Unmarshal([]byte(line), &entry))
+		assert.Equal(t, "req-123", entry["trace_id"], line)
+	}
+}
+
+func TestHandleFunc_SSEThroughMiddleware(t *testing.T) {
+	var buf bytes.Buffer
+	logger := logx.New(&buf, slog.LevelInfo, "unit-tests", httpx.TraceID)
+	app := NewApp(logger, middleware.Logger(logger), middleware.Errors(logger), middleware.Panics())
+	app.HandleFunc("GET", "/events", func(w http.ResponseWriter, r *http.Request) httpx.Response {
+		events := make(chan httpx.Event, 2)
+		events <- httpx.Event{ID: "1", Data: "a"}
+		events <- httpx.Event{ID: "2", Data: "b"}
+		close(events)
+		return httpx.SSEResponse(r, events)
+	})
+
+	srv := httptest.NewServer(app)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/events")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	assert.NotEmpty(t, resp.Header.Get(RequestIDHeader))
+	assert.Equal(t, "id: 1\ndata: a\n\nid: 2\ndata: b\n\n", string(body))
+	assert.Contains(t, buf.String(), `"msg":"request completed"`)
+}
+
+// panicky panics when an event stream encodes it.
+type panicky struct{}
+
+func (panicky) MarshalJSON() ([]byte, error) { panic("boom") }
+
+func TestHandleFunc_StreamLoggedAndRecoveredAfterMiddleware(t *testing.T) {
+	var buf bytes.Buffer
+	logger := logx.New(&buf, slog.LevelInfo, "unit-tests", httpx.TraceID)
+	app := NewApp(logger, middleware.Logger(logger), middleware.Errors(logger), middleware.Panics())
+	app.HandleFunc("GET", "/events", func(w http.ResponseWriter, r *http.Request) httpx.Response {
+		events := make(chan httpx.Event)
+		go func() {
+			events <- httpx.Event{ID: "1", Data: "a"}
+			time.Sleep(50 * time.Millisecond)
+			events <- httpx.Event{ID: "2", Data: panicky{}}
+		}()
+		return httpx.SSEResponse(r, events)
+	})
+
+	srv := httptest.NewServer(app)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/events")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "id: 1\ndata: a\n\n", string(body))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 2, buf.String())
+
+	// The request is logged once the stream ended, after the panic.
+	var completed, respond map[string]any
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &completed))
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &respond))
+	assert.Equal(t, "request completed", completed["msg"])
+	assert.Equal(t, float64(http.StatusOK), completed["statuscode"])
+	assert.GreaterOrEqual(t, completed["since"], float64(50*time.Millisecond))
+	assert.Equal(t, "web-respond", respond["msg"])
+	assert.Contains(t, respond["ERROR"], "PANIC [boom]")
+}
+
+func TestHandleFunc_TimeoutReleasedWhenStreamNotWritten(t *testing.T) {
+	// An outer middleware replacing the stream with a regular response.
+	replace := func(next httpx.HandlerFunc) httpx.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) httpx.Response {
+			next(w, r)
+			return httpx.JSONResponse(http.StatusOK, "replaced")
+		}
+	}
+
+	app := NewApp(testLogger(t), replace)
+	app.WithTimeout(time.Minute)
+	var ctx context.Context
+	app.HandleFunc("GET", "/events", func(w http.ResponseWriter, r *http.Request) httpx.Response {
+		ctx = r.Context()
+		return httpx.SSEResponse(r, make(chan httpx.Event))
+	})
+
+	w := httptest.NewRecorder()
+	app.ServeHTTP(w, httptest.NewRequest("GET", "/events", nil))
+	assert.Equal(t, `"replaced"`, strings.TrimSpace(w.Body.String()))
+	assert.ErrorIs(t, ctx.Err(), context.Canceled)
+}
+
+func TestWithSecureHeaders_NonceAndRouteOverride(t *testing.T) {
+	nonceHandler := func(w http.ResponseWriter, r *http.Request) httpx.Response {
+		return httpx.PlainTextResponse(http.StatusOK, middleware.CSPNonce(r.Context()))
+	}
+
+	app := NewApp(testLogger(t))
+	app.WithSecureHeaders(middleware.SecureHeadersConfig{
+		ContentSecurityPolicy: "script-src 'self' 'nonce-{nonce}'",
+		ContentTypeNosniff:    true,
+	})
+	app.HandleFunc("GET", "/page", nonceHandler)
+	app.Routes([]Route{{
+		Method:  "GET",
+		Path:    "/embed",
+		Handler: nonceHandler,
+		SecureHeaders: middleware.NewSecureHeaders(middleware.SecureHeadersConfig{
+			FrameOptions: "SAMEORIGIN",
+		}),
+	}})
+
+	first := serve(app, "GET", "/page")
+	second := serve(app, "GET", "/page")
+	assert.Empty(t, first.Header().Get("Strict-Transport-Security"))
+	assert.Equal(t, "nosniff", first.Header().Get("X-Content-Type-Options"))
+	nonce := first.Body.String()
+	assert.NotEmpty(t, nonce)
+	assert.NotEqual(t, nonce, second.Body.String())
+	assert.Equal(t, "script-src 'self' 'nonce-"+nonce+"'", first.Header().Get("Content-Security-Policy"))
+
+	embed := serve(app, "GET", "/embed")
+	assert.Equal(t, "SAMEORIGIN", embed.Header().Get("X-Frame-Options"))
+	assert.Empty(t, embed.Header().Get("X-Content-Type-Options"))
+	assert.Empty(t, embed.Header().Get("Content-Security-Policy"))
+	assert.Empty(t, embed.Body.String())
+}
@@ -0,0 +1,134 @@
+// Package auth authenticates requests with bearer JWTs, API keys or HTTP
+// Basic credentials and carries the resulting Principal in the request
+// context. The middleware using it lives in pkg/web/middleware.
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"slices"
+)
+
+// Authentication methods recorded in Principal.Method.
+const (
+	MethodJWT    = "jwt"
+	MethodAPIKey = "apikey"
+	MethodBasic  = "basic"
+)
+
+var (
+	// ErrInvalidCredentials is returned for unknown API keys and wrong
+	// usernames or passwords.
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	// ErrInvalidToken is wrapped by every JWT verification failure.
+	ErrInvalidToken = errors.New("invalid token")
+)
+
+// Principal is the authenticated caller of a request.
+type Principal struct {
+	// Subject identifies the caller: the JWT subject, the API key's owner or
+	// the Basic auth username.
+	Subject string
+	// Method is how the caller authenticated, e.g. MethodJWT.
+	Method string
+	Roles  []string
+	Scopes []string
+	// Claims holds the verified token for MethodJWT and is nil otherwise.
+	Claims *Claims
+}
+
+// HasRole reports whether the principal has role.
+func (p *Principal) HasRole(role string) bool {
+	return p != nil && slices.Contains(p.Roles, role)
+}
+
+// HasScope reports whether the principal was granted scope.
+func (p *Principal) HasScope(scope string) bool {
+	return p != nil && slices.Contains(p.Scopes, scope)
+}
+
+type ctxKey int
+
+const principalKey ctxKey = 1
+
+// NewContext returns a copy of ctx carrying p.
+func NewContext(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey, p)
+}
+
+// FromContext returns the principal of an authenticated request.
+func FromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey).(*Principal)
+	return p, ok && p != nil
+}
+
+// ClaimsFromContext returns the verified JWT claims of a request
+// authenticated with a bearer token.
+func ClaimsFromContext(ctx context.Context) (*Claims, bool) {
+	p, ok := FromContext(ctx)
+	if !ok || p.Claims == nil {
+		return nil, false
+	}
+	return p.Claims, true
+}
+
+// APIKeyStore looks up the principal an API key belongs to. Unknown keys are
+// reported as ErrInvalidCredentials.
+type APIKeyStore interface {
+	LookupAPIKey(ctx context.Context, key string) (*Principal, error)
+}
+
+// APIKeyStoreFunc adapts a function to an APIKeyStore.
+type APIKeyStoreFunc func(ctx context.Context, key string) (*Principal, error)
+
+func (f APIKeyStoreFunc) LookupAPIKey(ctx context.Context, key string) (*Principal, error) {
+	return f(ctx, key)
+}
+
+// StaticAPIKeys is an APIKeyStore for a fixed set of keys, such as keys read
+// from configuration. Only digests of the keys are kept.
+type StaticAPIKeys struct {
+	keys map[[sha256.Size]byte]Principal
+}
+
+// NewStaticAPIKeys returns a store accepting each key of keys as its
+// principal.
+func NewStaticAPIKeys(keys map[string]Principal) *StaticAPIKeys {
+	s := &StaticAPIKeys{keys: make(map[[sha256.Size]byte]Principal, len(keys))}
+	for k, p := range keys {
+		s.keys[sha256.Sum256([]byte(k))] = p
+	}
+	return s
+}
+
+func (s *StaticAPIKeys) LookupAPIKey(ctx context.Context, key string) (*Principal, error) {
+	p, ok := s.keys[sha256.Sum256([]byte(key))]
+	if !ok {
+		return nil, ErrInvalidCredentials
+	}
+	return &p, nil
+}
+
+// BasicAuthFunc checks a username and password and returns the principal
+// they belong to. Wrong credentials are reported as ErrInvalidCredentials.
+type BasicAuthFunc func(ctx context.Context, username, password string) (*Principal, error)
+
+// BasicAuthUsers returns a BasicAuthFunc accepting the passwords of users,
+// keyed by username. Passwords are compared in constant time.
+func BasicAuthUsers(users map[string]string) BasicAuthFunc {
+	digests := make(map[string][sha256.Size]byte, len(users))
+	for u, pw := range users {
+		digests[u] = sha256.Sum256([]byte(pw))
+	}
+
+	return func(ctx context.Context, username, password string) (*Principal, error) {
+		want, ok := digests[username]
+		got := sha256.Sum256([]byte(password))
+		if subtle.ConstantTimeCompare(want[:], got[:]) != 1 || !ok {
+			return nil, ErrInvalidCredentials
+		}
+		return &Principal{Subject: username}, nil
+	}
+}
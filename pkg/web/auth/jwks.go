@@ -0,0 +1,290 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// ErrUnknownKey is returned by a JWKS without a key for a token.
+var ErrUnknownKey = errors.New("unknown key")
+
+// DefaultJWKSRefresh is how long a JWKS caches its keys by default.
+const DefaultJWKSRefresh = 15 * time.Minute
+
+// jwksMinRefetch rate limits refetching on unknown key IDs, so tokens with
+// made up key IDs can't hammer the key server.
+const jwksMinRefetch = 30 * time.Second
+
+// JWKS is a KeySet backed by a JSON Web Key Set (RFC 7517), loaded from a
+// file or URL and cached. The set is reloaded once the cache expires and, at
+// most every 30 seconds, when a token names a key ID it doesn't know, so key
+// rotation is picked up without a restart. Supported keys are RSA, EC on
+// P-256 and oct (HMAC secrets).
+//
+// Cached keys are looked up without waiting for the source: an expired set
+// is still used while it reloads in the background, and concurrent requests
+// needing a reload share one fetch.
+type JWKS struct {
+	load    func(ctx context.Context) ([]byte, error)
+	refresh time.Duration
+
+	mu        sync.RWMutex
+	keys      map[string]jwk
+	loaded    time.Time
+	lastFetch time.Time
+	inflight  *jwksFetch
+}
+
+// jwksFetch is a reload of a JWKS that callers can wait for.
+type jwksFetch struct {
+	done chan struct{}
+	err  error
+}
+
+type jwk struct {
+	key any
+	alg string
+}
+
+// NewJWKSFile returns a JWKS read from the file at path, cached for refresh
+// (DefaultJWKSRefresh if zero).
+func NewJWKSFile(path string, refresh time.Duration) *JWKS {
+	return newJWKS(func(ctx context.Context) ([]byte, error) {
+		return os.ReadFile(path)
+	}, refresh)
+}
+
+// NewJWKSURL returns a JWKS fetched from url with client (a client with a 10
+// second timeout if nil), cached for refresh (DefaultJWKSRefresh if zero).
+func NewJWKSURL(url string, client *http.Client, refresh time.Duration) *JWKS {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return newJWKS(func(ctx context.Context) ([]byte, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept", "application/json")
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("GET %s: %s", url, resp.Status)
+		}
+		return io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	}, refresh)
+}
+
+func newJWKS(load func(ctx context.Context) ([]byte, error), refresh time.Duration) *JWKS {
+	if refresh == 0 {
+		refresh = DefaultJWKSRefresh
+	}
+	return &JWKS{load: load, refresh: refresh}
+}
+
+// Key returns the key with ID kid. A token without a kid is matched when the
+// set holds a single key.
+func (s *JWKS) Key(ctx context.Context, kid, alg string) (any, error) {
+	s.mu.RLock()
+	keys, loaded := s.keys, s.loaded
+	s.mu.RUnlock()
+
+	switch {
+	case keys == nil:
+		if err := s.refetch(ctx, 0); err != nil {
+			return nil, err
+		}
+	case time.Since(loaded) > s.refresh:
+		// Stale keys are better than none while the source is slow or down.
+		s.startFetch(ctx, 0)
+	}
+
+	k, ok := s.lookup(kid)
+	if !ok {
+		if err := s.refetch(ctx, jwksMinRefetch); err != nil {
+			return nil, err
+		}
+		k, ok = s.lookup(kid)
+	}
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	if k.alg != "" && k.alg != alg {
+		return nil, fmt.Errorf("key is for %s, not %s", k.alg, alg)
+	}
+	return k.key, nil
+}
+
+func (s *JWKS) lookup(kid string) (jwk, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if kid == "" && len(s.keys) == 1 {
+		for _, k := range s.keys {
+			return k, true
+		}
+	}
+	k, ok := s.keys[kid]
+	return k, ok
+}
+
+// refetch reloads the set, unless it was fetched less than minAge ago, and
+// waits for the reload or for ctx to be done.
+func (s *JWKS) refetch(ctx context.Context, minAge time.Duration) error {
+	f := s.startFetch(ctx, minAge)
+	if f == nil {
+		return nil
+	}
+	select {
+	case <-f.done:
+		return f.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// startFetch starts reloading the set unless it was fetched less than minAge
+// ago, in which case it returns nil. A reload in progress is shared. The
+// reload isn't cancelled with ctx, since other callers may wait for it.
+func (s *JWKS) startFetch(ctx context.Context, minAge time.Duration) *jwksFetch {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.inflight != nil {
+		return s.inflight
+	}
+	if minAge > 0 && time.Since(s.lastFetch) < minAge {
+		return nil
+	}
+
+	f := &jwksFetch{done: make(chan struct{})}
+	s.inflight = f
+	s.lastFetch = time.Now()
+	go func(started time.Time) {
+		defer close(f.done)
+		keys, err := s.fetch(context.WithoutCancel(ctx))
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.inflight = nil
+		if err != nil {
+			f.err = err
+			return
+		}
+		s.keys = keys
+		s.loaded = started
+	}(s.lastFetch)
+	return f
+}
+
+func (s *JWKS) fetch(ctx context.Context) (map[string]jwk, error) {
+	data, err := s.load(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("load jwks: %w", err)
+	}
+	return parseJWKS(data)
+}
+
+type rawJWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	K   string `json:"k"`
+}
+
+// parseJWKS parses a JSON Web Key Set into verification keys by key ID.
+// Encryption keys and unsupported key types are skipped.
+func parseJWKS(data []byte) (map[string]jwk, error) {
+	var set struct {
+		Keys []rawJWK `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("parse jwks: %w", err)
+	}
+
+	keys := make(map[string]jwk, len(set.Keys))
+	for _, rk := range set.Keys {
+		if rk.Use == "enc" {
+			continue
+		}
+		key, err := rk.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("parse jwks: key %q: %w", rk.Kid, err)
+		}
+		if key != nil {
+			keys[rk.Kid] = jwk{key: key, alg: rk.Alg}
+		}
+	}
+	return keys, nil
+}
+
+// publicKey returns the key, or nil for unsupported key types.
+func (rk rawJWK) publicKey() (any, error) {
+	switch rk.Kty {
+	case "RSA":
+		n, err := decodeBigInt(rk.N)
+		if err != nil {
+			return nil, fmt.Errorf("n: %w", err)
+		}
+		e, err := decodeBigInt(rk.E)
+		if err != nil || !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("invalid e")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+
+	case "EC":
+		if rk.Crv != "P-256" {
+			return nil, nil
+		}
+		x, err := base64.RawURLEncoding.DecodeString(rk.X)
+		if err != nil || len(x) != 32 {
+			return nil, fmt.Errorf("invalid x")
+		}
+		y, err := base64.RawURLEncoding.DecodeString(rk.Y)
+		if err != nil || len(y) != 32 {
+			return nil, fmt.Errorf("invalid y")
+		}
+		point := append(append([]byte{4}, x...), y...)
+		return ecdsa.ParseUncompressedPublicKey(elliptic.P256(), point)
+
+	case "oct":
+		k, err := base64.RawURLEncoding.DecodeString(rk.K)
+		if err != nil {
+			return nil, fmt.Errorf("k: %w", err)
+		}
+		return k, nil
+	}
+	return nil, nil
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) == 0 {
+		return nil, fmt.Errorf("empty value")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
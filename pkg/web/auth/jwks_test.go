@@ -0,0 +1,207 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func rsaJWK(kid string, k *rsa.PublicKey) map[string]string {
+	return map[string]string{
+		"kty": "RSA", "kid": kid, "alg": RS256, "use": "sig",
+		"n": base64.RawURLEncoding.EncodeToString(k.N.Bytes()),
+		"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(k.E)).Bytes()),
+	}
+}
+
+func ecJWK(kid string, k *ecdsa.PrivateKey) map[string]string {
+	b, err := k.PublicKey.Bytes()
+	if err != nil {
+		panic(err)
+	}
+	return map[string]string{
+		"kty": "EC", "kid": kid, "crv": "P-256",
+		"x": base64.RawURLEncoding.EncodeToString(b[1:33]),
+		"y": base64.RawURLEncoding.EncodeToString(b[33:]),
+	}
+}
+
+func jwksJSON(t *testing.T, keys ...map[string]string) []byte {
+	t.Helper()
+	b, err := json.Marshal(map[string]any{"keys": keys})
+	require.NoError(t, err)
+	return b
+}
+
+func TestJWKSFile_VerifiesRSAAndEC(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	require.NoError(t, os.WriteFile(path, jwksJSON(t,
+		rsaJWK("rsa-1", &rsaKey.PublicKey),
+		ecJWK("ec-1", ecKey),
+		map[string]string{"kty": "RSA", "kid": "enc-1", "use": "enc", "n": "AQAB", "e": "AQAB"},
+		map[string]string{"kty": "OKP", "kid": "ed-1", "crv": "Ed25519", "x": "AA"},
+	), 0o600))
+
+	v := testVerifier(NewJWKSFile(path, 0))
+
+	for _, tc := range []struct {
+		alg, kid string
+		key      any
+	}{{RS256, "rsa-1", rsaKey}, {ES256, "ec-1", ecKey}} {
+		token, err := Sign(testClaims(), tc.alg, tc.key, tc.kid)
+		require.NoError(t, err)
+		c, err := v.Verify(context.Background(), token)
+		require.NoError(t, err, tc.kid)
+		assert.Equal(t, "user-1", c.Subject)
+	}
+
+	// The key's alg must match the token's.
+	ecToken, err := Sign(testClaims(), ES256, ecKey, "rsa-1")
+	require.NoError(t, err)
+	_, err = v.Verify(context.Background(), ecToken)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	token, err := Sign(testClaims(), RS256, rsaKey, "unknown")
+	require.NoError(t, err)
+	_, err = v.Verify(context.Background(), token)
+	assert.ErrorIs(t, err, ErrUnknownKey)
+}
+
+func TestJWKSURL_CachesAndPicksUpRotatedKeys(t *testing.T) {
+	oldKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	newKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	var fetches atomic.Int32
+	var body atomic.Value
+	body.Store(jwksJSON(t, rsaJWK("old", &oldKey.PublicKey)))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		w.Write(body.Load().([]byte))
+	}))
+	defer srv.Close()
+
+	jwks := NewJWKSURL(srv.URL, srv.Client(), time.Hour)
+	v := testVerifier(jwks)
+
+	oldToken, err := Sign(testClaims(), RS256, oldKey, "old")
+	require.NoError(t, err)
+	for range 3 {
+		_, err = v.Verify(context.Background(), oldToken)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, int32(1), fetches.Load())
+
+	// The issuer rotates its key; the unknown kid triggers a refetch.
+	body.Store(jwksJSON(t, rsaJWK("new", &newKey.PublicKey)))
+	jwks.lastFetch = time.Now().Add(-time.Minute)
+	newToken, err := Sign(testClaims(), RS256, newKey, "new")
+	require.NoError(t, err)
+	_, err = v.Verify(context.Background(), newToken)
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), fetches.Load())
+
+	// Refetching on unknown kids is rate limited.
+	bogus, err := Sign(testClaims(), RS256, newKey, "bogus")
+	require.NoError(t, err)
+	_, err = v.Verify(context.Background(), bogus)
+	assert.ErrorIs(t, err, ErrUnknownKey)
+	assert.Equal(t, int32(2), fetches.Load())
+}
+
+func TestJWKS_SingleKeyMatchesTokenWithoutKid(t *testing.T) {
+	set := newJWKS(func(ctx context.Context) ([]byte, error) {
+		return jwksJSON(t, map[string]string{"kty": "oct", "kid": "only", "k": base64.RawURLEncoding.EncodeToString(testSecret)}), nil
+	}, 0)
+	token, err := Sign(testClaims(), HS256, testSecret, "")
+	require.NoError(t, err)
+
+	_, err = testVerifier(set).Verify(context.Background(), token)
+
+	assert.NoError(t, err)
+}
+
+func TestJWKS_LoadError(t *testing.T) {
+	set := NewJWKSFile(filepath.Join(t.TempDir(), "missing.json"), 0)
+
+	_, err := set.Key(context.Background(), "k", RS256)
+
+	assert.ErrorContains(t, err, "load jwks")
+}
+
+func TestJWKS_SlowReloadDoesNotBlockCachedKeys(t *testing.T) {
+	set := jwksJSON(t, map[string]string{"kty": "oct", "kid": "k1", "k": base64.RawURLEncoding.EncodeToString(testSecret)})
+	var loads atomic.Int32
+	release := make(chan struct{})
+	jwks := newJWKS(func(ctx context.Context) ([]byte, error) {
+		if loads.Add(1) > 1 {
+			<-release
+		}
+		return set, nil
+	}, time.Hour)
+	defer close(release)
+
+	_, err := jwks.Key(context.Background(), "k1", HS256)
+	require.NoError(t, err)
+
+	// The cache expired and the source hangs; the stale key is still served.
+	jwks.mu.Lock()
+	jwks.loaded = time.Now().Add(-2 * time.Hour)
+	jwks.mu.Unlock()
+	for range 3 {
+		_, err = jwks.Key(context.Background(), "k1", HS256)
+		require.NoError(t, err)
+	}
+	require.Eventually(t, func() bool { return loads.Load() == 2 }, time.Second, time.Millisecond)
+
+	// A caller waiting for the hanging reload gives up with its context.
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = jwks.Key(ctx, "k2", HS256)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestJWKS_ConcurrentMissesShareOneFetch(t *testing.T) {
+	var loads atomic.Int32
+	release := make(chan struct{})
+	jwks := newJWKS(func(ctx context.Context) ([]byte, error) {
+		loads.Add(1)
+		<-release
+		return jwksJSON(t, map[string]string{"kty": "oct", "kid": "k1", "k": base64.RawURLEncoding.EncodeToString(testSecret)}), nil
+	}, 0)
+
+	errs := make(chan error)
+	for range 5 {
+		go func() {
+			_, err := jwks.Key(context.Background(), "k1", HS256)
+			errs <- err
+		}()
+	}
+	require.Eventually(t, func() bool { return loads.Load() == 1 }, time.Second, time.Millisecond)
+	close(release)
+	for range 5 {
+		require.NoError(t, <-errs)
+	}
+	assert.Equal(t, int32(1), loads.Load())
+}
@@ -0,0 +1,348 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Supported signing algorithms.
+const (
+	HS256 = "HS256"
+	RS256 = "RS256"
+	ES256 = "ES256"
+)
+
+// ErrTokenExpired is returned for tokens past their exp claim.
+var ErrTokenExpired = fmt.Errorf("%w: token expired", ErrInvalidToken)
+
+// NumericDate is a JWT time: seconds since the Unix epoch.
+type NumericDate int64
+
+// NewNumericDate returns t as a NumericDate.
+func NewNumericDate(t time.Time) NumericDate {
+	return NumericDate(t.Unix())
+}
+
+// Time returns d as a time.Time.
+func (d NumericDate) Time() time.Time {
+	return time.Unix(int64(d), 0)
+}
+
+// UnmarshalJSON accepts fractional seconds, which RFC 7519 allows.
+func (d *NumericDate) UnmarshalJSON(b []byte) error {
+	f, err := strconv.ParseFloat(string(b), 64)
+	if err != nil || math.IsInf(f, 0) || math.IsNaN(f) {
+		return fmt.Errorf("invalid numeric date %s", b)
+	}
+	*d = NumericDate(f)
+	return nil
+}
+
+// Audience is the aud claim, which may be a single string or an array.
+type Audience []string
+
+func (a *Audience) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*a = Audience{s}
+		return nil
+	}
+	var ss []string
+	if err := json.Unmarshal(b, &ss); err != nil {
+		return fmt.Errorf("aud must be a string or an array of strings")
+	}
+	*a = ss
+	return nil
+}
+
+func (a Audience) MarshalJSON() ([]byte, error) {
+	if len(a) == 1 {
+		return json.Marshal(a[0])
+	}
+	return json.Marshal([]string(a))
+}
+
+// Claims are the registered JWT claims and the common roles and scope
+// claims. Other claims can be read with Get or Decode.
+type Claims struct {
+	Issuer    string      `json:"iss,omitempty"`
+	Subject   string      `json:"sub,omitempty"`
+	Audience  Audience    `json:"aud,omitempty"`
+	ExpiresAt NumericDate `json:"exp,omitempty"`
+	NotBefore NumericDate `json:"nbf,omitempty"`
+	IssuedAt  NumericDate `json:"iat,omitempty"`
+	ID        string      `json:"jti,omitempty"`
+	Roles     []string    `json:"roles,omitempty"`
+	// Scope is a space separated list of scopes, see RFC 8693.
+	Scope string `json:"scope,omitempty"`
+
+	raw json.RawMessage
+}
+
+// Scopes returns the scopes of the scope claim.
+func (c *Claims) Scopes() []string {
+	return strings.Fields(c.Scope)
+}
+
+// Get returns the claim name of a verified token as decoded by
+// encoding/json.
+func (c *Claims) Get(name string) (any, bool) {
+	var m map[string]any
+	if err := json.Unmarshal(c.raw, &m); err != nil {
+		return nil, false
+	}
+	v, ok := m[name]
+	return v, ok
+}
+
+// Decode unmarshals the payload of a verified token into v, for tokens with
+// application specific claims.
+func (c *Claims) Decode(v any) error {
+	if c.raw == nil {
+		return fmt.Errorf("claims have no payload")
+	}
+	return json.Unmarshal(c.raw, v)
+}
+
+// KeySet provides the key verifying a token: a []byte secret for HS256, an
+// *rsa.PublicKey for RS256 or an *ecdsa.PublicKey for ES256. kid is the
+// token's key ID and may be empty.
+type KeySet interface {
+	Key(ctx context.Context, kid, alg string) (any, error)
+}
+
+// KeySetFunc adapts a function to a KeySet.
+type KeySetFunc func(ctx context.Context, kid, alg string) (any, error)
+
+func (f KeySetFunc) Key(ctx context.Context, kid, alg string) (any, error) {
+	return f(ctx, kid, alg)
+}
+
+// StaticKey returns a KeySet verifying every token with key.
+func StaticKey(key any) KeySet {
+	return KeySetFunc(func(ctx context.Context, kid, alg string) (any, error) {
+		return key, nil
+	})
+}
+
+// JWTConfig configures a JWTVerifier.
+type JWTConfig struct {
+	// Keys provides the verification keys, e.g. StaticKey or a JWKS.
+	Keys KeySet
+	// Algorithms lists the accepted algorithms. Defaults to HS256, RS256 and
+	// ES256. A token is only accepted if its key matches its algorithm, so
+	// an RSA public key can never be used as an HMAC secret.
+	Algorithms []string
+	// Issuer, if set, must equal the iss claim.
+	Issuer string
+	// Audience, if set, must be one of the aud claim's values.
+	Audience string
+	// Leeway is the clock skew tolerated when checking exp and nbf.
+	Leeway time.Duration
+	// Now defaults to time.Now.
+	Now func() time.Time
+}
+
+// JWTVerifier verifies compact serialized JWS tokens.
+type JWTVerifier struct {
+	cfg JWTConfig
+}
+
+// NewJWTVerifier returns a verifier for cfg.
+func NewJWTVerifier(cfg JWTConfig) *JWTVerifier {
+	if len(cfg.Algorithms) == 0 {
+		cfg.Algorithms = []string{HS256, RS256, ES256}
+	}
+	if cfg.Now == nil {
+		cfg.Now = time.Now
+	}
+	return &JWTVerifier{cfg: cfg}
+}
+
+type jwtHeader struct {
+	Alg  string   `json:"alg"`
+	Kid  string   `json:"kid,omitempty"`
+	Typ  string   `json:"typ,omitempty"`
+	Crit []string `json:"crit,omitempty"`
+}
+
+// Verify checks the token's signature, expiry, not-before time, issuer and
+// audience and returns its claims. Every error wraps ErrInvalidToken. The
+// exp claim is required.
+func (v *JWTVerifier) Verify(ctx context.Context, token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, invalidToken("malformed token")
+	}
+
+	var h jwtHeader
+	if err := decodeSegment(parts[0], &h); err != nil {
+		return nil, invalidToken("header: %v", err)
+	}
+	if !slices.Contains(v.cfg.Algorithms, h.Alg) {
+		return nil, invalidToken("algorithm %q not allowed", h.Alg)
+	}
+	if len(h.Crit) > 0 {
+		return nil, invalidToken("unsupported critical headers %v", h.Crit)
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, invalidToken("signature: %v", err)
+	}
+	key, err := v.cfg.Keys.Key(ctx, h.Kid, h.Alg)
+	if err != nil {
+		return nil, fmt.Errorf("%w: key %q: %w", ErrInvalidToken, h.Kid, err)
+	}
+	if err := verifySignature(h.Alg, key, parts[0]+"."+parts[1], sig); err != nil {
+		return nil, err
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, invalidToken("payload: %v", err)
+	}
+	c := Claims{raw: payload}
+	if err := json.Unmarshal(payload, &c); err != nil {
+		return nil, invalidToken("payload: %v", err)
+	}
+
+	if err := v.validate(&c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func (v *JWTVerifier) validate(c *Claims) error {
+	now := v.cfg.Now()
+	if c.ExpiresAt == 0 {
+		return invalidToken("missing exp claim")
+	}
+	if now.Add(-v.cfg.Leeway).After(c.ExpiresAt.Time()) {
+		return ErrTokenExpired
+	}
+	if c.NotBefore != 0 && now.Add(v.cfg.Leeway).Before(c.NotBefore.Time()) {
+		return invalidToken("token not valid yet")
+	}
+	if v.cfg.Issuer != "" && c.Issuer != v.cfg.Issuer {
+		return invalidToken("unexpected issuer %q", c.Issuer)
+	}
+	if v.cfg.Audience != "" && !slices.Contains(c.Audience, v.cfg.Audience) {
+		return invalidToken("token not issued for %q", v.cfg.Audience)
+	}
+	return nil
+}
+
+func verifySignature(alg string, key any, signingInput string, sig []byte) error {
+	digest := sha256.Sum256([]byte(signingInput))
+
+	switch k := key.(type) {
+	case []byte:
+		if alg == HS256 {
+			mac := hmac.New(sha256.New, k)
+			mac.Write([]byte(signingInput))
+			if !hmac.Equal(sig, mac.Sum(nil)) {
+				return invalidToken("signature mismatch")
+			}
+			return nil
+		}
+	case *rsa.PublicKey:
+		if alg == RS256 {
+			if err := rsa.VerifyPKCS1v15(k, crypto.SHA256, digest[:], sig); err != nil {
+				return invalidToken("signature mismatch")
+			}
+			return nil
+		}
+	case *ecdsa.PublicKey:
+		if alg == ES256 && k.Curve == elliptic.P256() {
+			if len(sig) != 64 {
+				return invalidToken("signature mismatch")
+			}
+			r := new(big.Int).SetBytes(sig[:32])
+			s := new(big.Int).SetBytes(sig[32:])
+			if !ecdsa.Verify(k, digest[:], r, s) {
+				return invalidToken("signature mismatch")
+			}
+			return nil
+		}
+	}
+	return invalidToken("key of type %T can't verify %s", key, alg)
+}
+
+// Sign returns claims, typically a *Claims or a struct embedding Claims,
+// as a token signed with key: a []byte secret for HS256, an *rsa.PrivateKey
+// for RS256 or an *ecdsa.PrivateKey on P-256 for ES256. kid is optional.
+func Sign(claims any, alg string, key any, kid string) (string, error) {
+	header, err := json.Marshal(jwtHeader{Alg: alg, Kid: kid, Typ: "JWT"})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", fmt.Errorf("encode claims: %w", err)
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signingInput))
+
+	var sig []byte
+	switch k := key.(type) {
+	case []byte:
+		if alg != HS256 {
+			return "", fmt.Errorf("a secret can't sign %s", alg)
+		}
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(signingInput))
+		sig = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		if alg != RS256 {
+			return "", fmt.Errorf("an RSA key can't sign %s", alg)
+		}
+		sig, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:])
+		if err != nil {
+			return "", fmt.Errorf("sign: %w", err)
+		}
+	case *ecdsa.PrivateKey:
+		if alg != ES256 || k.Curve != elliptic.P256() {
+			return "", fmt.Errorf("an ECDSA key can only sign ES256 on P-256")
+		}
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest[:])
+		if err != nil {
+			return "", fmt.Errorf("sign: %w", err)
+		}
+		sig = make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+	default:
+		return "", fmt.Errorf("unsupported key type %T", key)
+	}
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+func decodeSegment(seg string, v any) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+func invalidToken(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", ErrInvalidToken, fmt.Sprintf(format, args...))
+}
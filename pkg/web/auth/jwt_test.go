@@ -0,0 +1,208 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	testNow    = time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	testSecret = []byte("0123456789abcdef0123456789abcdef")
+)
+
+func testClaims() *Claims {
+	return &Claims{
+		Issuer:    "https://issuer.example",
+		Subject:   "user-1",
+		Audience:  Audience{"api"},
+		ExpiresAt: NewNumericDate(testNow.Add(time.Hour)),
+		IssuedAt:  NewNumericDate(testNow),
+		Roles:     []string{"admin"},
+		Scope:     "read write",
+	}
+}
+
+func testVerifier(keys KeySet) *JWTVerifier {
+	return NewJWTVerifier(JWTConfig{
+		Keys:     keys,
+		Issuer:   "https://issuer.example",
+		Audience: "api",
+		Now:      func() time.Time { return testNow },
+	})
+}
+
+func TestVerify_Algorithms(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tests := []struct {
+		alg     string
+		signKey any
+		verKey  any
+	}{
+		{HS256, testSecret, testSecret},
+		{RS256, rsaKey, &rsaKey.PublicKey},
+		{ES256, ecKey, &ecKey.PublicKey},
+	}
+	for _, tt := range tests {
+		t.Run(tt.alg, func(t *testing.T) {
+			token, err := Sign(testClaims(), tt.alg, tt.signKey, "k1")
+			require.NoError(t, err)
+
+			c, err := testVerifier(StaticKey(tt.verKey)).Verify(context.Background(), token)
+
+			require.NoError(t, err)
+			assert.Equal(t, "user-1", c.Subject)
+			assert.Equal(t, []string{"admin"}, c.Roles)
+			assert.Equal(t, []string{"read", "write"}, c.Scopes())
+			sub, ok := c.Get("sub")
+			assert.True(t, ok)
+			assert.Equal(t, "user-1", sub)
+		})
+	}
+}
+
+func TestVerify_Rejects(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	sign := func(mod func(c *Claims)) string {
+		c := testClaims()
+		mod(c)
+		token, err := Sign(c, HS256, testSecret, "")
+		require.NoError(t, err)
+		return token
+	}
+	valid := sign(func(c *Claims) {})
+
+	tests := []struct {
+		name  string
+		token string
+		keys  KeySet
+		want  string
+	}{
+		{"malformed", "abc.def", nil, "malformed"},
+		{"tampered payload", func() string {
+			parts := strings.Split(valid, ".")
+			parts[1] = base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"admin","exp":9999999999}`))
+			return strings.Join(parts, ".")
+		}(), nil, "signature mismatch"},
+		{"alg none", func() string {
+			parts := strings.Split(valid, ".")
+			parts[0] = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`))
+			return parts[0] + "." + parts[1] + "."
+		}(), nil, "not allowed"},
+		{"wrong secret", valid, StaticKey([]byte("other")), "signature mismatch"},
+		// An HS256 token "signed" with the RSA public key must not verify.
+		{"key confusion", valid, StaticKey(&rsaKey.PublicKey), "can't verify HS256"},
+		{"expired", sign(func(c *Claims) { c.ExpiresAt = NewNumericDate(testNow.Add(-time.Minute)) }), nil, "expired"},
+		{"missing exp", sign(func(c *Claims) { c.ExpiresAt = 0 }), nil, "missing exp"},
+		{"not yet valid", sign(func(c *Claims) { c.NotBefore = NewNumericDate(testNow.Add(time.Minute)) }), nil, "not valid yet"},
+		{"wrong issuer", sign(func(c *Claims) { c.Issuer = "https://evil.example" }), nil, "unexpected issuer"},
+		{"wrong audience", sign(func(c *Claims) { c.Audience = Audience{"other", "more"} }), nil, `not issued for "api"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys := tt.keys
+			if keys == nil {
+				keys = StaticKey(testSecret)
+			}
+
+			_, err := testVerifier(keys).Verify(context.Background(), tt.token)
+
+			require.ErrorIs(t, err, ErrInvalidToken)
+			assert.Contains(t, err.Error(), tt.want)
+		})
+	}
+}
+
+func TestVerify_LeewayAndExpiredSentinel(t *testing.T) {
+	c := testClaims()
+	c.ExpiresAt = NewNumericDate(testNow.Add(-30 * time.Second))
+	token, err := Sign(c, HS256, testSecret, "")
+	require.NoError(t, err)
+
+	v := testVerifier(StaticKey(testSecret))
+	_, err = v.Verify(context.Background(), token)
+	assert.ErrorIs(t, err, ErrTokenExpired)
+
+	v.cfg.Leeway = time.Minute
+	_, err = v.Verify(context.Background(), token)
+	assert.NoError(t, err)
+}
+
+func TestClaims_DecodeCustomClaims(t *testing.T) {
+	type tenantClaims struct {
+		Claims
+		TenantID string `json:"tenant_id"`
+	}
+	token, err := Sign(tenantClaims{Claims: *testClaims(), TenantID: "t-9"}, HS256, testSecret, "")
+	require.NoError(t, err)
+
+	c, err := testVerifier(StaticKey(testSecret)).Verify(context.Background(), token)
+	require.NoError(t, err)
+
+	var tc tenantClaims
+	require.NoError(t, c.Decode(&tc))
+	assert.Equal(t, "t-9", tc.TenantID)
+	assert.Equal(t, "user-1", tc.Subject)
+}
+
+func TestAudience_UnmarshalStringOrArray(t *testing.T) {
+	var c Claims
+	require.NoError(t, (&c.Audience).UnmarshalJSON([]byte(`"api"`)))
+	assert.Equal(t, Audience{"api"}, c.Audience)
+	require.NoError(t, (&c.Audience).UnmarshalJSON([]byte(`["a","b"]`)))
+	assert.Equal(t, Audience{"a", "b"}, c.Audience)
+	assert.Error(t, (&c.Audience).UnmarshalJSON([]byte(`1`)))
+}
+
+func TestPrincipalContext(t *testing.T) {
+	_, ok := FromContext(context.Background())
+	assert.False(t, ok)
+
+	p := &Principal{Subject: "u", Roles: []string{"admin"}, Scopes: []string{"read"}, Claims: testClaims()}
+	ctx := NewContext(context.Background(), p)
+
+	got, ok := FromContext(ctx)
+	require.True(t, ok)
+	assert.Same(t, p, got)
+	assert.True(t, got.HasRole("admin"))
+	assert.False(t, got.HasRole("user"))
+	assert.True(t, got.HasScope("read"))
+	c, ok := ClaimsFromContext(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, "user-1", c.Subject)
+}
+
+func TestStaticAPIKeysAndBasicAuthUsers(t *testing.T) {
+	ctx := context.Background()
+
+	keys := NewStaticAPIKeys(map[string]Principal{"k-123": {Subject: "svc", Roles: []string{"ingest"}}})
+	p, err := keys.LookupAPIKey(ctx, "k-123")
+	require.NoError(t, err)
+	assert.Equal(t, "svc", p.Subject)
+	_, err = keys.LookupAPIKey(ctx, "k-124")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+
+	check := BasicAuthUsers(map[string]string{"ada": "s3cret"})
+	p, err = check(ctx, "ada", "s3cret")
+	require.NoError(t, err)
+	assert.Equal(t, "ada", p.Subject)
+	_, err = check(ctx, "ada", "wrong")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+	_, err = check(ctx, "bob", "")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+}
@@ -0,0 +1,60 @@
+package web
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/jwbonnell/go-libs/pkg/web/httpx"
+)
+
+// StatusCoder is implemented by response types that choose their own status
+// code, e.g. 201 for a created resource. Handle responds 200 otherwise.
+type StatusCoder interface {
+	StatusCode() int
+}
+
+// Handle adapts a typed function to an httpx.HandlerFunc. For each request it
+//
+//   - decodes the body, when there is one, into a Req with httpx.Decode,
+//   - fills the Req fields tagged path, query, header or cookie from the
+//     request with httpx.Bind,
+//   - validates the Req with httpx.Validate,
+//   - calls fn with the request context, and
+//   - encodes the result in the format the Accept header prefers, see
+//     httpx.NegotiatedResponse.
+//
+// Every failure, including the error returned by fn, is set as Response.Err
+// so the Errors middleware can render it.
+func Handle[Req, Resp any](fn func(ctx context.Context, req Req) (Resp, error)) httpx.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) httpx.Response {
+		var req Req
+		if err := decodeRequest(r, &req); err != nil {
+			return httpx.ErrorResponse(err, http.StatusBadRequest)
+		}
+
+		resp, err := fn(r.Context(), req)
+		if err != nil {
+			return httpx.ErrorResponse(err, http.StatusInternalServerError)
+		}
+
+		status := http.StatusOK
+		if sc, ok := any(resp).(StatusCoder); ok {
+			status = sc.StatusCode()
+		}
+		return httpx.NegotiatedResponse(r, status, resp)
+	}
+}
+
+func decodeRequest(r *http.Request, req any) error {
+	if r.Body != nil && r.Body != http.NoBody && r.ContentLength != 0 {
+		if err := httpx.Decode(r, req); err != nil {
+			return httpx.DecodeError(err)
+		}
+	}
+
+	if err := httpx.Bind(r, req); err != nil {
+		return err
+	}
+
+	return httpx.ValidationError(httpx.Validate(req))
+}
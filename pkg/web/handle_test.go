@@ -0,0 +1,206 @@
+package web
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jwbonnell/go-libs/pkg/web/httpx"
+	"github.com/jwbonnell/go-libs/pkg/web/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type updateUserReq struct {
+	ID      int64    `json:"-" path:"id"`
+	DryRun  bool     `json:"-" query:"dry_run"`
+	Fields  []string `json:"-" query:"field"`
+	Tenant  string   `json:"-" header:"X-Tenant" validate:"required"`
+	Name    string   `json:"name" validate:"required,min=2"`
+	Limit   *int     `json:"-" query:"limit"`
+	Comment string   `json:"comment"`
+}
+
+type userResp struct {
+	XMLName xml.Name `json:"-" xml:"user"`
+	ID      int64    `json:"id" xml:"id"`
+	Name    string   `json:"name" xml:"name"`
+	Tenant  string   `json:"tenant" xml:"tenant"`
+	created bool
+}
+
+func (u userResp) StatusCode() int {
+	if u.created {
+		return http.StatusCreated
+	}
+	return http.StatusOK
+}
+
+func newHandleApp(t *testing.T, fn func(ctx context.Context, req updateUserReq) (userResp, error)) *App {
+	app := NewApp(testLogger(t), middleware.Errors(testLogger(t)))
+	app.HandleFunc("PUT", "/users/{id}", Handle(fn))
+	return app
+}
+
+func TestHandle_BindsDecodesAndEncodes(t *testing.T) {
+	var got updateUserReq
+	app := newHandleApp(t, func(ctx context.Context, req updateUserReq) (userResp, error) {
+		got = req
+		return userResp{ID: req.ID, Name: req.Name, Tenant: req.Tenant}, nil
+	})
+
+	req := httptest.NewRequest("PUT", "/users/42?dry_run=true&field=a&field=b&limit=5", strings.NewReader(`{"name":"Alice"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Tenant", "acme")
+	rr := httptest.NewRecorder()
+	app.ServeHTTP(rr, req)
+
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{"id":42,"name":"Alice","tenant":"acme"}`, rr.Body.String())
+
+	assert.Equal(t, int64(42), got.ID)
+	assert.True(t, got.DryRun)
+	assert.Equal(t, []string{"a", "b"}, got.Fields)
+	require.NotNil(t, got.Limit)
+	assert.Equal(t, 5, *got.Limit)
+}
+
+func TestHandle_AcceptXMLAndStatusCoder(t *testing.T) {
+	app := newHandleApp(t, func(ctx context.Context, req updateUserReq) (userResp, error) {
+		return userResp{ID: req.ID, Name: req.Name, created: true}, nil
+	})
+
+	req := httptest.NewRequest("PUT", "/users/7", strings.NewReader(`{"name":"Bob"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Tenant", "acme")
+	req.Header.Set("Accept", "text/html, application/xml;q=0.9, */*;q=0.8")
+	rr := httptest.NewRecorder()
+	app.ServeHTTP(rr, req)
+
+	require.Equal(t, http.StatusCreated, rr.Code)
+	assert.Equal(t, "application/xml", rr.Header().Get("Content-Type"))
+	assert.Equal(t, `<user><id>7</id><name>Bob</name><tenant></tenant></user>`, rr.Body.String())
+}
+
+func TestHandle_Errors(t *testing.T) {
+	fail := errors.New("database unavailable")
+	app := newHandleApp(t, func(ctx context.Context, req updateUserReq) (userResp, error) {
+		switch req.Name {
+		case "missing":
+			return userResp{}, fmt.Errorf("user %d: %w", req.ID, httpx.ErrNotFound)
+		case "broken":
+			return userResp{}, fail
+		}
+		return userResp{}, nil
+	})
+
+	tests := []struct {
+		name       string
+		target     string
+		body       string
+		ctype      string
+		tenant     string
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name: "bad path param", target: "/users/abc", body: `{"name":"Al"}`, ctype: "application/json", tenant: "acme",
+			wantStatus: http.StatusBadRequest, wantBody: `"errors":[{"field":"id","error":"must be an integer"}]`,
+		},
+		{
+			name: "validation", target: "/users/1", body: `{"name":"A"}`, ctype: "application/json",
+			wantStatus: http.StatusBadRequest, wantBody: `"errors":[{"field":"X-Tenant","error":"is required"},{"field":"name","error":"must have length at least 2"}]`,
+		},
+		{
+			name: "malformed body", target: "/users/1", body: `{"name":`, ctype: "application/json", tenant: "acme",
+			wantStatus: http.StatusBadRequest, wantBody: `"detail":"json decode: unexpected EOF"`,
+		},
+		{
+			name: "unsupported media type", target: "/users/1", body: `name`, ctype: "application/x-foo", tenant: "acme",
+			wantStatus: http.StatusUnsupportedMediaType,
+		},
+		{
+			name: "not found", target: "/users/9", body: `{"name":"missing"}`, ctype: "application/json", tenant: "acme",
+			wantStatus: http.StatusNotFound, wantBody: `"detail":"user 9: not found"`,
+		},
+		{
+			name: "internal", target: "/users/9", body: `{"name":"broken"}`, ctype: "application/json", tenant: "acme",
+			wantStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("PUT", tc.target, strings.NewReader(tc.body))
+			req.Header.Set("Content-Type", tc.ctype)
+			if tc.tenant != "" {
+				req.Header.Set("X-Tenant", tc.tenant)
+			}
+			rr := httptest.NewRecorder()
+			app.ServeHTTP(rr, req)
+
+			require.Equal(t, tc.wantStatus, rr.Code, rr.Body.String())
+			assert.Equal(t, "application/problem+json", rr.Header().Get("Content-Type"))
+			assert.Contains(t, rr.Body.String(), tc.wantBody)
+			assert.NotContains(t, rr.Body.String(), fail.Error())
+		})
+	}
+}
+
+func TestHandle_NoBody(t *testing.T) {
+	type getReq struct {
+		ID string `path:"id"`
+	}
+	app := NewApp(testLogger(t))
+	app.HandleFunc("GET", "/items/{id}", Handle(func(ctx context.Context, req getReq) (map[string]string, error) {
+		return map[string]string{"id": req.ID}, nil
+	}))
+
+	rr := serve(app, "GET", "/items/x1")
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"id":"x1"}`, rr.Body.String())
+}
+
+func TestHandle_NotAcceptable(t *testing.T) {
+	app := newHandleApp(t, func(ctx context.Context, req updateUserReq) (userResp, error) {
+		return userResp{ID: req.ID}, nil
+	})
+
+	req := httptest.NewRequest("PUT", "/users/1", strings.NewReader(`{"name":"Al"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Tenant", "acme")
+	req.Header.Set("Accept", "image/png")
+	rr := httptest.NewRecorder()
+	app.ServeHTTP(rr, req)
+
+	require.Equal(t, http.StatusNotAcceptable, rr.Code)
+	assert.Equal(t, "application/problem+json", rr.Header().Get("Content-Type"))
+}
+
+func TestHandle_StructNotSentAsPlainText(t *testing.T) {
+	app := newHandleApp(t, func(ctx context.Context, req updateUserReq) (userResp, error) {
+		return userResp{ID: req.ID, Name: req.Name}, nil
+	})
+
+	for accept, want := range map[string]int{
+		"text/plain":            http.StatusNotAcceptable,
+		"text/plain, */*;q=0.5": http.StatusOK,
+	} {
+		req := httptest.NewRequest("PUT", "/users/1", strings.NewReader(`{"name":"Al"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Tenant", "acme")
+		req.Header.Set("Accept", accept)
+		rr := httptest.NewRecorder()
+		app.ServeHTTP(rr, req)
+
+		require.Equal(t, want, rr.Code, accept)
+		assert.NotEmpty(t, rr.Body.String(), accept)
+		assert.NotEqual(t, "text/plain", rr.Header().Get("Content-Type"), accept)
+	}
+}
@@ -0,0 +1,235 @@
+package httpx
+
+import (
+	"encoding"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	durationType        = reflect.TypeFor[time.Duration]()
+	timeType            = reflect.TypeFor[time.Time]()
+	uuidType            = reflect.TypeFor[uuid.UUID]()
+	textUnmarshalerType = reflect.TypeFor[encoding.TextUnmarshaler]()
+)
+
+// Bind fills the fields of the struct pointed to by dst that are tagged with
+// path:"name", query:"name", header:"Name" or cookie:"name" from r, e.g.
+//
+//	type listParams struct {
+//		OrgID  uuid.UUID     `path:"org"`
+//		Limit  int           `query:"limit" default:"50"`
+//		Tags   []string      `query:"tag"`
+//		Since  *time.Time    `query:"since"`
+//		Wait   time.Duration `header:"X-Wait"`
+//		Locale string        `cookie:"locale" default:"en"`
+//	}
+//
+// Fields may be strings, bools, integers, floats, time.Duration, time.Time
+// (RFC 3339, or the layout in a layout tag), uuid.UUID, any
+// encoding.TextUnmarshaler, pointers to those, which stay nil when the
+// parameter is absent, and slices of those, which take every value of a
+// repeated parameter. The default tag is used when the parameter is absent
+// and the field is still zero, e.g. not set by a decoded body; for slices it
+// is split at commas. Fields of embedded structs are bound as well.
+//
+// Conversion failures are returned together as FieldErrors named after the
+// parameter, which NewProblem renders as a 400 validation problem. Fields of
+// unsupported types are programming errors and cause a panic. dst values that
+// aren't pointers to structs are left alone.
+func Bind(r *http.Request, dst any) error {
+	rv := reflect.ValueOf(dst)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return nil
+	}
+
+	query := r.URL.Query()
+	params := func(sf reflect.StructField) (string, []string) {
+		if name := sf.Tag.Get("path"); name != "" {
+			if v := r.PathValue(name); v != "" {
+				return name, []string{v}
+			}
+			return name, nil
+		}
+		if name := sf.Tag.Get("query"); name != "" {
+			return name, query[name]
+		}
+		if name := sf.Tag.Get("header"); name != "" {
+			return name, r.Header.Values(name)
+		}
+		if name := sf.Tag.Get("cookie"); name != "" {
+			var values []string
+			for _, c := range r.CookiesNamed(name) {
+				values = append(values, c.Value)
+			}
+			return name, values
+		}
+		return "", nil
+	}
+
+	var fe FieldErrors
+	bindFields(rv.Elem(), params, nil, &fe)
+	if len(fe) > 0 {
+		return fe
+	}
+	return nil
+}
+
+// valueSource returns the name of the parameter a field is bound from and
+// its values, or "" for fields that aren't bound.
+type valueSource func(sf reflect.StructField) (name string, values []string)
+
+// fileSource binds the file parameter name to a *FormFile or []*FormFile
+// field v.
+type fileSource func(name string, sf reflect.StructField, v reflect.Value) error
+
+// bindFields binds the fields of the struct rv, and of embedded structs, from
+// values, and file fields from files, collecting conversion failures in fe.
+func bindFields(rv reflect.Value, values valueSource, files fileSource, fe *FieldErrors) {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		sf := rt.Field(i)
+		if sf.Anonymous && sf.Type.Kind() == reflect.Struct {
+			bindFields(rv.Field(i), values, files, fe)
+			continue
+		}
+		if !sf.IsExported() {
+			continue
+		}
+
+		name, vals := values(sf)
+		if name == "" {
+			continue
+		}
+
+		if isFileType(sf.Type) {
+			if files == nil {
+				panic(fmt.Sprintf("httpx: cannot bind parameter to field of type %s", sf.Type))
+			}
+			if err := files(name, sf, rv.Field(i)); err != nil {
+				*fe = append(*fe, FieldError{Field: name, Err: err.Error()})
+			}
+			continue
+		}
+
+		if len(vals) == 0 {
+			def, ok := sf.Tag.Lookup("default")
+			if !ok || !rv.Field(i).IsZero() {
+				continue
+			}
+			vals = []string{def}
+			if sf.Type.Kind() == reflect.Slice && !isScalar(sf.Type) {
+				vals = strings.Split(def, ",")
+			}
+		}
+
+		if err := bindField(rv.Field(i), vals, sf.Tag.Get("layout")); err != nil {
+			*fe = append(*fe, FieldError{Field: name, Err: err.Error()})
+		}
+	}
+}
+
+func bindField(v reflect.Value, values []string, layout string) error {
+	switch {
+	case v.Kind() == reflect.Slice && !isScalar(v.Type()):
+		s := reflect.MakeSlice(v.Type(), len(values), len(values))
+		for i, raw := range values {
+			if err := bindValue(s.Index(i), raw, layout); err != nil {
+				return err
+			}
+		}
+		v.Set(s)
+		return nil
+
+	case v.Kind() == reflect.Pointer:
+		p := reflect.New(v.Type().Elem())
+		if err := bindValue(p.Elem(), values[0], layout); err != nil {
+			return err
+		}
+		v.Set(p)
+		return nil
+	}
+	return bindValue(v, values[0], layout)
+}
+
+// isScalar reports whether t is bound from a single value even though it is
+// a slice, such as a TextUnmarshaler implemented on a byte slice.
+func isScalar(t reflect.Type) bool {
+	return reflect.PointerTo(t).Implements(textUnmarshalerType)
+}
+
+func bindValue(v reflect.Value, raw string, layout string) error {
+	switch v.Type() {
+	case durationType:
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return fmt.Errorf("must be a duration such as 1m30s")
+		}
+		v.SetInt(int64(d))
+		return nil
+
+	case timeType:
+		if layout == "" {
+			layout = time.RFC3339
+		}
+		t, err := time.Parse(layout, raw)
+		if err != nil {
+			return fmt.Errorf("must be a time formatted as %s", layout)
+		}
+		v.Set(reflect.ValueOf(t))
+		return nil
+
+	case uuidType:
+		id, err := uuid.Parse(raw)
+		if err != nil {
+			return fmt.Errorf("must be a UUID")
+		}
+		v.Set(reflect.ValueOf(id))
+		return nil
+	}
+
+	if tu, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		if err := tu.UnmarshalText([]byte(raw)); err != nil {
+			return fmt.Errorf("invalid value: %w", err)
+		}
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("must be a boolean")
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("must be an integer")
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(raw, 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("must be a non-negative integer")
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(raw, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("must be a number")
+		}
+		v.SetFloat(f)
+	default:
+		panic(fmt.Sprintf("httpx: cannot bind parameter to field of type %s", v.Type()))
+	}
+	return nil
+}
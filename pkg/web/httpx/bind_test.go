@@ -0,0 +1,123 @@
+package httpx
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type pageParams struct {
+	Limit  int    `query:"limit" default:"50"`
+	Cursor string `query:"cursor"`
+}
+
+type listParams struct {
+	pageParams
+	OrgID   uuid.UUID     `path:"org"`
+	Tags    []string      `query:"tag"`
+	IDs     []int         `query:"id"`
+	States  []string      `query:"state" default:"open,pending"`
+	Since   *time.Time    `query:"since"`
+	Until   *time.Time    `query:"until"`
+	Day     time.Time     `query:"day" layout:"2006-01-02"`
+	Verbose bool          `query:"verbose"`
+	Wait    time.Duration `header:"X-Wait"`
+	Client  netip.Addr    `header:"X-Client-IP"`
+	Locale  string        `cookie:"locale" default:"en"`
+	Session string        `cookie:"session"`
+	ignored string        `query:"ignored"`
+}
+
+// bindRequest serves target through a mux registered for pattern so path
+// values are set.
+func bindRequest(t *testing.T, pattern, target string, mod func(r *http.Request), dst any) error {
+	t.Helper()
+	var err error
+	mux := http.NewServeMux()
+	mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+		err = Bind(r, dst)
+	})
+	req := httptest.NewRequest("GET", target, nil)
+	if mod != nil {
+		mod(req)
+	}
+	mux.ServeHTTP(httptest.NewRecorder(), req)
+	return err
+}
+
+func TestBind_ConvertsTypes(t *testing.T) {
+	org := uuid.New()
+	var p listParams
+	err := bindRequest(t, "GET /orgs/{org}/items",
+		"/orgs/"+org.String()+"/items?tag=a&tag=b&id=1&id=2&since=2025-06-01T12:00:00Z&day=2025-06-02&verbose=true&cursor=c1&ignored=x",
+		func(r *http.Request) {
+			r.Header.Set("X-Wait", "1m30s")
+			r.Header.Set("X-Client-IP", "192.0.2.7")
+			r.AddCookie(&http.Cookie{Name: "session", Value: "s-1"})
+		}, &p)
+
+	require.NoError(t, err)
+	assert.Equal(t, org, p.OrgID)
+	assert.Equal(t, []string{"a", "b"}, p.Tags)
+	assert.Equal(t, []int{1, 2}, p.IDs)
+	assert.Equal(t, time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC), *p.Since)
+	assert.Nil(t, p.Until)
+	assert.Equal(t, time.Date(2025, 6, 2, 0, 0, 0, 0, time.UTC), p.Day)
+	assert.True(t, p.Verbose)
+	assert.Equal(t, 90*time.Second, p.Wait)
+	assert.Equal(t, netip.MustParseAddr("192.0.2.7"), p.Client)
+	assert.Equal(t, "s-1", p.Session)
+	assert.Equal(t, "c1", p.Cursor)
+	assert.Empty(t, p.ignored)
+
+	// Defaults.
+	assert.Equal(t, 50, p.Limit)
+	assert.Equal(t, []string{"open", "pending"}, p.States)
+	assert.Equal(t, "en", p.Locale)
+}
+
+func TestBind_DefaultsDontOverwriteValues(t *testing.T) {
+	p := pageParams{Limit: 10}
+
+	require.NoError(t, bindRequest(t, "GET /", "/", nil, &p))
+	assert.Equal(t, 10, p.Limit)
+
+	require.NoError(t, bindRequest(t, "GET /", "/?limit=20", nil, &p))
+	assert.Equal(t, 20, p.Limit)
+}
+
+func TestBind_AggregatesErrors(t *testing.T) {
+	var p listParams
+	err := bindRequest(t, "GET /orgs/{org}/items", "/orgs/nope/items?limit=x&id=1&id=two&since=yesterday&verbose=maybe",
+		func(r *http.Request) { r.Header.Set("X-Wait", "soon") }, &p)
+
+	require.True(t, IsFieldErrors(err))
+	assert.Equal(t, map[string]string{
+		"limit":   "must be an integer",
+		"org":     "must be a UUID",
+		"id":      "must be an integer",
+		"since":   "must be a time formatted as 2006-01-02T15:04:05Z07:00",
+		"verbose": "must be a boolean",
+		"X-Wait":  "must be a duration such as 1m30s",
+	}, GetFieldErrors(err).Fields())
+	assert.Equal(t, http.StatusBadRequest, NewProblem(err, http.StatusInternalServerError).Status)
+}
+
+func TestBind_IgnoresNonStructsAndPanicsOnUnsupportedTypes(t *testing.T) {
+	var m map[string]string
+	assert.NoError(t, bindRequest(t, "GET /", "/?a=b", nil, &m))
+	assert.NoError(t, bindRequest(t, "GET /", "/?a=b", nil, listParams{}))
+
+	var bad struct {
+		Ch chan int `query:"ch"`
+	}
+	assert.Panics(t, func() {
+		_ = Bind(httptest.NewRequest("GET", "/?ch=1", nil), &bad)
+	})
+}
@@ -13,6 +13,14 @@ type Values struct {
 	TraceID    string
 	Now        time.Time
 	StatusCode int
+
+	afterResponse []func()
+}
+
+// SetValues returns a copy of ctx carrying v. web.App installs a fresh Values
+// for every request it serves.
+func SetValues(ctx context.Context, v *Values) context.Context {
+	return context.WithValue(ctx, key, v)
 }
 
 // GetValues returns the values from the context.
@@ -36,3 +44,38 @@ func SetStatusCode(ctx context.Context, statusCode int) {
 
 	v.StatusCode = statusCode
 }
+
+// TraceID returns the trace ID of the request ctx belongs to. Its signature
+// matches logx.TraceIDFn, so passing it to logx.New stamps every log line
+// written during a request with that request's trace ID. Outside a request,
+// e.g. in background jobs, it returns "".
+func TraceID(ctx context.Context) string {
+	v, ok := ctx.Value(key).(*Values)
+	if !ok {
+		return ""
+	}
+	return v.TraceID
+}
+
+// AfterResponse registers fn to run once the response to the request ctx
+// belongs to was written, streams included, e.g. to release resources a
+// handler's response still needs after the middleware returned. Functions run
+// in reverse order of registration. It reports false outside a request served
+// by web.App, where nothing runs fn.
+func AfterResponse(ctx context.Context, fn func()) bool {
+	v, ok := ctx.Value(key).(*Values)
+	if !ok {
+		return false
+	}
+	v.afterResponse = append(v.afterResponse, fn)
+	return true
+}
+
+// RunAfterResponse runs the functions registered with AfterResponse. web.App
+// calls it once the response was written.
+func (v *Values) RunAfterResponse() {
+	for i := len(v.afterResponse) - 1; i >= 0; i-- {
+		v.afterResponse[i]()
+	}
+	v.afterResponse = nil
+}
@@ -0,0 +1,31 @@
+package httpx
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTraceID(t *testing.T) {
+	assert.Empty(t, TraceID(context.Background()))
+
+	ctx := SetValues(context.Background(), &Values{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736"})
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", TraceID(ctx))
+}
+
+func TestAfterResponse(t *testing.T) {
+	assert.False(t, AfterResponse(context.Background(), func() {}))
+
+	var v Values
+	ctx := SetValues(context.Background(), &v)
+	var calls []int
+	assert.True(t, AfterResponse(ctx, func() { calls = append(calls, 1) }))
+	assert.True(t, AfterResponse(ctx, func() { calls = append(calls, 2) }))
+	assert.Empty(t, calls)
+
+	v.RunAfterResponse()
+	assert.Equal(t, []int{2, 1}, calls)
+	v.RunAfterResponse()
+	assert.Equal(t, []int{2, 1}, calls)
+}
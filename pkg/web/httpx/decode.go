@@ -3,33 +3,53 @@ package httpx
 import (
 	"encoding/json"
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
-	"strings"
 )
 
 var ErrUnsupportedContentType = fmt.Errorf("unsupported content type")
 
-// Decode r.Body and use the Content-Type header to determine which decoder to use.
+// Decode r.Body and use the Content-Type header to determine which decoder to
+// use. Decoders are registered per media type with RegisterDecoder; JSON,
+// XML, plain text, url-encoded forms and multipart forms (see
+// MultipartDecoder) are supported out of the box. A body over the limit of
+// an http.MaxBytesReader is reported as a 413 RequestError, see
+// NewBodyTooLargeError.
 func Decode(r *http.Request, out any) error {
-	ct := r.Header.Get("Content-Type")
-	// normalize: drop optional charset and parameters
-	if i := strings.IndexByte(ct, ';'); i >= 0 {
-		ct = strings.TrimSpace(ct[:i])
+	dec, ok := lookupDecoder(r.Header.Get("Content-Type"))
+	if !ok {
+		return ErrUnsupportedContentType
+	}
+	var err error
+	if rd, ok := dec.(RequestDecoder); ok {
+		err = rd.DecodeRequest(r, out)
+	} else {
+		err = dec.Decode(r.Body, out)
+	}
+	if err != nil {
+		var mbe *http.MaxBytesError
+		if errors.As(err, &mbe) {
+			return NewBodyTooLargeError(mbe.Limit)
+		}
+		return err
 	}
+	return nil
+}
 
-	switch ct {
-	case "application/json", "application/vnd.api+json":
-		return decodeJSON(r.Body, out)
-	case "application/xml", "text/xml", "application/rss+xml", "application/atom+xml":
-		return decodeXML(r.Body, out)
-	case "text/plain", "":
-		// allow empty Content-Type as plain text
-		return decodeText(r.Body, out)
-	default:
-		return ErrUnsupportedContentType
+// DecodeError classifies an error returned by Decode for the Errors
+// middleware: an unsupported content type becomes a 415 RequestError and any
+// other failure a 400 one, while RequestErrors, such as the 413 for bodies
+// over the size limit, and FieldErrors are returned as is.
+func DecodeError(err error) error {
+	switch {
+	case err == nil, IsRequestError(err), IsFieldErrors(err):
+		return err
+	case errors.Is(err, ErrUnsupportedContentType):
+		return NewRequestError(err, http.StatusUnsupportedMediaType)
 	}
+	return NewRequestError(err, http.StatusBadRequest)
 }
 
 func decodeJSON(body io.Reader, out any) error {
@@ -1,6 +1,7 @@
 package httpx
 
 import (
+	"errors"
 	"net/http"
 	"strings"
 	"testing"
@@ -82,3 +83,42 @@ func TestUnsupportedContentType(t *testing.T) {
 	err := Decode(req, &out)
 	assert.ErrorIs(t, err, ErrUnsupportedContentType)
 }
+
+func TestDecode_BodyTooLarge(t *testing.T) {
+	req := newRequest(`{"name":"a long name","age":42}`, "application/json")
+	req.Body = http.MaxBytesReader(nil, req.Body, 10)
+
+	var out sampleJSON
+	err := Decode(req, &out)
+
+	assert.ErrorIs(t, err, ErrBodyTooLarge)
+	re := GetRequestError(err)
+	if assert.NotNil(t, re) {
+		assert.Equal(t, http.StatusRequestEntityTooLarge, re.Status)
+	}
+	assert.Equal(t, "request body too large: limit is 10 bytes", err.Error())
+
+	// DecodeAndValidate keeps the status.
+	req = newRequest(`{"name":"a long name","age":42}`, "application/json")
+	req.Body = http.MaxBytesReader(nil, req.Body, 10)
+	err = DecodeAndValidate(req, &out)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, GetRequestError(err).Status)
+}
+
+func TestDecodeError(t *testing.T) {
+	assert.NoError(t, DecodeError(nil))
+
+	tests := []struct {
+		err    error
+		status int
+	}{
+		{ErrUnsupportedContentType, http.StatusUnsupportedMediaType},
+		{NewBodyTooLargeError(10), http.StatusRequestEntityTooLarge},
+		{NewFieldError("age", errors.New("must be an integer")), http.StatusBadRequest},
+		{errors.New("json decode: unexpected EOF"), http.StatusBadRequest},
+	}
+	for _, tc := range tests {
+		err := DecodeError(tc.err)
+		assert.Equal(t, tc.status, NewProblem(err, 0).Status, tc.err.Error())
+	}
+}
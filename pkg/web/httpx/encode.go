@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"encoding/xml"
 	"fmt"
+	"reflect"
 )
 
 type Encoder interface {
@@ -14,32 +15,47 @@ type (
 	PlainTextEncoder struct{}
 	JSONEncoder      struct{}
 	XMLEncoder       struct{}
+	ProblemEncoder   struct{}
 	FileEncoder      struct{}
 )
 
+// NewEncoder returns the encoder registered under id, which is either a name
+// such as "json", "xml", "plaintext" or "problem", or a media type. It
+// returns nil for unknown ids.
 func NewEncoder(id string) Encoder {
-	var e Encoder
-	switch id {
-	case "plaintext":
-		e = &PlainTextEncoder{}
-	case "json":
-		e = &JSONEncoder{}
-	case "xml":
-		e = &XMLEncoder{}
-	case "file":
-		e = &FileEncoder{}
-	default:
-		return nil
+	registry.RLock()
+	defer registry.RUnlock()
+	if e, ok := registry.names[id]; ok {
+		return e
 	}
-	return e
+	return registry.encoders[normalizeMediaType(id)]
+}
+
+// SelectiveEncoder is implemented by encoders that handle only some values,
+// such as PlainTextEncoder. Content negotiation passes them over for values
+// they can't encode.
+type SelectiveEncoder interface {
+	Encoder
+	CanEncode(data any) bool
 }
 
 func (e *PlainTextEncoder) Encode(data any) ([]byte, string, error) {
-	str, ok := data.(string)
-	if !ok {
-		return nil, "", fmt.Errorf("encoder data is not a string")
+	switch d := data.(type) {
+	case string:
+		return []byte(d), "text/plain", nil
+	case []byte:
+		return d, "text/plain", nil
+	}
+	return nil, "", fmt.Errorf("encoder data is not a string")
+}
+
+// CanEncode reports whether data is a string or a byte slice.
+func (e *PlainTextEncoder) CanEncode(data any) bool {
+	switch data.(type) {
+	case string, []byte:
+		return true
 	}
-	return []byte(str), "text/plain", nil
+	return false
 }
 
 func (e *JSONEncoder) Encode(data any) ([]byte, string, error) {
@@ -52,7 +68,16 @@ func (e *XMLEncoder) Encode(data any) ([]byte, string, error) {
 	return enc, "application/xml", err
 }
 
-func (e *FileEncoder) Encode(data any) ([]byte, string, error) {
-	//TODO
-	return []byte{}, "", nil
+// CanEncode reports whether data isn't a map, which encoding/xml rejects.
+func (e *XMLEncoder) CanEncode(data any) bool {
+	t := reflect.TypeOf(data)
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t == nil || t.Kind() != reflect.Map
+}
+
+func (e *ProblemEncoder) Encode(data any) ([]byte, string, error) {
+	enc, err := json.Marshal(data)
+	return enc, "application/problem+json", err
 }
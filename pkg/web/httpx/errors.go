@@ -0,0 +1,217 @@
+package httpx
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Sentinel errors for common client failures. Wrap them to add context, e.g.
+// fmt.Errorf("user %s: %w", id, httpx.ErrNotFound); the wrapped message is
+// returned to the client as the problem detail.
+var (
+	ErrNotFound = errors.New("not found")
+	ErrConflict = errors.New("conflict")
+	// ErrBodyTooLarge is reported, wrapped in a 413 RequestError, for request
+	// bodies over the limit of an http.MaxBytesReader, see
+	// middleware.MaxBodySize.
+	ErrBodyTooLarge = errors.New("request body too large")
+)
+
+// RequestError is an error the client can act on, returned with Status.
+type RequestError struct {
+	Err    error
+	Status int
+	// Type optionally identifies the problem with a URI, see Problem.Type.
+	Type string
+}
+
+// NewRequestError wraps err so it is returned to the client with status.
+func NewRequestError(err error, status int) error {
+	return &RequestError{Err: err, Status: status}
+}
+
+func (re *RequestError) Error() string {
+	return re.Err.Error()
+}
+
+func (re *RequestError) Unwrap() error {
+	return re.Err
+}
+
+// NewBodyTooLargeError reports that the request body exceeds limit bytes
+// (413).
+func NewBodyTooLargeError(limit int64) error {
+	return NewRequestError(fmt.Errorf("%w: limit is %d bytes", ErrBodyTooLarge, limit), http.StatusRequestEntityTooLarge)
+}
+
+// IsRequestError reports whether err contains a *RequestError.
+func IsRequestError(err error) bool {
+	var re *RequestError
+	return errors.As(err, &re)
+}
+
+// GetRequestError returns the *RequestError in err, or nil.
+func GetRequestError(err error) *RequestError {
+	var re *RequestError
+	if !errors.As(err, &re) {
+		return nil
+	}
+	return re
+}
+
+// FieldError is a validation failure of a single request field.
+type FieldError struct {
+	Field string `json:"field"`
+	Err   string `json:"error"`
+}
+
+// FieldErrors is a collection of field validation failures, returned to the
+// client with status 400 (or 422, see NewFieldErrors).
+type FieldErrors []FieldError
+
+// NewFieldError returns FieldErrors holding a single failure of field.
+func NewFieldError(field string, err error) error {
+	return FieldErrors{{Field: field, Err: err.Error()}}
+}
+
+func (fe FieldErrors) Error() string {
+	msgs := make([]string, len(fe))
+	for i, f := range fe {
+		msgs[i] = fmt.Sprintf("%s: %s", f.Field, f.Err)
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Fields returns the failures keyed by field name.
+func (fe FieldErrors) Fields() map[string]string {
+	m := make(map[string]string, len(fe))
+	for _, f := range fe {
+		m[f.Field] = f.Err
+	}
+	return m
+}
+
+// IsFieldErrors reports whether err contains FieldErrors.
+func IsFieldErrors(err error) bool {
+	var fe FieldErrors
+	return errors.As(err, &fe)
+}
+
+// GetFieldErrors returns the FieldErrors in err, or nil.
+func GetFieldErrors(err error) FieldErrors {
+	var fe FieldErrors
+	if !errors.As(err, &fe) {
+		return nil
+	}
+	return fe
+}
+
+// AuthError is an authentication or authorization failure. Its message is
+// not returned to the client, which only sees the status text.
+type AuthError struct {
+	Err    error
+	Status int
+}
+
+// NewAuthError reports that the request could not be authenticated (401).
+func NewAuthError(format string, args ...any) error {
+	return &AuthError{Err: fmt.Errorf(format, args...), Status: http.StatusUnauthorized}
+}
+
+// NewForbiddenError reports that the authenticated caller is not allowed to
+// perform the request (403).
+func NewForbiddenError(format string, args ...any) error {
+	return &AuthError{Err: fmt.Errorf(format, args...), Status: http.StatusForbidden}
+}
+
+func (ae *AuthError) Error() string {
+	return ae.Err.Error()
+}
+
+func (ae *AuthError) Unwrap() error {
+	return ae.Err
+}
+
+// IsAuthError reports whether err contains an *AuthError.
+func IsAuthError(err error) bool {
+	var ae *AuthError
+	return errors.As(err, &ae)
+}
+
+// Problem is an RFC 9457 problem details object.
+type Problem struct {
+	// Type is a URI identifying the problem type. "about:blank" means the
+	// problem has no semantics beyond the status code.
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	TraceID  string `json:"trace_id,omitempty"`
+	// Errors lists the failed fields of a validation problem.
+	Errors FieldErrors `json:"errors,omitempty"`
+}
+
+// NewProblem translates err into a Problem. Typed errors determine the status;
+// any other error gets status, or 500 if status is not an error status.
+// Details of 5xx errors are never included, so internal failures don't leak
+// to clients.
+func NewProblem(err error, status int) Problem {
+	if status < http.StatusBadRequest {
+		status = http.StatusInternalServerError
+	}
+	p := Problem{Type: "about:blank"}
+
+	switch {
+	case IsFieldErrors(err):
+		status = http.StatusBadRequest
+		if re := GetRequestError(err); re != nil {
+			status = re.Status
+		}
+		p.Detail = "data validation error"
+		p.Errors = GetFieldErrors(err)
+
+	case IsRequestError(err):
+		re := GetRequestError(err)
+		status = re.Status
+		p.Detail = re.Error()
+		if re.Type != "" {
+			p.Type = re.Type
+		}
+
+	case IsAuthError(err):
+		var ae *AuthError
+		errors.As(err, &ae)
+		status = ae.Status
+
+	case errors.Is(err, ErrNotFound):
+		status = http.StatusNotFound
+		p.Detail = err.Error()
+
+	case errors.Is(err, ErrConflict):
+		status = http.StatusConflict
+		p.Detail = err.Error()
+
+	case status < http.StatusInternalServerError:
+		p.Detail = err.Error()
+	}
+
+	p.Status = status
+	p.Title = http.StatusText(status)
+	if status >= http.StatusInternalServerError {
+		p.Detail = ""
+		p.Errors = nil
+	}
+	return p
+}
+
+// ProblemResponse returns a response encoding p as application/problem+json.
+func ProblemResponse(p Problem) Response {
+	return Response{
+		StatusCode: p.Status,
+		Data:       p,
+		Encoder:    NewEncoder("problem"),
+	}
+}
@@ -0,0 +1,132 @@
+package httpx
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewProblem(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		status     int
+		wantStatus int
+		wantDetail string
+		wantFields FieldErrors
+	}{
+		{
+			name:       "request error",
+			err:        NewRequestError(errors.New("name is too long"), http.StatusBadRequest),
+			wantStatus: http.StatusBadRequest,
+			wantDetail: "name is too long",
+		},
+		{
+			name:       "wrapped request error",
+			err:        fmt.Errorf("create: %w", NewRequestError(errors.New("quota exceeded"), http.StatusTooManyRequests)),
+			status:     http.StatusInternalServerError,
+			wantStatus: http.StatusTooManyRequests,
+			wantDetail: "quota exceeded",
+		},
+		{
+			name:       "field errors",
+			err:        FieldErrors{{Field: "email", Err: "is required"}},
+			wantStatus: http.StatusBadRequest,
+			wantDetail: "data validation error",
+			wantFields: FieldErrors{{Field: "email", Err: "is required"}},
+		},
+		{
+			name:       "field errors with status",
+			err:        NewRequestError(NewFieldError("age", errors.New("must be positive")), http.StatusUnprocessableEntity),
+			wantStatus: http.StatusUnprocessableEntity,
+			wantDetail: "data validation error",
+			wantFields: FieldErrors{{Field: "age", Err: "must be positive"}},
+		},
+		{
+			name:       "auth error hides detail",
+			err:        NewAuthError("token expired at %d", 123),
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "forbidden",
+			err:        NewForbiddenError("missing role admin"),
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "not found",
+			err:        fmt.Errorf("user 42: %w", ErrNotFound),
+			wantStatus: http.StatusNotFound,
+			wantDetail: "user 42: not found",
+		},
+		{
+			name:       "conflict",
+			err:        fmt.Errorf("email taken: %w", ErrConflict),
+			wantStatus: http.StatusConflict,
+			wantDetail: "email taken: conflict",
+		},
+		{
+			name:       "untyped client status",
+			err:        errors.New("bad range"),
+			status:     http.StatusRequestedRangeNotSatisfiable,
+			wantStatus: http.StatusRequestedRangeNotSatisfiable,
+			wantDetail: "bad range",
+		},
+		{
+			name:       "untyped hides internals",
+			err:        errors.New("pq: connection refused"),
+			wantStatus: http.StatusInternalServerError,
+		},
+		{
+			name:       "5xx request error hides detail",
+			err:        NewRequestError(errors.New("upstream secret"), http.StatusBadGateway),
+			wantStatus: http.StatusBadGateway,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			p := NewProblem(tc.err, tc.status)
+			assert.Equal(t, "about:blank", p.Type)
+			assert.Equal(t, tc.wantStatus, p.Status)
+			assert.Equal(t, http.StatusText(tc.wantStatus), p.Title)
+			assert.Equal(t, tc.wantDetail, p.Detail)
+			assert.Equal(t, tc.wantFields, p.Errors)
+		})
+	}
+}
+
+func TestNewProblem_CustomType(t *testing.T) {
+	err := &RequestError{Err: errors.New("out of credit"), Status: http.StatusForbidden, Type: "https://example.com/probs/out-of-credit"}
+	p := NewProblem(err, 0)
+	assert.Equal(t, "https://example.com/probs/out-of-credit", p.Type)
+	assert.Equal(t, http.StatusForbidden, p.Status)
+}
+
+func TestErrorResponse_EncodesProblem(t *testing.T) {
+	w := httptest.NewRecorder()
+	err := Respond(context.Background(), w, ErrorResponse(fmt.Errorf("order 7: %w", ErrNotFound), http.StatusInternalServerError))
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{"type":"about:blank","title":"Not Found","status":404,"detail":"order 7: not found"}`, w.Body.String())
+}
+
+func TestRespond_UntranslatedError(t *testing.T) {
+	w := httptest.NewRecorder()
+	err := Respond(context.Background(), w, Response{Err: errors.New("PANIC [boom]")})
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	var p Problem
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &p))
+	assert.Equal(t, "Internal Server Error", p.Title)
+	assert.Empty(t, p.Detail)
+}
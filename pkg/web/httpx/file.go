@@ -0,0 +1,224 @@
+package httpx
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// StreamEncoder is implemented by encoders that write the response body
+// incrementally instead of returning it as a []byte. Respond calls EncodeTo
+// in place of Encode; it writes the headers, status and body itself and may
+// choose a different status, e.g. 206 for a range or 304 when the client's
+// copy is current.
+type StreamEncoder interface {
+	Encoder
+	EncodeTo(w http.ResponseWriter, statusCode int, data any) error
+}
+
+// File describes content streamed to the client by FileResponse.
+type File struct {
+	// Content is the body. If it implements io.ReadSeeker, range and
+	// conditional requests are supported and Content-Length is set. If it
+	// implements io.Closer it is closed once the response is written.
+	Content io.Reader
+	// Name is the file name offered to the client. Its extension selects the
+	// Content-Type when ContentType is empty; otherwise the type is sniffed.
+	Name string
+	// ContentType overrides the detected media type.
+	ContentType string
+	// Size is the length of a Content that isn't an io.Seeker, or 0 if
+	// unknown.
+	Size int64
+	// ModTime sets Last-Modified and is compared with If-Modified-Since.
+	ModTime time.Time
+	// ETag, a quoted entity tag such as `"v1"` or `W/"v1"`, is compared with
+	// If-None-Match and If-Range.
+	ETag string
+	// Attachment asks the client to save the file rather than display it.
+	Attachment bool
+	// Request is the request being answered; FileResponse sets it. Without
+	// it range and conditional headers are ignored.
+	Request *http.Request
+}
+
+// FileResponse returns a response streaming f to the client.
+func FileResponse(r *http.Request, f File) Response {
+	f.Request = r
+	return Response{
+		StatusCode: http.StatusOK,
+		Data:       f,
+		Encoder:    NewEncoder("file"),
+	}
+}
+
+// FSFileResponse returns a response streaming the file name from fsys, with
+// its modification time and a weak ETag derived from its size and
+// modification time. Missing files and directories are reported as
+// ErrNotFound.
+func FSFileResponse(r *http.Request, fsys fs.FS, name string, attachment bool) Response {
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	if name == "" {
+		name = "."
+	}
+
+	f, err := fsys.Open(name)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) || errors.Is(err, fs.ErrInvalid) {
+			return ErrorResponse(fmt.Errorf("%s: %w", name, ErrNotFound), http.StatusNotFound)
+		}
+		return ErrorResponse(fmt.Errorf("open %s: %w", name, err), http.StatusInternalServerError)
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return ErrorResponse(fmt.Errorf("stat %s: %w", name, err), http.StatusInternalServerError)
+	}
+	if fi.IsDir() {
+		_ = f.Close()
+		return ErrorResponse(fmt.Errorf("%s: %w", name, ErrNotFound), http.StatusNotFound)
+	}
+
+	return FileResponse(r, File{
+		Content:    f,
+		Name:       fi.Name(),
+		Size:       fi.Size(),
+		ModTime:    fi.ModTime(),
+		ETag:       fmt.Sprintf(`W/"%x-%x"`, fi.Size(), fi.ModTime().UnixNano()),
+		Attachment: attachment,
+	})
+}
+
+// Encode reads the whole file into memory. Respond streams it with EncodeTo
+// instead.
+func (e *FileEncoder) Encode(data any) ([]byte, string, error) {
+	f, ok := data.(File)
+	if !ok {
+		return nil, "", fmt.Errorf("encoder data is not a httpx.File")
+	}
+	if c, ok := f.Content.(io.Closer); ok {
+		defer c.Close()
+	}
+
+	b, err := io.ReadAll(f.Content)
+	if err != nil {
+		return nil, "", fmt.Errorf("read file: %w", err)
+	}
+
+	ct := f.ContentType
+	if ct == "" {
+		ct = mime.TypeByExtension(path.Ext(f.Name))
+	}
+	if ct == "" {
+		ct = http.DetectContentType(b)
+	}
+	return b, ct, nil
+}
+
+// EncodeTo streams the File in data to w.
+func (e *FileEncoder) EncodeTo(w http.ResponseWriter, statusCode int, data any) error {
+	f, ok := data.(File)
+	if !ok {
+		return fmt.Errorf("encoder data is not a httpx.File")
+	}
+	if c, ok := f.Content.(io.Closer); ok {
+		defer c.Close()
+	}
+
+	// Large downloads outlive the server's WriteTimeout, so lift it when the
+	// writer supports deadlines.
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	h := w.Header()
+	if f.Name != "" {
+		disposition := "inline"
+		if f.Attachment {
+			disposition = "attachment"
+		}
+		h.Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": f.Name}))
+	}
+	if f.ContentType != "" {
+		h.Set("Content-Type", f.ContentType)
+	}
+	if f.ETag != "" {
+		h.Set("ETag", f.ETag)
+	}
+
+	// Seekable content gets the full treatment of the standard library:
+	// single and multipart ranges, HEAD and all conditional headers.
+	if rs, ok := f.Content.(io.ReadSeeker); ok && f.Request != nil && statusCode == http.StatusOK {
+		http.ServeContent(w, f.Request, f.Name, f.ModTime, rs)
+		return nil
+	}
+
+	if !f.ModTime.IsZero() {
+		h.Set("Last-Modified", f.ModTime.UTC().Format(http.TimeFormat))
+	}
+	if statusCode == http.StatusOK && notModified(f) {
+		h.Del("Content-Type")
+		w.WriteHeader(http.StatusNotModified)
+		return nil
+	}
+
+	body := bufio.NewReader(f.Content)
+	if h.Get("Content-Type") == "" {
+		ct := mime.TypeByExtension(path.Ext(f.Name))
+		if ct == "" {
+			// Peek returns what it could read along with io.EOF for short
+			// content, which is still enough to sniff.
+			head, _ := body.Peek(512)
+			ct = http.DetectContentType(head)
+		}
+		h.Set("Content-Type", ct)
+	}
+	if f.Size > 0 {
+		h.Set("Content-Length", strconv.FormatInt(f.Size, 10))
+	}
+	h.Set("Accept-Ranges", "none")
+	w.WriteHeader(statusCode)
+
+	if f.Request != nil && f.Request.Method == http.MethodHead {
+		return nil
+	}
+	if _, err := io.Copy(w, body); err != nil {
+		return fmt.Errorf("stream file: %w", err)
+	}
+	return nil
+}
+
+// notModified evaluates If-None-Match, or else If-Modified-Since, for GET and
+// HEAD requests.
+func notModified(f File) bool {
+	r := f.Request
+	if r == nil || (r.Method != http.MethodGet && r.Method != http.MethodHead) {
+		return false
+	}
+
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		if f.ETag == "" {
+			return false
+		}
+		for _, tag := range strings.Split(inm, ",") {
+			tag = strings.TrimSpace(tag)
+			if tag == "*" || strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(f.ETag, "W/") {
+				return true
+			}
+		}
+		return false
+	}
+
+	if ims := r.Header.Get("If-Modified-Since"); ims != "" && !f.ModTime.IsZero() {
+		t, err := http.ParseTime(ims)
+		return err == nil && !f.ModTime.Truncate(time.Second).After(t)
+	}
+	return false
+}
@@ -0,0 +1,227 @@
+package httpx
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var modTime = time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func respondFile(t *testing.T, req *http.Request, resp Response) (*httptest.ResponseRecorder, *Values) {
+	t.Helper()
+	v := &Values{}
+	ctx := SetValues(req.Context(), v)
+	w := httptest.NewRecorder()
+	require.NoError(t, Respond(ctx, w, resp))
+	return w, v
+}
+
+func TestFileResponse_Seekable(t *testing.T) {
+	content := "hello, world"
+	newReq := func(headers ...string) *http.Request {
+		req := httptest.NewRequest("GET", "/report.txt", nil)
+		for i := 0; i+1 < len(headers); i += 2 {
+			req.Header.Set(headers[i], headers[i+1])
+		}
+		return req
+	}
+	file := func(req *http.Request) Response {
+		return FileResponse(req, File{
+			Content:    strings.NewReader(content),
+			Name:       "report.txt",
+			ModTime:    modTime,
+			ETag:       `"v1"`,
+			Attachment: true,
+		})
+	}
+
+	t.Run("full", func(t *testing.T) {
+		req := newReq()
+		w, v := respondFile(t, req, file(req))
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, content, w.Body.String())
+		assert.Equal(t, "text/plain; charset=utf-8", w.Header().Get("Content-Type"))
+		assert.Equal(t, "12", w.Header().Get("Content-Length"))
+		assert.Equal(t, `attachment; filename=report.txt`, w.Header().Get("Content-Disposition"))
+		assert.Equal(t, `"v1"`, w.Header().Get("ETag"))
+		assert.Equal(t, "bytes", w.Header().Get("Accept-Ranges"))
+		assert.Equal(t, http.StatusOK, v.StatusCode)
+	})
+
+	t.Run("range", func(t *testing.T) {
+		req := newReq("Range", "bytes=0-4")
+		w, v := respondFile(t, req, file(req))
+		assert.Equal(t, http.StatusPartialContent, w.Code)
+		assert.Equal(t, "hello", w.Body.String())
+		assert.Equal(t, "bytes 0-4/12", w.Header().Get("Content-Range"))
+		assert.Equal(t, http.StatusPartialContent, v.StatusCode)
+	})
+
+	t.Run("multi range", func(t *testing.T) {
+		req := newReq("Range", "bytes=0-4,7-11")
+		w, _ := respondFile(t, req, file(req))
+		assert.Equal(t, http.StatusPartialContent, w.Code)
+		assert.Contains(t, w.Header().Get("Content-Type"), "multipart/byteranges")
+		assert.Contains(t, w.Body.String(), "hello")
+		assert.Contains(t, w.Body.String(), "world")
+	})
+
+	t.Run("unsatisfiable range", func(t *testing.T) {
+		req := newReq("Range", "bytes=100-200")
+		w, _ := respondFile(t, req, file(req))
+		assert.Equal(t, http.StatusRequestedRangeNotSatisfiable, w.Code)
+	})
+
+	t.Run("if-none-match", func(t *testing.T) {
+		req := newReq("If-None-Match", `"v0", "v1"`)
+		w, v := respondFile(t, req, file(req))
+		assert.Equal(t, http.StatusNotModified, w.Code)
+		assert.Empty(t, w.Body.String())
+		assert.Equal(t, http.StatusNotModified, v.StatusCode)
+	})
+
+	t.Run("if-modified-since", func(t *testing.T) {
+		req := newReq("If-Modified-Since", modTime.Add(time.Hour).Format(http.TimeFormat))
+		w, _ := respondFile(t, req, file(req))
+		assert.Equal(t, http.StatusNotModified, w.Code)
+	})
+}
+
+type closeTracker struct {
+	io.Reader
+	closed bool
+}
+
+func (c *closeTracker) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestFileResponse_Reader(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\n rest of image")
+
+	t.Run("sniffed and streamed", func(t *testing.T) {
+		body := &closeTracker{Reader: bytes.NewReader(png)}
+		req := httptest.NewRequest("GET", "/img", nil)
+		w, _ := respondFile(t, req, FileResponse(req, File{Content: io.MultiReader(body), Name: "img", Size: int64(len(png))}))
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "image/png", w.Header().Get("Content-Type"))
+		assert.Equal(t, "inline; filename=img", w.Header().Get("Content-Disposition"))
+		assert.Equal(t, "22", w.Header().Get("Content-Length"))
+		assert.Equal(t, "none", w.Header().Get("Accept-Ranges"))
+		assert.Equal(t, png, w.Body.Bytes())
+	})
+
+	t.Run("closed after streaming", func(t *testing.T) {
+		body := &closeTracker{Reader: strings.NewReader("a,b\n")}
+		req := httptest.NewRequest("GET", "/x.csv", nil)
+		w, _ := respondFile(t, req, FileResponse(req, File{Content: body, ContentType: "text/csv"}))
+		assert.Equal(t, "text/csv", w.Header().Get("Content-Type"))
+		assert.Empty(t, w.Header().Get("Content-Disposition"))
+		assert.True(t, body.closed)
+	})
+
+	t.Run("etag", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/img", nil)
+		req.Header.Set("If-None-Match", `"abc"`)
+		w, _ := respondFile(t, req, FileResponse(req, File{Content: io.MultiReader(bytes.NewReader(png)), ETag: `W/"abc"`}))
+		assert.Equal(t, http.StatusNotModified, w.Code)
+		assert.Empty(t, w.Body.Bytes())
+	})
+
+	t.Run("head", func(t *testing.T) {
+		req := httptest.NewRequest("HEAD", "/img", nil)
+		w, _ := respondFile(t, req, FileResponse(req, File{Content: io.MultiReader(bytes.NewReader(png))}))
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "image/png", w.Header().Get("Content-Type"))
+		assert.Empty(t, w.Body.Bytes())
+	})
+}
+
+// slowReader returns n bytes, one per read after a delay.
+type slowReader struct {
+	n     int
+	delay time.Duration
+}
+
+func (r *slowReader) Read(p []byte) (int, error) {
+	if r.n == 0 {
+		return 0, io.EOF
+	}
+	time.Sleep(r.delay)
+	r.n--
+	p[0] = 'x'
+	return 1, nil
+}
+
+func TestFileResponse_OutlivesWriteTimeout(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resp := FileResponse(r, File{Content: &slowReader{n: 5, delay: 40 * time.Millisecond}, ContentType: "text/plain"})
+		_ = Respond(r.Context(), w, resp)
+	}))
+	srv.Config.WriteTimeout = 50 * time.Millisecond
+	srv.Start()
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "xxxxx", string(body))
+}
+
+func TestFSFileResponse(t *testing.T) {
+	fsys := fstest.MapFS{
+		"docs/guide.html": {Data: []byte("<h1>Guide</h1>"), ModTime: modTime},
+		"docs/sub/x.txt":  {Data: []byte("x")},
+	}
+
+	req := httptest.NewRequest("GET", "/docs/guide.html", nil)
+	w, _ := respondFile(t, req, FSFileResponse(req, fsys, "/docs/../docs/guide.html", false))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "<h1>Guide</h1>", w.Body.String())
+	assert.Equal(t, "text/html; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Equal(t, modTime.Format(http.TimeFormat), w.Header().Get("Last-Modified"))
+	etag := w.Header().Get("ETag")
+	require.NotEmpty(t, etag)
+
+	req = httptest.NewRequest("GET", "/docs/guide.html", nil)
+	req.Header.Set("If-None-Match", etag)
+	w, _ = respondFile(t, req, FSFileResponse(req, fsys, "docs/guide.html", false))
+	assert.Equal(t, http.StatusNotModified, w.Code)
+
+	for _, name := range []string{"missing.txt", "docs", "docs/sub", "../etc/passwd"} {
+		resp := FSFileResponse(req, fsys, name, false)
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode, name)
+		assert.ErrorIs(t, resp.Err, ErrNotFound, name)
+	}
+}
+
+func TestFileEncoder_Encode(t *testing.T) {
+	data, ct, err := NewEncoder("file").Encode(File{Content: strings.NewReader("{}"), Name: "a.json"})
+	require.NoError(t, err)
+	assert.Equal(t, "{}", string(data))
+	assert.Equal(t, "application/json", ct)
+
+	_, _, err = NewEncoder("file").Encode("nope")
+	assert.Error(t, err)
+}
+
+func TestRespond_StreamEncoderNoValues(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	require.NoError(t, Respond(context.Background(), w, FileResponse(req, File{Content: strings.NewReader("x")})))
+	assert.Equal(t, "x", w.Body.String())
+}
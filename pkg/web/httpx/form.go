@@ -0,0 +1,406 @@
+package httpx
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"os"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	// DefaultMaxFormSize limits url-encoded form bodies, like
+	// http.Request.ParseForm does, and the non-file fields of multipart
+	// bodies.
+	DefaultMaxFormSize = 10 << 20
+	// DefaultMultipartMemory is how many bytes of uploaded files a
+	// MultipartDecoder keeps in memory by default before spilling them to
+	// temporary files.
+	DefaultMultipartMemory = 32 << 20
+	// maxFormParts limits the number of parts of a multipart body, like
+	// multipart.Reader.ReadForm does.
+	maxFormParts = 1000
+)
+
+var (
+	formFileType      = reflect.TypeFor[*FormFile]()
+	formFileSliceType = reflect.TypeFor[[]*FormFile]()
+)
+
+// FormFile is a file uploaded in a multipart/form-data body. Small files are
+// held in memory and larger ones in a temporary file, which is removed when
+// the request ends.
+type FormFile struct {
+	Filename string
+	Size     int64
+	// ContentType is sniffed from the content, falling back to the type the
+	// client declared when sniffing is inconclusive.
+	ContentType string
+	Header      textproto.MIMEHeader
+
+	content []byte
+	tmpfile string
+}
+
+// Open returns a reader for the file's content. Close it when done.
+func (f *FormFile) Open() (multipart.File, error) {
+	if f.tmpfile != "" {
+		return os.Open(f.tmpfile)
+	}
+	return sectionReadCloser{io.NewSectionReader(bytes.NewReader(f.content), 0, int64(len(f.content)))}, nil
+}
+
+type sectionReadCloser struct {
+	*io.SectionReader
+}
+
+func (sectionReadCloser) Close() error { return nil }
+
+// RequestDecoder is implemented by decoders that need more of the request
+// than its body, such as the boundary parameter of a multipart Content-Type.
+// Decode calls DecodeRequest instead of Decode for them.
+type RequestDecoder interface {
+	Decoder
+	DecodeRequest(r *http.Request, out any) error
+}
+
+// decodeForm decodes an application/x-www-form-urlencoded body into out, a
+// *url.Values or a pointer to a struct with form tags, see bindForm.
+func decodeForm(body io.Reader, out any) error {
+	b, err := io.ReadAll(io.LimitReader(body, DefaultMaxFormSize+1))
+	if err != nil {
+		return fmt.Errorf("read body: %w", err)
+	}
+	if len(b) > DefaultMaxFormSize {
+		return NewBodyTooLargeError(DefaultMaxFormSize)
+	}
+
+	values, err := url.ParseQuery(string(b))
+	if err != nil {
+		return fmt.Errorf("form decode: %w", err)
+	}
+	return bindForm(values, nil, out)
+}
+
+// MultipartDecoder decodes multipart/form-data bodies into out, a
+// *url.Values holding the non-file fields or a pointer to a struct. Struct
+// fields tagged form:"name" are bound from the field of that name like Bind
+// binds parameters, and fields of type *FormFile or []*FormFile from the
+// uploaded files, e.g.
+//
+//	type uploadForm struct {
+//		Title  string      `form:"title" validate:"required"`
+//		Avatar *FormFile   `form:"avatar" accept:"image/png,image/jpeg" maxsize:"1048576"`
+//		Docs   []*FormFile `form:"docs" accept:"application/pdf"`
+//	}
+//
+// The accept tag lists the allowed content types, where "image/*" matches
+// any image, and maxsize the largest allowed file in bytes, overriding
+// MaxFileSize. Violations are returned as FieldErrors. The body is read part
+// by part: a file over its size limit stops decoding as soon as the limit is
+// passed, and files not bound to a field are skipped without being stored.
+// The non-file fields together may hold up to DefaultMaxFormSize bytes.
+// Limit the size of the whole body with middleware.MaxBodySize.
+//
+// Temporary files are removed once the response was written, see
+// AfterResponse, or outside a web.App when the request's context is done.
+type MultipartDecoder struct {
+	// MaxMemory is how many bytes of the files are held in memory before
+	// they spill to temporary files. Defaults to DefaultMultipartMemory.
+	MaxMemory int64
+	// MaxFileSize, if set, limits the size of every file in bytes.
+	MaxFileSize int64
+}
+
+// Decode fails: the multipart boundary is a parameter of the request's
+// Content-Type, so use DecodeRequest, as the package Decode does.
+func (d *MultipartDecoder) Decode(body io.Reader, out any) error {
+	return fmt.Errorf("multipart decode: boundary unknown, use DecodeRequest")
+}
+
+func (d *MultipartDecoder) DecodeRequest(r *http.Request, out any) error {
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return fmt.Errorf("multipart decode: %w", err)
+	}
+
+	form := &multipartForm{values: url.Values{}, files: map[string][]*FormFile{}}
+	if err := d.read(mr, fileFields(out), form); err != nil {
+		form.removeAll()
+		return err
+	}
+
+	// The temporary files must outlive the middleware when a streamed
+	// response reads them, but not a route's Timeout, which cancels its
+	// context when the middleware returns.
+	if !AfterResponse(r.Context(), form.removeAll) {
+		context.AfterFunc(r.Context(), form.removeAll)
+	}
+
+	return bindForm(form.values, func(name string, sf reflect.StructField, v reflect.Value) error {
+		return bindFiles(form.files[name], fileFieldOf(sf), v)
+	}, out)
+}
+
+// multipartForm holds the decoded parts of a multipart body.
+type multipartForm struct {
+	values url.Values
+	files  map[string][]*FormFile
+}
+
+func (f *multipartForm) removeAll() {
+	for _, files := range f.files {
+		for _, ff := range files {
+			if ff.tmpfile != "" {
+				_ = os.Remove(ff.tmpfile)
+			}
+		}
+	}
+}
+
+// read reads the parts of mr into form. Only files with a field in fields
+// are kept; reading stops at the first file over its field's size limit.
+func (d *MultipartDecoder) read(mr *multipart.Reader, fields map[string]fileField, form *multipartForm) error {
+	memory := cmp.Or(d.MaxMemory, DefaultMultipartMemory)
+	valuesLeft := int64(DefaultMaxFormSize)
+
+	for parts := 0; ; parts++ {
+		if parts == maxFormParts {
+			return NewRequestError(fmt.Errorf("%w: more than %d parts", ErrBodyTooLarge, maxFormParts), http.StatusRequestEntityTooLarge)
+		}
+
+		p, err := mr.NextPart()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("multipart decode: %w", err)
+		}
+
+		name := p.FormName()
+		if name == "" {
+			continue
+		}
+
+		if p.FileName() == "" {
+			b, err := io.ReadAll(io.LimitReader(p, valuesLeft+1))
+			if err != nil {
+				return fmt.Errorf("multipart decode: %w", err)
+			}
+			valuesLeft -= int64(len(b))
+			if valuesLeft < 0 {
+				return NewBodyTooLargeError(DefaultMaxFormSize)
+			}
+			form.values.Add(name, string(b))
+			continue
+		}
+
+		field, ok := fields[name]
+		if !ok {
+			continue
+		}
+		maxSize := cmp.Or(field.maxSize, d.MaxFileSize)
+		ff, err := readFile(p, maxSize, &memory)
+		if ff != nil {
+			form.files[name] = append(form.files[name], ff)
+		}
+		if err != nil {
+			return err
+		}
+		if maxSize > 0 && ff.Size > maxSize {
+			return FieldErrors{{Field: name, Err: fmt.Sprintf("file %q must be at most %d bytes", ff.Filename, maxSize)}}
+		}
+	}
+}
+
+// readFile reads the file part p, holding it in memory while *memory bytes
+// are left and spilling it to a temporary file otherwise. It reads at most
+// one byte over maxSize, if set, so the caller can tell the file is too
+// large. The returned file is set whenever a temporary file was created.
+func readFile(p *multipart.Part, maxSize int64, memory *int64) (*FormFile, error) {
+	ff := &FormFile{Filename: p.FileName(), Header: p.Header}
+	var r io.Reader = p
+	if maxSize > 0 {
+		r = io.LimitReader(p, maxSize+1)
+	}
+
+	var buf bytes.Buffer
+	n, err := io.CopyN(&buf, r, *memory+1)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("multipart decode: %w", err)
+	}
+	if n <= *memory {
+		*memory -= n
+		ff.content = buf.Bytes()
+		ff.Size = n
+		return ff, nil
+	}
+
+	f, err := os.CreateTemp("", "multipart-")
+	if err != nil {
+		return nil, fmt.Errorf("multipart decode: %w", err)
+	}
+	defer f.Close()
+	ff.tmpfile = f.Name()
+
+	size, err := io.Copy(f, io.MultiReader(&buf, r))
+	ff.Size = size
+	if err != nil {
+		return ff, fmt.Errorf("multipart decode: %w", err)
+	}
+	return ff, nil
+}
+
+// fileField holds the limits of a *FormFile or []*FormFile field.
+type fileField struct {
+	maxSize int64
+	accept  []string
+}
+
+func fileFieldOf(sf reflect.StructField) fileField {
+	var ff fileField
+	if tag := sf.Tag.Get("maxsize"); tag != "" {
+		n, err := strconv.ParseInt(tag, 10, 64)
+		if err != nil {
+			panic(fmt.Sprintf("httpx: invalid maxsize tag %q on field %s", tag, sf.Name))
+		}
+		ff.maxSize = n
+	}
+	if tag := sf.Tag.Get("accept"); tag != "" {
+		for t := range strings.SplitSeq(tag, ",") {
+			ff.accept = append(ff.accept, strings.ToLower(strings.TrimSpace(t)))
+		}
+	}
+	return ff
+}
+
+// fileFields returns the file fields of out, a pointer to a struct, by form
+// name, including those of embedded structs as bindFields binds them.
+func fileFields(out any) map[string]fileField {
+	fields := map[string]fileField{}
+	rt := reflect.TypeOf(out)
+	if rt == nil || rt.Kind() != reflect.Pointer || rt.Elem().Kind() != reflect.Struct {
+		return fields
+	}
+
+	var walk func(rt reflect.Type)
+	walk = func(rt reflect.Type) {
+		for i := 0; i < rt.NumField(); i++ {
+			sf := rt.Field(i)
+			if sf.Anonymous && sf.Type.Kind() == reflect.Struct {
+				walk(sf.Type)
+				continue
+			}
+			if name := sf.Tag.Get("form"); sf.IsExported() && name != "" && isFileType(sf.Type) {
+				fields[name] = fileFieldOf(sf)
+			}
+		}
+	}
+	walk(rt.Elem())
+	return fields
+}
+
+func bindFiles(files []*FormFile, field fileField, v reflect.Value) error {
+	if len(files) == 0 {
+		return nil
+	}
+
+	for _, f := range files {
+		ct, err := detectContentType(f)
+		if err != nil {
+			return fmt.Errorf("file %q: %w", f.Filename, err)
+		}
+		if field.accept != nil && !slices.ContainsFunc(field.accept, func(a string) bool { return matchMediaType(a, ct) }) {
+			return fmt.Errorf("file %q must be of type %s", f.Filename, strings.Join(field.accept, ", "))
+		}
+		f.ContentType = ct
+	}
+
+	if v.Type() == formFileSliceType {
+		v.Set(reflect.ValueOf(files))
+	} else {
+		v.Set(reflect.ValueOf(files[0]))
+	}
+	return nil
+}
+
+// bindForm binds form values, and files when given, to out.
+func bindForm(values url.Values, files fileSource, out any) error {
+	if uv, ok := out.(*url.Values); ok {
+		*uv = values
+		return nil
+	}
+
+	rv := reflect.ValueOf(out)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("form decode: out must be *url.Values or a pointer to a struct")
+	}
+
+	fields := func(sf reflect.StructField) (string, []string) {
+		name := sf.Tag.Get("form")
+		return name, values[name]
+	}
+
+	var fe FieldErrors
+	bindFields(rv.Elem(), fields, files, &fe)
+	if len(fe) > 0 {
+		return fe
+	}
+	return nil
+}
+
+func isFileType(t reflect.Type) bool {
+	return t == formFileType || t == formFileSliceType
+}
+
+// detectContentType sniffs the content type of an uploaded file. The type
+// the client declared is used only when sniffing finds nothing more specific
+// than generic binary or text data, and for text only if it declared text.
+func detectContentType(ff *FormFile) (string, error) {
+	f, err := ff.Open()
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(f, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	sniffed, _, _ := mime.ParseMediaType(http.DetectContentType(head[:n]))
+	declared, _, _ := mime.ParseMediaType(ff.Header.Get("Content-Type"))
+
+	switch {
+	case declared == "":
+		return sniffed, nil
+	case sniffed == "application/octet-stream":
+		return declared, nil
+	case sniffed == "text/plain" && strings.HasPrefix(declared, "text/"):
+		return declared, nil
+	}
+	return sniffed, nil
+}
+
+// matchMediaType reports whether mediaType matches pattern, which may be a
+// range such as "image/*".
+func matchMediaType(pattern, mediaType string) bool {
+	if pattern == "*/*" {
+		return true
+	}
+	if prefix, ok := strings.CutSuffix(pattern, "/*"); ok {
+		return strings.HasPrefix(mediaType, prefix+"/")
+	}
+	return pattern == mediaType
+}
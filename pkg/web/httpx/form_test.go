@@ -0,0 +1,238 @@
+package httpx
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var pngHeader = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+type signupForm struct {
+	Name   string   `form:"name"`
+	Age    int      `form:"age"`
+	Tags   []string `form:"tag"`
+	Locale string   `form:"locale" default:"en"`
+}
+
+type uploadForm struct {
+	Title  string      `form:"title"`
+	Avatar *FormFile   `form:"avatar" accept:"image/png,image/jpeg" maxsize:"64"`
+	Docs   []*FormFile `form:"docs" accept:"text/*"`
+}
+
+type formPart struct {
+	field, filename, contentType string
+	content                      []byte
+}
+
+func newMultipartRequest(t *testing.T, parts ...formPart) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for _, p := range parts {
+		if p.filename == "" {
+			require.NoError(t, mw.WriteField(p.field, string(p.content)))
+			continue
+		}
+		h := textproto.MIMEHeader{}
+		h.Set("Content-Disposition", `form-data; name="`+p.field+`"; filename="`+p.filename+`"`)
+		if p.contentType != "" {
+			h.Set("Content-Type", p.contentType)
+		}
+		w, err := mw.CreatePart(h)
+		require.NoError(t, err)
+		_, err = w.Write(p.content)
+		require.NoError(t, err)
+	}
+	require.NoError(t, mw.Close())
+
+	req := httptest.NewRequest("POST", "/upload", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	return req
+}
+
+func TestDecodeForm_Struct(t *testing.T) {
+	req := newRequest("name=Alice&age=30&tag=a&tag=b", "application/x-www-form-urlencoded")
+	var out signupForm
+	require.NoError(t, Decode(req, &out))
+	assert.Equal(t, signupForm{Name: "Alice", Age: 30, Tags: []string{"a", "b"}, Locale: "en"}, out)
+}
+
+func TestDecodeForm_Values(t *testing.T) {
+	req := newRequest("name=Alice&tag=a&tag=b", "application/x-www-form-urlencoded; charset=utf-8")
+	var out url.Values
+	require.NoError(t, Decode(req, &out))
+	assert.Equal(t, url.Values{"name": {"Alice"}, "tag": {"a", "b"}}, out)
+}
+
+func TestDecodeForm_FieldErrors(t *testing.T) {
+	req := newRequest("name=Alice&age=old", "application/x-www-form-urlencoded")
+	var out signupForm
+	err := Decode(req, &out)
+	require.True(t, IsFieldErrors(err))
+	assert.Equal(t, map[string]string{"age": "must be an integer"}, GetFieldErrors(err).Fields())
+}
+
+func TestDecodeMultipart_Files(t *testing.T) {
+	req := newMultipartRequest(t,
+		formPart{field: "title", content: []byte("Hello")},
+		// The declared type is ignored when the content says otherwise.
+		formPart{field: "avatar", filename: "me.png", contentType: "text/plain", content: pngHeader},
+		formPart{field: "docs", filename: "a.md", contentType: "text/markdown", content: []byte("# A")},
+		formPart{field: "docs", filename: "b.txt", content: []byte("b")},
+	)
+	var out uploadForm
+	require.NoError(t, Decode(req, &out))
+
+	assert.Equal(t, "Hello", out.Title)
+	require.NotNil(t, out.Avatar)
+	assert.Equal(t, "me.png", out.Avatar.Filename)
+	assert.Equal(t, "image/png", out.Avatar.ContentType)
+	assert.Equal(t, int64(len(pngHeader)), out.Avatar.Size)
+
+	f, err := out.Avatar.Open()
+	require.NoError(t, err)
+	defer f.Close()
+	b, err := io.ReadAll(f)
+	require.NoError(t, err)
+	assert.Equal(t, pngHeader, b)
+
+	require.Len(t, out.Docs, 2)
+	assert.Equal(t, "text/markdown", out.Docs[0].ContentType)
+	assert.Equal(t, "text/plain", out.Docs[1].ContentType)
+}
+
+func TestDecodeMultipart_SpillsToDisk(t *testing.T) {
+	content := bytes.Repeat([]byte("x"), 4096)
+	req := newMultipartRequest(t, formPart{field: "docs", filename: "big.txt", content: content})
+
+	var out uploadForm
+	dec := &MultipartDecoder{MaxMemory: 16}
+	require.NoError(t, dec.DecodeRequest(req, &out))
+
+	require.Len(t, out.Docs, 1)
+	f, err := out.Docs[0].Open()
+	require.NoError(t, err)
+	defer f.Close()
+	b, err := io.ReadAll(f)
+	require.NoError(t, err)
+	assert.Equal(t, content, b)
+}
+
+func TestDecodeMultipart_RejectsFiles(t *testing.T) {
+	req := newMultipartRequest(t,
+		formPart{field: "avatar", filename: "me.png", content: pngHeader},
+		formPart{field: "docs", filename: "c.png", content: pngHeader},
+	)
+	var out uploadForm
+	err := Decode(req, &out)
+
+	require.True(t, IsFieldErrors(err))
+	assert.Equal(t, map[string]string{"docs": `file "c.png" must be of type text/*`}, GetFieldErrors(err).Fields())
+}
+
+// countingReader counts the bytes read from it.
+type countingReader struct {
+	io.ReadCloser
+	n int
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.n += n
+	return n, err
+}
+
+func TestDecodeMultipart_StopsAtOversizedFile(t *testing.T) {
+	big := append(pngHeader, make([]byte, 1<<20)...)
+	req := newMultipartRequest(t,
+		formPart{field: "avatar", filename: "big.png", content: big},
+		formPart{field: "docs", filename: "c.png", content: pngHeader},
+	)
+	body := &countingReader{ReadCloser: req.Body}
+	req.Body = body
+
+	var out uploadForm
+	err := Decode(req, &out)
+
+	require.True(t, IsFieldErrors(err))
+	assert.Equal(t, map[string]string{"avatar": `file "big.png" must be at most 64 bytes`}, GetFieldErrors(err).Fields())
+	assert.Less(t, body.n, 64<<10)
+}
+
+func TestDecodeMultipart_SkipsUnboundFiles(t *testing.T) {
+	req := newMultipartRequest(t,
+		formPart{field: "title", content: []byte("Hello")},
+		formPart{field: "other", filename: "big.bin", content: make([]byte, 4096)},
+	)
+	var out url.Values
+	require.NoError(t, (&MultipartDecoder{MaxFileSize: 16}).DecodeRequest(req, &out))
+	assert.Equal(t, url.Values{"title": {"Hello"}}, out)
+}
+
+func TestDecodeMultipart_TempFilesRemovedAfterResponse(t *testing.T) {
+	content := bytes.Repeat([]byte("x"), 4096)
+	req := newMultipartRequest(t, formPart{field: "docs", filename: "big.txt", content: content})
+	var v Values
+	ctx, cancel := context.WithCancel(SetValues(req.Context(), &v))
+	req = req.WithContext(ctx)
+
+	var out uploadForm
+	require.NoError(t, (&MultipartDecoder{MaxMemory: 16}).DecodeRequest(req, &out))
+	require.Len(t, out.Docs, 1)
+	path := out.Docs[0].tmpfile
+	require.NotEmpty(t, path)
+
+	// A route's Timeout cancels the context once the middleware returns,
+	// before a streamed response is written.
+	cancel()
+	_, err := os.Stat(path)
+	require.NoError(t, err)
+
+	v.RunAfterResponse()
+	_, err = os.Stat(path)
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestDecodeMultipart_MaxFileSize(t *testing.T) {
+	req := newMultipartRequest(t, formPart{field: "docs", filename: "a.txt", content: []byte("too long")})
+	var out uploadForm
+	err := (&MultipartDecoder{MaxFileSize: 4}).DecodeRequest(req, &out)
+	require.True(t, IsFieldErrors(err))
+	assert.Equal(t, map[string]string{"docs": `file "a.txt" must be at most 4 bytes`}, GetFieldErrors(err).Fields())
+}
+
+func TestDecodeMultipart_BodyTooLarge(t *testing.T) {
+	req := newMultipartRequest(t, formPart{field: "docs", filename: "a.txt", content: bytes.Repeat([]byte("x"), 1024)})
+	req.Body = http.MaxBytesReader(httptest.NewRecorder(), req.Body, 512)
+
+	var out uploadForm
+	err := Decode(req, &out)
+	require.True(t, IsRequestError(err))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, GetRequestError(err).Status)
+}
+
+func TestDecodeMultipart_FileFieldsNeedMultipart(t *testing.T) {
+	req := newRequest("title=x", "application/x-www-form-urlencoded")
+	var out uploadForm
+	assert.Panics(t, func() { _ = Decode(req, &out) })
+}
+
+func TestMatchMediaType(t *testing.T) {
+	assert.True(t, matchMediaType("*/*", "image/png"))
+	assert.True(t, matchMediaType("image/*", "image/png"))
+	assert.True(t, matchMediaType("image/png", "image/png"))
+	assert.False(t, matchMediaType("image/*", "text/plain"))
+	assert.False(t, matchMediaType("image/jpeg", "image/png"))
+}
@@ -2,6 +2,8 @@ package httpx
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net/http"
 )
 
@@ -36,15 +38,21 @@ func XMLResponse(statusCode int, data any) Response {
 	}
 }
 
+// ErrorResponse returns a problem details response for err, see NewProblem.
+// The Errors middleware completes it with the request's instance and trace ID.
 func ErrorResponse(err error, statusCode int) Response {
-	return Response{
-		StatusCode: statusCode,
-		Err:        err,
-		Encoder:    NewEncoder("json"),
-	}
+	resp := ProblemResponse(NewProblem(err, statusCode))
+	resp.Err = err
+	return resp
 }
 
 func Respond(ctx context.Context, w http.ResponseWriter, resp Response) error {
+	// An error response that no middleware translated, e.g. from a recovered
+	// panic, still gets a problem details body.
+	if resp.Err != nil && resp.Encoder == nil {
+		resp = ErrorResponse(resp.Err, resp.StatusCode)
+	}
+
 	SetStatusCode(ctx, resp.StatusCode)
 
 	if resp.StatusCode == http.StatusNoContent {
@@ -52,9 +60,19 @@ func Respond(ctx context.Context, w http.ResponseWriter, resp Response) error {
 		return nil
 	}
 
+	if se, ok := resp.Encoder.(StreamEncoder); ok {
+		sw := &statusWriter{ResponseWriter: w, status: resp.StatusCode}
+		err := se.EncodeTo(sw, resp.StatusCode, resp.Data)
+		SetStatusCode(ctx, sw.status)
+		if err != nil && !sw.wrote {
+			return encodeFailed(ctx, w, err)
+		}
+		return err
+	}
+
 	data, contentType, err := resp.Encoder.Encode(resp.Data)
 	if err != nil {
-		return err
+		return encodeFailed(ctx, w, err)
 	}
 
 	w.Header().Set("Content-Type", contentType)
@@ -66,3 +84,42 @@ func Respond(ctx context.Context, w http.ResponseWriter, resp Response) error {
 
 	return nil
 }
+
+// encodeFailed answers with a 500 problem for err, a failure to encode a
+// response before anything of it was written, so the client learns that the
+// response failed instead of getting an empty 200.
+func encodeFailed(ctx context.Context, w http.ResponseWriter, err error) error {
+	err = fmt.Errorf("encode response: %w", err)
+	p := NewProblem(err, http.StatusInternalServerError)
+	p.TraceID = TraceID(ctx)
+	if perr := Respond(ctx, w, ProblemResponse(p)); perr != nil {
+		return errors.Join(err, perr)
+	}
+	return err
+}
+
+// statusWriter records the status a StreamEncoder actually wrote, and
+// whether it wrote anything.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+	wrote  bool
+}
+
+func (w *statusWriter) WriteHeader(statusCode int) {
+	if statusCode >= http.StatusOK {
+		w.status = statusCode
+		w.wrote = true
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *statusWriter) Write(p []byte) (int, error) {
+	w.wrote = true
+	return w.ResponseWriter.Write(p)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
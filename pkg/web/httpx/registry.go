@@ -0,0 +1,230 @@
+package httpx
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ErrNotAcceptable is returned when no registered encoder produces a media
+// type the client accepts.
+var ErrNotAcceptable = errors.New("not acceptable")
+
+// Decoder decodes a request body into out.
+type Decoder interface {
+	Decode(body io.Reader, out any) error
+}
+
+// DecoderFunc adapts a function to a Decoder.
+type DecoderFunc func(body io.Reader, out any) error
+
+func (f DecoderFunc) Decode(body io.Reader, out any) error {
+	return f(body, out)
+}
+
+// registry holds the formats Decode, NewEncoder and NegotiatedResponse know
+// about. Media types are stored lowercase and without parameters.
+var registry = struct {
+	sync.RWMutex
+	encoders map[string]Encoder // by media type
+	order    []string           // negotiable media types, in preference order
+	names    map[string]Encoder // by NewEncoder id
+	decoders map[string]Decoder // by media type
+}{
+	encoders: map[string]Encoder{},
+	names:    map[string]Encoder{},
+	decoders: map[string]Decoder{},
+}
+
+func init() {
+	RegisterEncoder("application/json", &JSONEncoder{}, "json")
+	RegisterEncoder("application/xml", &XMLEncoder{}, "xml")
+	RegisterEncoder("text/plain", &PlainTextEncoder{}, "plaintext")
+
+	registry.names["problem"] = &ProblemEncoder{}
+	registry.names["file"] = &FileEncoder{}
+	registry.names["sse"] = &SSEEncoder{}
+
+	for _, mt := range []string{"application/json", "application/vnd.api+json"} {
+		RegisterDecoder(mt, DecoderFunc(decodeJSON))
+	}
+	for _, mt := range []string{"application/xml", "text/xml", "application/rss+xml", "application/atom+xml"} {
+		RegisterDecoder(mt, DecoderFunc(decodeXML))
+	}
+	RegisterDecoder("application/x-www-form-urlencoded", DecoderFunc(decodeForm))
+	RegisterDecoder("multipart/form-data", &MultipartDecoder{})
+	// An empty Content-Type is decoded as plain text.
+	for _, mt := range []string{"text/plain", ""} {
+		RegisterDecoder(mt, DecoderFunc(decodeText))
+	}
+}
+
+// RegisterEncoder makes enc available for content negotiation under
+// mediaType and, through NewEncoder, under each of names. Media types are
+// preferred in registration order when the client accepts several equally,
+// so JSON, registered first, is the default. Registering a media type again
+// replaces its encoder but keeps its position.
+func RegisterEncoder(mediaType string, enc Encoder, names ...string) {
+	mt := normalizeMediaType(mediaType)
+
+	registry.Lock()
+	defer registry.Unlock()
+	if _, ok := registry.encoders[mt]; !ok {
+		registry.order = append(registry.order, mt)
+	}
+	registry.encoders[mt] = enc
+	for _, n := range names {
+		registry.names[n] = enc
+	}
+}
+
+// RegisterDecoder makes Decode use dec for request bodies of mediaType, e.g.
+// a MultipartDecoder with other limits for "multipart/form-data".
+func RegisterDecoder(mediaType string, dec Decoder) {
+	registry.Lock()
+	defer registry.Unlock()
+	registry.decoders[normalizeMediaType(mediaType)] = dec
+}
+
+func lookupDecoder(contentType string) (Decoder, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+	dec, ok := registry.decoders[normalizeMediaType(contentType)]
+	return dec, ok
+}
+
+// Negotiate returns the registered encoder best matching an Accept header
+// value, and its media type. An empty header accepts anything. It returns
+// false when the client accepts none of the registered media types. It
+// doesn't consider the data to encode; NegotiatedResponse does.
+func Negotiate(accept string) (Encoder, string, bool) {
+	return negotiate(accept, nil)
+}
+
+// negotiate is Negotiate restricted to the encoders use returns true for, or
+// to all of them for a nil use.
+func negotiate(accept string, use func(Encoder) bool) (Encoder, string, bool) {
+	ranges := parseAccept(accept)
+
+	registry.RLock()
+	defer registry.RUnlock()
+
+	best, bestQ := "", 0.0
+	for _, mt := range registry.order {
+		if use != nil && !use(registry.encoders[mt]) {
+			continue
+		}
+		if q := acceptQuality(ranges, mt); q > bestQ {
+			best, bestQ = mt, q
+		}
+	}
+	if best == "" {
+		return nil, "", false
+	}
+	return registry.encoders[best], best, true
+}
+
+// NegotiatedResponse returns a response encoding data in the format the
+// request's Accept header prefers among those able to encode it, see
+// SelectiveEncoder; a struct is never sent as text/plain, for example. When
+// no such format is acceptable it returns a 406 error response instead.
+func NegotiatedResponse(r *http.Request, statusCode int, data any) Response {
+	use := func(enc Encoder) bool {
+		se, ok := enc.(SelectiveEncoder)
+		return !ok || se.CanEncode(data)
+	}
+	enc, _, ok := negotiate(r.Header.Get("Accept"), use)
+	if !ok {
+		var types []string
+		for _, mt := range EncoderMediaTypes() {
+			if use(NewEncoder(mt)) {
+				types = append(types, mt)
+			}
+		}
+		err := fmt.Errorf("%w: none of %s", ErrNotAcceptable, strings.Join(types, ", "))
+		return ErrorResponse(NewRequestError(err, http.StatusNotAcceptable), http.StatusNotAcceptable)
+	}
+	return Response{
+		StatusCode: statusCode,
+		Data:       data,
+		Encoder:    enc,
+	}
+}
+
+// EncoderMediaTypes returns the negotiable media types in preference order.
+func EncoderMediaTypes() []string {
+	registry.RLock()
+	defer registry.RUnlock()
+	return slices.Clone(registry.order)
+}
+
+type acceptRange struct {
+	typ, sub string
+	q        float64
+}
+
+// parseAccept parses an Accept header into media ranges. Malformed ranges
+// are ignored; a header without any valid range is treated as */*.
+func parseAccept(accept string) []acceptRange {
+	var ranges []acceptRange
+	for _, part := range strings.Split(accept, ",") {
+		mt, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		typ, sub, ok := strings.Cut(mt, "/")
+		if !ok || (typ == "*" && sub != "*") {
+			continue
+		}
+
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil || f < 0 || f > 1 {
+				continue
+			}
+			q = f
+		}
+		ranges = append(ranges, acceptRange{typ: typ, sub: sub, q: q})
+	}
+	if len(ranges) == 0 {
+		return []acceptRange{{typ: "*", sub: "*", q: 1}}
+	}
+	return ranges
+}
+
+// acceptQuality returns the quality the client assigns to mediaType, taken
+// from the most specific matching range.
+func acceptQuality(ranges []acceptRange, mediaType string) float64 {
+	typ, sub, _ := strings.Cut(mediaType, "/")
+
+	q, specificity := 0.0, -1
+	for _, r := range ranges {
+		s := -1
+		switch {
+		case r.typ == typ && r.sub == sub:
+			s = 2
+		case r.typ == typ && r.sub == "*":
+			s = 1
+		case r.typ == "*":
+			s = 0
+		}
+		if s > specificity {
+			q, specificity = r.q, s
+		}
+	}
+	return q
+}
+
+func normalizeMediaType(ct string) string {
+	if i := strings.IndexByte(ct, ';'); i >= 0 {
+		ct = ct[:i]
+	}
+	return strings.ToLower(strings.TrimSpace(ct))
+}
@@ -0,0 +1,164 @@
+package httpx
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   string
+		ok     bool
+	}{
+		{accept: "", want: "application/json", ok: true},
+		{accept: "*/*", want: "application/json", ok: true},
+		{accept: "application/xml", want: "application/xml", ok: true},
+		{accept: "text/xml, application/json", want: "application/json", ok: true},
+		{accept: "application/json;q=0.5, application/xml", want: "application/xml", ok: true},
+		{accept: "text/*", want: "text/plain", ok: true},
+		{accept: "application/*;q=0.2, text/plain;q=0.4", want: "text/plain", ok: true},
+		{accept: "*/*;q=0.1, application/json;q=0", want: "application/xml", ok: true},
+		{accept: "APPLICATION/XML", want: "application/xml", ok: true},
+		{accept: "application/json; charset=utf-8; q=0.9", want: "application/json", ok: true},
+		{accept: "image/png", ok: false},
+		{accept: "application/json;q=0", ok: false},
+		{accept: "garbage;;", want: "application/json", ok: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.accept, func(t *testing.T) {
+			enc, mt, ok := Negotiate(tc.accept)
+			require.Equal(t, tc.ok, ok)
+			if ok {
+				assert.Equal(t, tc.want, mt)
+				assert.NotNil(t, enc)
+			}
+		})
+	}
+}
+
+func TestNegotiatedResponse_NotAcceptable(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept", "image/png")
+
+	resp := NegotiatedResponse(req, http.StatusOK, map[string]string{"a": "b"})
+	require.ErrorIs(t, resp.Err, ErrNotAcceptable)
+	assert.Equal(t, http.StatusNotAcceptable, resp.StatusCode)
+
+	w := httptest.NewRecorder()
+	require.NoError(t, Respond(req.Context(), w, resp))
+	assert.Equal(t, http.StatusNotAcceptable, w.Code)
+	assert.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Body.String(), "application/json")
+}
+
+func TestNegotiatedResponse_SkipsEncodersThatCantEncodeData(t *testing.T) {
+	tests := []struct {
+		name    string
+		accept  string
+		data    any
+		status  int
+		content string
+	}{
+		{"struct as text falls back", "text/plain, */*;q=0.1", sample{Name: "a"}, http.StatusOK, "application/json"},
+		{"struct only as text", "text/plain", sample{Name: "a"}, http.StatusNotAcceptable, "application/problem+json"},
+		{"string as text", "text/plain", "hello", http.StatusOK, "text/plain"},
+		{"bytes as text", "text/*", []byte("hello"), http.StatusOK, "text/plain"},
+		{"map not as xml", "application/xml, application/json;q=0.5", map[string]int{"a": 1}, http.StatusOK, "application/json"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.Header.Set("Accept", tc.accept)
+
+			w := httptest.NewRecorder()
+			require.NoError(t, Respond(req.Context(), w, NegotiatedResponse(req, http.StatusOK, tc.data)))
+			assert.Equal(t, tc.status, w.Code)
+			assert.Equal(t, tc.content, w.Header().Get("Content-Type"))
+			if tc.status == http.StatusNotAcceptable {
+				assert.Contains(t, w.Body.String(), "none of application/json, application/xml")
+				assert.NotContains(t, w.Body.String(), "text/plain")
+			}
+		})
+	}
+}
+
+func TestRespond_EncodeFailureIsA500(t *testing.T) {
+	w := httptest.NewRecorder()
+	err := Respond(context.Background(), w, PlainTextResponse(http.StatusOK, sample{}))
+
+	require.ErrorContains(t, err, "encoder data is not a string")
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{"type":"about:blank","title":"Internal Server Error","status":500}`, w.Body.String())
+}
+
+func TestRespond_StreamFailureBeforeWritingIsA500(t *testing.T) {
+	w := httptest.NewRecorder()
+	err := Respond(context.Background(), w, Response{StatusCode: http.StatusOK, Data: "not a stream", Encoder: &SSEEncoder{}})
+
+	require.ErrorContains(t, err, "encoder data is not a httpx.EventStream")
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+}
+
+// csvCodec encodes and decodes [][]string as text/csv.
+type csvCodec struct{}
+
+func (csvCodec) Encode(data any) ([]byte, string, error) {
+	records, ok := data.([][]string)
+	if !ok {
+		return nil, "", fmt.Errorf("csv: unsupported data %T", data)
+	}
+	var b strings.Builder
+	err := csv.NewWriter(&b).WriteAll(records)
+	return []byte(b.String()), "text/csv", err
+}
+
+func (csvCodec) Decode(body io.Reader, out any) error {
+	records, err := csv.NewReader(body).ReadAll()
+	if err != nil {
+		return err
+	}
+	*out.(*[][]string) = records
+	return nil
+}
+
+func TestRegister_CustomFormat(t *testing.T) {
+	RegisterEncoder("text/csv", csvCodec{}, "csv")
+	RegisterDecoder("text/csv", csvCodec{})
+
+	var records [][]string
+	require.NoError(t, Decode(newRequest("a,b\n1,2\n", "text/csv; charset=utf-8"), &records))
+	assert.Equal(t, [][]string{{"a", "b"}, {"1", "2"}}, records)
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept", "text/csv, application/json;q=0.5")
+	w := httptest.NewRecorder()
+	require.NoError(t, Respond(req.Context(), w, NegotiatedResponse(req, http.StatusOK, records)))
+	assert.Equal(t, "text/csv", w.Header().Get("Content-Type"))
+	assert.Equal(t, "a,b\n1,2\n", w.Body.String())
+
+	assert.Equal(t, csvCodec{}, NewEncoder("csv"))
+	assert.Equal(t, csvCodec{}, NewEncoder("text/csv"))
+	assert.Contains(t, EncoderMediaTypes(), "text/csv")
+
+	// JSON stays the default.
+	_, mt, _ := Negotiate("")
+	assert.Equal(t, "application/json", mt)
+}
+
+func TestNewEncoder_Unknown(t *testing.T) {
+	assert.Nil(t, NewEncoder("yaml"))
+}
@@ -0,0 +1,169 @@
+package httpx
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultHeartbeat is how often an idle event stream sends a comment line so
+// proxies and clients don't time the connection out.
+const DefaultHeartbeat = 15 * time.Second
+
+// Event is a single Server-Sent Event.
+type Event struct {
+	// ID is stored by the client and sent back in the Last-Event-ID header
+	// when it reconnects.
+	ID string
+	// Event names the event type. Empty means "message".
+	Event string
+	// Data is sent as is when it is a string or []byte and as JSON otherwise.
+	// Multi-line data is split over several data fields.
+	Data any
+	// Retry, if set, tells the client how long to wait before reconnecting.
+	Retry time.Duration
+}
+
+// EventStream is the data of an SSE response.
+type EventStream struct {
+	// Events are written to the client as they arrive. The stream ends when
+	// the channel is closed or the client disconnects, whichever is first; a
+	// producer should therefore also stop when the request context is done.
+	Events <-chan Event
+	// Heartbeat overrides DefaultHeartbeat. A negative value disables it.
+	Heartbeat time.Duration
+	// Request is the request being answered; SSEResponse sets it.
+	Request *http.Request
+}
+
+// SSEResponse returns a response streaming events to the client as
+// text/event-stream. Use LastEventID to resume a stream after a reconnect.
+func SSEResponse(r *http.Request, events <-chan Event) Response {
+	return Response{
+		StatusCode: http.StatusOK,
+		Data:       EventStream{Events: events, Request: r},
+		Encoder:    NewEncoder("sse"),
+	}
+}
+
+// LastEventID returns the ID of the last event a reconnecting client
+// received, or "" for a new stream.
+func LastEventID(r *http.Request) string {
+	return r.Header.Get("Last-Event-ID")
+}
+
+// SSEEncoder writes an EventStream. It only supports streaming.
+type SSEEncoder struct{}
+
+func (e *SSEEncoder) Encode(data any) ([]byte, string, error) {
+	return nil, "", fmt.Errorf("sse: event streams can't be buffered")
+}
+
+// EncodeTo writes the events of the EventStream in data to w, flushing after
+// each one, until the stream ends.
+func (e *SSEEncoder) EncodeTo(w http.ResponseWriter, statusCode int, data any) error {
+	s, ok := data.(EventStream)
+	if !ok {
+		return fmt.Errorf("encoder data is not a httpx.EventStream")
+	}
+
+	rc := http.NewResponseController(w)
+	// The stream outlives the server's WriteTimeout, so lift it when the
+	// writer supports deadlines.
+	_ = rc.SetWriteDeadline(time.Time{})
+
+	h := w.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	h.Set("X-Accel-Buffering", "no")
+	w.WriteHeader(statusCode)
+	if err := rc.Flush(); err != nil {
+		return fmt.Errorf("sse: flush: %w", err)
+	}
+
+	heartbeat := s.Heartbeat
+	if heartbeat == 0 {
+		heartbeat = DefaultHeartbeat
+	}
+	var tick <-chan time.Time
+	if heartbeat > 0 {
+		t := time.NewTicker(heartbeat)
+		defer t.Stop()
+		tick = t.C
+	}
+
+	var done <-chan struct{}
+	if s.Request != nil {
+		done = s.Request.Context().Done()
+	}
+
+	bw := bufio.NewWriter(w)
+	for {
+		select {
+		case <-done:
+			return nil
+
+		case ev, ok := <-s.Events:
+			if !ok {
+				return nil
+			}
+			if err := writeEvent(bw, ev); err != nil {
+				return err
+			}
+
+		case <-tick:
+			if _, err := bw.WriteString(": heartbeat\n\n"); err != nil {
+				return err
+			}
+		}
+
+		if err := bw.Flush(); err != nil {
+			return err
+		}
+		if err := rc.Flush(); err != nil {
+			return fmt.Errorf("sse: flush: %w", err)
+		}
+	}
+}
+
+func writeEvent(bw *bufio.Writer, ev Event) error {
+	var data string
+	switch d := ev.Data.(type) {
+	case nil:
+	case string:
+		data = d
+	case []byte:
+		data = string(d)
+	default:
+		b, err := json.Marshal(d)
+		if err != nil {
+			return fmt.Errorf("sse: encode event data: %w", err)
+		}
+		data = string(b)
+	}
+
+	if ev.ID != "" {
+		bw.WriteString("id: " + singleLine(ev.ID) + "\n")
+	}
+	if ev.Event != "" {
+		bw.WriteString("event: " + singleLine(ev.Event) + "\n")
+	}
+	if ev.Retry > 0 {
+		bw.WriteString("retry: " + strconv.FormatInt(ev.Retry.Milliseconds(), 10) + "\n")
+	}
+	data = strings.ReplaceAll(strings.ReplaceAll(data, "\r\n", "\n"), "\r", "\n")
+	for _, line := range strings.Split(data, "\n") {
+		bw.WriteString("data: " + line + "\n")
+	}
+	_, err := bw.WriteString("\n")
+	return err
+}
+
+// singleLine strips line breaks, which would end a field early.
+func singleLine(s string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(s)
+}
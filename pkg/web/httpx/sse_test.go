@@ -0,0 +1,100 @@
+package httpx
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSSE_WritesEvents(t *testing.T) {
+	events := make(chan Event, 4)
+	events <- Event{ID: "1", Event: "progress", Data: map[string]int{"pct": 50}, Retry: 3 * time.Second}
+	events <- Event{Data: "line one\nline two"}
+	events <- Event{ID: "bad\nid", Data: []byte("raw")}
+	close(events)
+
+	req := httptest.NewRequest("GET", "/events", nil)
+	w := httptest.NewRecorder()
+	require.NoError(t, Respond(req.Context(), w, SSEResponse(req, events)))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/event-stream", w.Header().Get("Content-Type"))
+	assert.Equal(t, "no-cache", w.Header().Get("Cache-Control"))
+	assert.True(t, w.Flushed)
+	assert.Equal(t, "id: 1\nevent: progress\nretry: 3000\ndata: {\"pct\":50}\n\n"+
+		"data: line one\ndata: line two\n\n"+
+		"id: badid\ndata: raw\n\n", w.Body.String())
+}
+
+func TestSSE_StreamsHeartbeatsAndStopsOnDisconnect(t *testing.T) {
+	stopped := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		events := make(chan Event)
+		go func() {
+			defer close(stopped)
+			start := 0
+			if id := LastEventID(r); id != "" {
+				fmt.Sscan(id, &start)
+			}
+			for i := start + 1; ; i++ {
+				select {
+				case events <- Event{ID: fmt.Sprint(i), Data: "tick"}:
+				case <-r.Context().Done():
+					return
+				}
+				time.Sleep(20 * time.Millisecond)
+			}
+		}()
+
+		resp := SSEResponse(r, events)
+		es := resp.Data.(EventStream)
+		es.Heartbeat = 5 * time.Millisecond
+		resp.Data = es
+		_ = Respond(r.Context(), w, resp)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, err := http.NewRequestWithContext(ctx, "GET", srv.URL, nil)
+	require.NoError(t, err)
+	req.Header.Set("Last-Event-ID", "41")
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	var ids []string
+	heartbeats := 0
+	sc := bufio.NewScanner(resp.Body)
+	for sc.Scan() && len(ids) < 2 {
+		line := sc.Text()
+		if id, ok := strings.CutPrefix(line, "id: "); ok {
+			ids = append(ids, id)
+		}
+		if line == ": heartbeat" {
+			heartbeats++
+		}
+	}
+	assert.Equal(t, []string{"42", "43"}, ids)
+	assert.Positive(t, heartbeats)
+
+	cancel()
+	select {
+	case <-stopped:
+	case <-time.After(2 * time.Second):
+		t.Fatal("producer did not stop after the client disconnected")
+	}
+}
+
+func TestSSEEncoder_Encode(t *testing.T) {
+	_, _, err := NewEncoder("sse").Encode(EventStream{})
+	assert.Error(t, err)
+}
@@ -0,0 +1,357 @@
+package httpx
+
+import (
+	"fmt"
+	"net/http"
+	"net/mail"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Validator is implemented by request types with rules that struct tags
+// can't express, such as constraints across fields. Validate runs it after
+// the tag rules pass.
+type Validator interface {
+	Validate() error
+}
+
+// DecodeAndValidate decodes r.Body into out with Decode and then validates it
+// with Validate. Malformed bodies are reported as a 400 RequestError,
+// unsupported content types as 415 and bodies over the size limit as 413, so
+// the Errors middleware can render every failure as a problem response.
+func DecodeAndValidate(r *http.Request, out any) error {
+	if err := Decode(r, out); err != nil {
+		return DecodeError(err)
+	}
+	return ValidationError(Validate(out))
+}
+
+// ValidationError classifies an error returned by Validate for the Errors
+// middleware: FieldErrors and RequestErrors are returned as is and any other
+// Validator error becomes a 400 RequestError.
+func ValidationError(err error) error {
+	if err == nil || IsFieldErrors(err) || IsRequestError(err) {
+		return err
+	}
+	return NewRequestError(err, http.StatusBadRequest)
+}
+
+// Validate checks the validate struct tags of v, which must be a struct or a
+// pointer to one, and then calls the Validate method of v and of nested
+// structs implementing Validator. Tag failures are returned as FieldErrors,
+// named by json tag or request parameter where present; a Validator error is
+// returned as is.
+//
+// Rules are separated by commas:
+//
+//	required      the value must not be the zero value
+//	omitempty     the other rules are skipped for the zero value
+//	min=N, max=N  bounds for numbers, or for the length of strings (in runes),
+//	              slices and maps
+//	len=N         exact length of strings, slices and maps
+//	email         an address such as "gopher@example.com"
+//	uuid          a UUID in canonical 8-4-4-4-12 form
+//	oneof=a b c   the value formats to one of the space-separated options
+//	regex=EXPR    the string matches EXPR; it takes the rest of the tag, so it
+//	              must be the last rule and may contain commas
+//	dive          the rules after it apply to each element of a slice or map,
+//	              and struct elements are validated recursively
+//
+// Apart from required, rules are skipped for absent values, i.e. nil pointers
+// and empty strings, slices and maps, so optional fields are only checked when
+// present. Numbers and bools are always checked, since zero is a value like
+// any other: min=1 rejects 0. Use omitempty to skip the rules when they are
+// zero, or a pointer to tell an absent number from zero. Nested structs are
+// always validated, unless held by a nil pointer. Malformed tags are
+// programming errors and cause a panic.
+func Validate(v any) error {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return nil
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil
+	}
+
+	var fe FieldErrors
+	validateStruct(rv, "", &fe)
+	if len(fe) > 0 {
+		return fe
+	}
+
+	if vr, ok := v.(Validator); ok {
+		return vr.Validate()
+	}
+	return nil
+}
+
+func validateStruct(rv reflect.Value, path string, fe *FieldErrors) {
+	rt := rv.Type()
+	before := len(*fe)
+
+	for i := 0; i < rt.NumField(); i++ {
+		sf := rt.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+
+		name := fieldName(sf)
+		if path != "" {
+			name = path + "." + name
+		}
+
+		validateValue(rv.Field(i), name, parseRules(sf.Tag.Get("validate")), fe)
+	}
+
+	// A struct's own Validate method only runs once its tag rules pass. The
+	// top level one is left to Validate so its error is returned unchanged.
+	if path == "" || len(*fe) > before {
+		return
+	}
+	if rv.CanAddr() {
+		rv = rv.Addr()
+	}
+	if vr, ok := rv.Interface().(Validator); ok {
+		if err := vr.Validate(); err != nil {
+			if nested := GetFieldErrors(err); nested != nil {
+				for _, f := range nested {
+					*fe = append(*fe, FieldError{Field: path + "." + f.Field, Err: f.Err})
+				}
+				return
+			}
+			*fe = append(*fe, FieldError{Field: path, Err: err.Error()})
+		}
+	}
+}
+
+func validateValue(v reflect.Value, name string, rules []rule, fe *FieldErrors) {
+	diveAt := len(rules)
+	for i, r := range rules {
+		if r.name == "dive" {
+			diveAt = i
+			break
+		}
+	}
+
+	if v.IsZero() {
+		omitEmpty := false
+		for _, r := range rules[:diveAt] {
+			switch r.name {
+			case "required":
+				*fe = append(*fe, FieldError{Field: name, Err: "is required"})
+				return
+			case "omitempty":
+				omitEmpty = true
+			}
+		}
+		// An empty nested struct may still break its own fields' rules.
+		if v.Kind() == reflect.Struct {
+			validateStruct(v, name, fe)
+			return
+		}
+		// Zero is a value like any other for numbers and bools, so it is
+		// checked unless the field opts out with omitempty.
+		if omitEmpty || !isNumberOrBool(v.Kind()) {
+			return
+		}
+	}
+
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+
+	for _, r := range rules[:diveAt] {
+		if msg := r.check(v); msg != "" {
+			*fe = append(*fe, FieldError{Field: name, Err: msg})
+			return
+		}
+	}
+
+	if diveAt < len(rules) {
+		elemRules := rules[diveAt+1:]
+		switch v.Kind() {
+		case reflect.Slice, reflect.Array:
+			for i := 0; i < v.Len(); i++ {
+				validateValue(v.Index(i), fmt.Sprintf("%s[%d]", name, i), elemRules, fe)
+			}
+		case reflect.Map:
+			iter := v.MapRange()
+			for iter.Next() {
+				validateValue(iter.Value(), fmt.Sprintf("%s[%v]", name, iter.Key()), elemRules, fe)
+			}
+		default:
+			panic(fmt.Sprintf("validate: %s: dive on %s", name, v.Kind()))
+		}
+		return
+	}
+
+	if v.Kind() == reflect.Struct {
+		validateStruct(v, name, fe)
+	}
+}
+
+// fieldName names a field in FieldErrors after its json tag, or else the
+// request parameter it is bound from, or else its Go name.
+func fieldName(sf reflect.StructField) string {
+	if tag, ok := sf.Tag.Lookup("json"); ok {
+		if n, _, _ := strings.Cut(tag, ","); n != "" && n != "-" {
+			return n
+		}
+	}
+	for _, key := range []string{"path", "query", "header", "cookie", "form"} {
+		if n := sf.Tag.Get(key); n != "" {
+			return n
+		}
+	}
+	return sf.Name
+}
+
+type rule struct {
+	name  string
+	param string
+}
+
+var rulesCache sync.Map // tag string -> []rule
+
+func parseRules(tag string) []rule {
+	if tag == "" {
+		return nil
+	}
+	if rules, ok := rulesCache.Load(tag); ok {
+		return rules.([]rule)
+	}
+
+	var rules []rule
+	rest := tag
+	for rest != "" {
+		var part string
+		if strings.HasPrefix(rest, "regex=") {
+			part, rest = rest, ""
+		} else {
+			part, rest, _ = strings.Cut(rest, ",")
+		}
+
+		name, param, _ := strings.Cut(part, "=")
+		r := rule{name: strings.TrimSpace(name), param: param}
+		switch r.name {
+		case "required", "omitempty", "email", "uuid", "dive":
+		case "min", "max", "len":
+			if _, err := strconv.ParseFloat(r.param, 64); err != nil {
+				panic(fmt.Sprintf("validate: invalid %s parameter %q in tag %q", r.name, r.param, tag))
+			}
+		case "oneof":
+			if r.param == "" {
+				panic(fmt.Sprintf("validate: oneof without options in tag %q", tag))
+			}
+		case "regex":
+			regexps.LoadOrStore(r.param, regexp.MustCompile(r.param))
+		default:
+			panic(fmt.Sprintf("validate: unknown rule %q in tag %q", r.name, tag))
+		}
+		rules = append(rules, r)
+	}
+
+	rulesCache.Store(tag, rules)
+	return rules
+}
+
+var regexps sync.Map // expression -> *regexp.Regexp
+
+var uuidRE = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// check returns a message describing how v breaks the rule, or "".
+func (r rule) check(v reflect.Value) string {
+	switch r.name {
+	case "required", "omitempty":
+		return ""
+
+	case "min", "max", "len":
+		n, _ := strconv.ParseFloat(r.param, 64)
+		size, isLen, ok := measure(v)
+		if !ok {
+			panic(fmt.Sprintf("validate: %s on %s", r.name, v.Kind()))
+		}
+		switch {
+		case r.name == "len" && size != n:
+			return "must have length " + r.param
+		case r.name == "min" && size < n && isLen:
+			return "must have length at least " + r.param
+		case r.name == "min" && size < n:
+			return "must be at least " + r.param
+		case r.name == "max" && size > n && isLen:
+			return "must have length at most " + r.param
+		case r.name == "max" && size > n:
+			return "must be at most " + r.param
+		}
+
+	case "email":
+		s := stringOf(r, v)
+		if a, err := mail.ParseAddress(s); err != nil || a.Address != s {
+			return "must be a valid email address"
+		}
+
+	case "uuid":
+		if !uuidRE.MatchString(stringOf(r, v)) {
+			return "must be a valid UUID"
+		}
+
+	case "oneof":
+		s := fmt.Sprint(v.Interface())
+		for _, opt := range strings.Fields(r.param) {
+			if s == opt {
+				return ""
+			}
+		}
+		return "must be one of " + strings.Join(strings.Fields(r.param), ", ")
+
+	case "regex":
+		re, _ := regexps.Load(r.param)
+		if !re.(*regexp.Regexp).MatchString(stringOf(r, v)) {
+			return "must match " + r.param
+		}
+	}
+	return ""
+}
+
+// measure returns the number compared by min, max and len: the value of a
+// number, or the length of a string, slice or map.
+func measure(v reflect.Value) (size float64, isLen bool, ok bool) {
+	switch v.Kind() {
+	case reflect.String:
+		return float64(utf8.RuneCountInString(v.String())), true, true
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return float64(v.Len()), true, true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), false, true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(v.Uint()), false, true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), false, true
+	}
+	return 0, false, false
+}
+
+func isNumberOrBool(k reflect.Kind) bool {
+	switch k {
+	case reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+func stringOf(r rule, v reflect.Value) string {
+	if v.Kind() != reflect.String {
+		panic(fmt.Sprintf("validate: %s on %s", r.name, v.Kind()))
+	}
+	return v.String()
+}
@@ -0,0 +1,218 @@
+package httpx
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type address struct {
+	City string `json:"city" validate:"required"`
+	Zip  string `json:"zip" validate:"regex=^[0-9]{5}(-[0-9]{4})?$"`
+}
+
+type signup struct {
+	Name     string            `json:"name" validate:"required,min=2,max=10"`
+	Email    string            `json:"email" validate:"required,email"`
+	Age      int               `json:"age" validate:"min=18,max=130"`
+	ID       string            `json:"id" validate:"uuid"`
+	Plan     string            `json:"plan" validate:"oneof=free pro"`
+	Code     string            `json:"code" validate:"len=4"`
+	Tags     []string          `json:"tags" validate:"max=3,dive,min=2"`
+	Address  address           `json:"address"`
+	Previous []address         `json:"previous" validate:"dive"`
+	Labels   map[string]string `json:"labels" validate:"dive,oneof=a b"`
+	Nick     *string           `json:"nick" validate:"min=3"`
+	internal string            `validate:"required"`
+}
+
+func validSignup() signup {
+	return signup{
+		Name:    "Alice",
+		Email:   "alice@example.com",
+		Age:     30,
+		Address: address{City: "Anchorage"},
+	}
+}
+
+func TestValidate_Valid(t *testing.T) {
+	s := validSignup()
+	nick := "ally"
+	s.Nick = &nick
+	s.ID = "7d444840-9dc0-11d1-b245-5ffdce74fad2"
+	s.Plan = "pro"
+	s.Code = "abcd"
+	s.Tags = []string{"go", "sql"}
+	s.Address.Zip = "99501-1234"
+	s.Previous = []address{{City: "Juneau"}}
+	s.Labels = map[string]string{"x": "a"}
+
+	require.NoError(t, Validate(&s))
+	require.NoError(t, Validate(s))
+}
+
+func TestValidate_Rules(t *testing.T) {
+	short := "ab"
+
+	tests := []struct {
+		name   string
+		modify func(s *signup)
+		field  string
+		msg    string
+	}{
+		{"required", func(s *signup) { s.Name = "" }, "name", "is required"},
+		{"min length", func(s *signup) { s.Name = "A" }, "name", "must have length at least 2"},
+		{"max length counts runes", func(s *signup) { s.Name = "ééééééééééé" }, "name", "must have length at most 10"},
+		{"email", func(s *signup) { s.Email = "Alice <alice@example.com>" }, "email", "must be a valid email address"},
+		{"min number", func(s *signup) { s.Age = 17 }, "age", "must be at least 18"},
+		{"max number", func(s *signup) { s.Age = 131 }, "age", "must be at most 130"},
+		{"uuid", func(s *signup) { s.ID = "not-a-uuid" }, "id", "must be a valid UUID"},
+		{"oneof", func(s *signup) { s.Plan = "gold" }, "plan", "must be one of free, pro"},
+		{"len", func(s *signup) { s.Code = "abc" }, "code", "must have length 4"},
+		{"slice max", func(s *signup) { s.Tags = []string{"aa", "bb", "cc", "dd"} }, "tags", "must have length at most 3"},
+		{"dive slice", func(s *signup) { s.Tags = []string{"go", "x"} }, "tags[1]", "must have length at least 2"},
+		{"nested struct", func(s *signup) { s.Address.City = "" }, "address.city", "is required"},
+		{"nested regex", func(s *signup) { s.Address.Zip = "9950" }, "address.zip", "must match ^[0-9]{5}(-[0-9]{4})?$"},
+		{"dive structs", func(s *signup) { s.Previous = []address{{City: "Juneau"}, {}} }, "previous[1].city", "is required"},
+		{"dive map", func(s *signup) { s.Labels = map[string]string{"k": "c"} }, "labels[k]", "must be one of a, b"},
+		{"pointer", func(s *signup) { s.Nick = &short }, "nick", "must have length at least 3"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s := validSignup()
+			tc.modify(&s)
+
+			err := Validate(&s)
+			require.Error(t, err)
+			fe := GetFieldErrors(err)
+			require.Equal(t, FieldErrors{{Field: tc.field, Err: tc.msg}}, fe)
+		})
+	}
+}
+
+func TestValidate_CollectsAllFields(t *testing.T) {
+	err := Validate(&signup{Age: 5})
+	fe := GetFieldErrors(err)
+	assert.Equal(t, map[string]string{
+		"name":         "is required",
+		"email":        "is required",
+		"age":          "must be at least 18",
+		"address.city": "is required",
+	}, fe.Fields())
+}
+
+func TestValidate_ZeroValues(t *testing.T) {
+	type order struct {
+		Qty      int     `json:"qty" validate:"min=1"`
+		Priority int     `json:"priority" validate:"oneof=1 2 3"`
+		Discount float64 `json:"discount" validate:"omitempty,min=5"`
+		Limit    *int    `json:"limit" validate:"min=1"`
+		Note     string  `json:"note" validate:"min=3"`
+	}
+
+	err := Validate(order{})
+	assert.Equal(t, map[string]string{
+		"qty":      "must be at least 1",
+		"priority": "must be one of 1, 2, 3",
+	}, GetFieldErrors(err).Fields())
+
+	zero := 0
+	err = Validate(order{Qty: 1, Priority: 2, Discount: 1, Limit: &zero})
+	assert.Equal(t, map[string]string{
+		"discount": "must be at least 5",
+		"limit":    "must be at least 1",
+	}, GetFieldErrors(err).Fields())
+
+	assert.NoError(t, Validate(order{Qty: 1, Priority: 2}))
+}
+
+type booking struct {
+	From   int    `json:"from" validate:"required"`
+	To     int    `json:"to" validate:"required"`
+	Period period `json:"period"`
+}
+
+func (b booking) Validate() error {
+	if b.To < b.From {
+		return errors.New("to must not be before from")
+	}
+	return nil
+}
+
+type period struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+func (p *period) Validate() error {
+	if p.End < p.Start {
+		return NewFieldError("end", errors.New("must not be before start"))
+	}
+	return nil
+}
+
+func TestValidate_ValidatorInterface(t *testing.T) {
+	// Tag failures are reported before Validate runs.
+	err := Validate(booking{})
+	assert.Len(t, GetFieldErrors(err), 2)
+
+	err = Validate(booking{From: 5, To: 1})
+	require.EqualError(t, err, "to must not be before from")
+	assert.False(t, IsFieldErrors(err))
+
+	err = Validate(&booking{From: 1, To: 5, Period: period{Start: 3, End: 1}})
+	assert.Equal(t, FieldErrors{{Field: "period.end", Err: "must not be before start"}}, GetFieldErrors(err))
+}
+
+func TestValidate_InvalidTagPanics(t *testing.T) {
+	type bad struct {
+		A string `validate:"bogus"`
+	}
+	type badMin struct {
+		A string `validate:"min=x"`
+	}
+	assert.Panics(t, func() { _ = Validate(bad{A: "x"}) })
+	assert.Panics(t, func() { _ = Validate(badMin{A: "x"}) })
+}
+
+func TestDecodeAndValidate(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        string
+		contentType string
+		wantStatus  int
+		wantFields  map[string]string
+	}{
+		{name: "valid", body: `{"name":"Alice","email":"alice@example.com","age":30,"address":{"city":"Nome"}}`, contentType: "application/json"},
+		{name: "malformed", body: `{"name":`, contentType: "application/json", wantStatus: http.StatusBadRequest},
+		{name: "unsupported", body: `name=Alice`, contentType: "application/x-unknown", wantStatus: http.StatusUnsupportedMediaType},
+		{
+			name:        "invalid",
+			body:        `{"name":"A","email":"alice@example.com","age":30,"address":{"city":"Nome"}}`,
+			contentType: "application/json",
+			wantStatus:  http.StatusBadRequest,
+			wantFields:  map[string]string{"name": "must have length at least 2"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var s signup
+			err := DecodeAndValidate(newRequest(tc.body, tc.contentType), &s)
+			if tc.wantStatus == 0 {
+				require.NoError(t, err)
+				return
+			}
+
+			p := NewProblem(err, 0)
+			assert.Equal(t, tc.wantStatus, p.Status)
+			if tc.wantFields != nil {
+				assert.Equal(t, tc.wantFields, p.Errors.Fields())
+			}
+		})
+	}
+}
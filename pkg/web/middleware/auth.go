@@ -0,0 +1,123 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/jwbonnell/go-libs/pkg/web/auth"
+	"github.com/jwbonnell/go-libs/pkg/web/httpx"
+)
+
+// JWT authenticates requests with a bearer token in the Authorization header,
+// verified by v. The token's subject, roles and scopes become the request's
+// auth.Principal. Missing and invalid tokens are rejected with 401.
+func JWT(v *auth.JWTVerifier) httpx.Middleware {
+	m := func(next httpx.HandlerFunc) httpx.HandlerFunc {
+		h := func(w http.ResponseWriter, r *http.Request) httpx.Response {
+			scheme, token, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+			if !strings.EqualFold(scheme, "Bearer") || token == "" {
+				w.Header().Set("WWW-Authenticate", `Bearer`)
+				return unauthorized("missing bearer token")
+			}
+
+			claims, err := v.Verify(r.Context(), strings.TrimSpace(token))
+			if err != nil {
+				w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+				if !errors.Is(err, auth.ErrInvalidToken) {
+					return httpx.ErrorResponse(fmt.Errorf("verify token: %w", err), http.StatusInternalServerError)
+				}
+				return unauthorized("verify token: %w", err)
+			}
+
+			p := &auth.Principal{
+				Subject: claims.Subject,
+				Method:  auth.MethodJWT,
+				Roles:   claims.Roles,
+				Scopes:  claims.Scopes(),
+				Claims:  claims,
+			}
+			return next(w, r.WithContext(auth.NewContext(r.Context(), p)))
+		}
+
+		return h
+	}
+
+	return m
+}
+
+// APIKey authenticates requests with a key in header, e.g. "X-API-Key",
+// looked up in store. Missing and unknown keys are rejected with 401, as are
+// lookups that find no principal without an error.
+func APIKey(header string, store auth.APIKeyStore) httpx.Middleware {
+	m := func(next httpx.HandlerFunc) httpx.HandlerFunc {
+		h := func(w http.ResponseWriter, r *http.Request) httpx.Response {
+			key := r.Header.Get(header)
+			if key == "" {
+				return unauthorized("missing %s header", header)
+			}
+
+			p, err := store.LookupAPIKey(r.Context(), key)
+			if err != nil {
+				if !errors.Is(err, auth.ErrInvalidCredentials) {
+					return httpx.ErrorResponse(fmt.Errorf("lookup api key: %w", err), http.StatusInternalServerError)
+				}
+				return unauthorized("lookup api key: %w", err)
+			}
+			if p == nil {
+				return unauthorized("lookup api key: %w", auth.ErrInvalidCredentials)
+			}
+
+			principal := *p
+			principal.Method = auth.MethodAPIKey
+			return next(w, r.WithContext(auth.NewContext(r.Context(), &principal)))
+		}
+
+		return h
+	}
+
+	return m
+}
+
+// BasicAuth authenticates requests with HTTP Basic credentials checked by
+// check. Missing and wrong credentials, and checks returning no principal, are
+// rejected with 401 and a challenge for realm.
+func BasicAuth(realm string, check auth.BasicAuthFunc) httpx.Middleware {
+	challenge := fmt.Sprintf(`Basic realm=%q, charset="UTF-8"`, realm)
+
+	m := func(next httpx.HandlerFunc) httpx.HandlerFunc {
+		h := func(w http.ResponseWriter, r *http.Request) httpx.Response {
+			user, pass, ok := r.BasicAuth()
+			if !ok {
+				w.Header().Set("WWW-Authenticate", challenge)
+				return unauthorized("missing basic auth credentials")
+			}
+
+			p, err := check(r.Context(), user, pass)
+			if err != nil {
+				if !errors.Is(err, auth.ErrInvalidCredentials) {
+					return httpx.ErrorResponse(fmt.Errorf("check basic auth: %w", err), http.StatusInternalServerError)
+				}
+				w.Header().Set("WWW-Authenticate", challenge)
+				return unauthorized("basic auth for %q: %w", user, err)
+			}
+			if p == nil {
+				w.Header().Set("WWW-Authenticate", challenge)
+				return unauthorized("basic auth for %q: %w", user, auth.ErrInvalidCredentials)
+			}
+
+			principal := *p
+			principal.Method = auth.MethodBasic
+			return next(w, r.WithContext(auth.NewContext(r.Context(), &principal)))
+		}
+
+		return h
+	}
+
+	return m
+}
+
+func unauthorized(format string, args ...any) httpx.Response {
+	return httpx.ErrorResponse(httpx.NewAuthError(format, args...), http.StatusUnauthorized)
+}
@@ -0,0 +1,79 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/jwbonnell/go-libs/pkg/web/auth"
+	"github.com/jwbonnell/go-libs/pkg/web/httpx"
+)
+
+// RequireRoles allows requests whose principal has at least one of roles. It
+// must run after an authentication middleware such as JWT: requests without
+// a principal are rejected with 401, principals without a matching role with
+// 403.
+func RequireRoles(roles ...string) httpx.Middleware {
+	return Authorize(func(r *http.Request, p *auth.Principal) (bool, error) {
+		return slices.ContainsFunc(roles, p.HasRole), nil
+	}, "requires one of roles %s", strings.Join(roles, ", "))
+}
+
+// RequireScopes allows requests whose principal was granted every one of
+// scopes. Like RequireRoles it responds 401 without a principal and 403 when
+// a scope is missing.
+func RequireScopes(scopes ...string) httpx.Middleware {
+	return Authorize(func(r *http.Request, p *auth.Principal) (bool, error) {
+		for _, s := range scopes {
+			if !p.HasScope(s) {
+				return false, nil
+			}
+		}
+		return true, nil
+	}, "requires scopes %s", strings.Join(scopes, ", "))
+}
+
+// Policy decides whether the principal p may perform request r, e.g. whether
+// they own the resource it addresses. An error is answered with 500 unless it
+// is an *httpx.RequestError or *httpx.AuthError, which keep their status, so
+// a policy can report a missing resource as 404.
+type Policy func(r *http.Request, p *auth.Principal) (bool, error)
+
+// Authorize allows requests for which policy returns true. Requests without a
+// principal are rejected with 401 and denied requests with 403; the reason,
+// formatted from format and args, is logged but not shown to the client.
+func Authorize(policy Policy, format string, args ...any) httpx.Middleware {
+	reason := fmt.Sprintf(format, args...)
+
+	m := func(next httpx.HandlerFunc) httpx.HandlerFunc {
+		h := func(w http.ResponseWriter, r *http.Request) httpx.Response {
+			p, ok := auth.FromContext(r.Context())
+			if !ok {
+				return unauthorized("not authenticated")
+			}
+
+			allowed, err := policy(r, p)
+			if err != nil {
+				var ae *httpx.AuthError
+				switch {
+				case errors.As(err, &ae):
+					return httpx.ErrorResponse(err, ae.Status)
+				case httpx.IsRequestError(err):
+					return httpx.ErrorResponse(err, httpx.GetRequestError(err).Status)
+				}
+				return httpx.ErrorResponse(fmt.Errorf("authorize: %w", err), http.StatusInternalServerError)
+			}
+			if !allowed {
+				return httpx.ErrorResponse(httpx.NewForbiddenError("%s %s: %s", p.Method, p.Subject, reason), http.StatusForbidden)
+			}
+
+			return next(w, r)
+		}
+
+		return h
+	}
+
+	return m
+}
@@ -0,0 +1,426 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/jwbonnell/go-libs/pkg/web/httpx"
+)
+
+// Content codings supported by Compress, in order of preference.
+const (
+	EncodingGzip    = "gzip"
+	EncodingDeflate = "deflate"
+)
+
+// DefaultCompressMinSize is the smallest response Compress compresses by
+// default. Smaller responses don't get meaningfully smaller.
+const DefaultCompressMinSize = 1024
+
+// DefaultCompressibleTypes are the media types Compress compresses by
+// default. Types ending in "/*" match a whole top-level type, and any
+// "+json" or "+xml" type is compressible as well.
+var DefaultCompressibleTypes = []string{
+	"text/*",
+	"application/json",
+	"application/xml",
+	"application/javascript",
+	"application/x-ndjson",
+	"image/svg+xml",
+}
+
+// CompressConfig configures Compress. Zero values are replaced with the
+// defaults noted on each field.
+type CompressConfig struct {
+	// Level is the compression level, from gzip.BestSpeed to
+	// gzip.BestCompression. Defaults to gzip.DefaultCompression.
+	Level int
+	// MinSize is the smallest body compressed, in bytes. Defaults to
+	// DefaultCompressMinSize. Streams that flush before reaching it are
+	// compressed regardless.
+	MinSize int
+	// ContentTypes lists the compressible media types. Defaults to
+	// DefaultCompressibleTypes.
+	ContentTypes []string
+	// DecompressRequests makes Compress decode gzip and deflate request
+	// bodies, so httpx.Decode sees plain content. Requests with any other
+	// Content-Encoding are rejected with 415.
+	DecompressRequests bool
+}
+
+// Compress compresses responses with the coding the client prefers in its
+// Accept-Encoding header, among gzip and deflate. Only successful responses
+// of a compressible type and at least MinSize bytes are compressed; ranges,
+// already encoded bodies and protocol upgrades are left alone. Streamed
+// responses such as event streams are compressed as they are written and
+// every flush reaches the client. All responses get Vary: Accept-Encoding.
+//
+// Place MaxBodySize after Compress so the limit applies to decompressed
+// request bodies.
+func Compress(cfg CompressConfig) httpx.Middleware {
+	c := newCompressor(cfg)
+
+	m := func(next httpx.HandlerFunc) httpx.HandlerFunc {
+		h := func(w http.ResponseWriter, r *http.Request) httpx.Response {
+			if cfg.DecompressRequests {
+				if err := decompressBody(r); err != nil {
+					return httpx.ErrorResponse(err, httpx.GetRequestError(err).Status)
+				}
+			}
+
+			addVary(w.Header(), "Accept-Encoding")
+
+			resp := next(w, r)
+
+			encoding := NegotiateEncoding(r.Header.Get("Accept-Encoding"))
+			if encoding == "" || resp.Encoder == nil || resp.StatusCode == http.StatusSwitchingProtocols {
+				return resp
+			}
+			resp.Encoder = &compressEncoder{Encoder: resp.Encoder, c: c, encoding: encoding}
+			return resp
+		}
+
+		return h
+	}
+
+	return m
+}
+
+// NegotiateEncoding returns the supported content coding with the highest
+// quality in the Accept-Encoding header value accept, preferring gzip on
+// ties, or "" when the response should not be compressed.
+func NegotiateEncoding(accept string) string {
+	q := map[string]float64{}
+	wildcard := -1.0
+	for part := range strings.SplitSeq(accept, ",") {
+		coding, params, _ := strings.Cut(part, ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		quality := 1.0
+		for p := range strings.SplitSeq(params, ";") {
+			k, v, ok := strings.Cut(strings.TrimSpace(p), "=")
+			if ok && strings.EqualFold(k, "q") {
+				if f, err := strconv.ParseFloat(v, 64); err == nil {
+					quality = f
+				}
+			}
+		}
+		switch coding {
+		case "*":
+			wildcard = quality
+		case "x-gzip":
+			q[EncodingGzip] = quality
+		default:
+			q[coding] = quality
+		}
+	}
+
+	best, bestQ := "", 0.0
+	for _, coding := range []string{EncodingGzip, EncodingDeflate} {
+		quality, ok := q[coding]
+		if !ok {
+			quality = wildcard
+		}
+		if quality > bestQ {
+			best, bestQ = coding, quality
+		}
+	}
+	return best
+}
+
+// decompressBody replaces a gzip or deflate encoded request body with its
+// decoded content.
+func decompressBody(r *http.Request) error {
+	encoding := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding")))
+
+	var body io.ReadCloser
+	var err error
+	switch encoding {
+	case "", "identity":
+		return nil
+	case EncodingGzip, "x-gzip":
+		body, err = gzip.NewReader(r.Body)
+	case EncodingDeflate:
+		body, err = zlib.NewReader(r.Body)
+	default:
+		return httpx.NewRequestError(fmt.Errorf("unsupported content encoding %q", encoding), http.StatusUnsupportedMediaType)
+	}
+	if err != nil {
+		return httpx.NewRequestError(fmt.Errorf("decompress %s body: %w", encoding, err), http.StatusBadRequest)
+	}
+
+	r.Body = &decompressedBody{ReadCloser: body, orig: r.Body}
+	r.Header.Del("Content-Encoding")
+	r.Header.Del("Content-Length")
+	r.ContentLength = -1
+	return nil
+}
+
+type decompressedBody struct {
+	io.ReadCloser
+	orig io.ReadCloser
+}
+
+func (b *decompressedBody) Close() error {
+	return errors.Join(b.ReadCloser.Close(), b.orig.Close())
+}
+
+// addVary adds value to the Vary header unless it is already listed.
+func addVary(h http.Header, value string) {
+	for _, v := range h.Values("Vary") {
+		for f := range strings.SplitSeq(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(f), value) {
+				return
+			}
+		}
+	}
+	h.Add("Vary", value)
+}
+
+// compressor holds the settings and writer pools of a Compress middleware.
+type compressor struct {
+	level   int
+	minSize int
+	types   []string
+	gzip    sync.Pool
+	deflate sync.Pool
+}
+
+func newCompressor(cfg CompressConfig) *compressor {
+	c := &compressor{level: cfg.Level, minSize: cfg.MinSize, types: cfg.ContentTypes}
+	if c.level == 0 {
+		c.level = gzip.DefaultCompression
+	}
+	if c.minSize <= 0 {
+		c.minSize = DefaultCompressMinSize
+	}
+	if c.types == nil {
+		c.types = DefaultCompressibleTypes
+	}
+	// Fail on an invalid level now rather than on the first response.
+	if _, err := gzip.NewWriterLevel(io.Discard, c.level); err != nil {
+		panic(fmt.Sprintf("middleware: compress: %v", err))
+	}
+	return c
+}
+
+func (c *compressor) writer(encoding string, w io.Writer) io.WriteCloser {
+	switch encoding {
+	case EncodingGzip:
+		if zw, ok := c.gzip.Get().(*gzip.Writer); ok {
+			zw.Reset(w)
+			return zw
+		}
+		zw, _ := gzip.NewWriterLevel(w, c.level)
+		return zw
+	default:
+		if zw, ok := c.deflate.Get().(*zlib.Writer); ok {
+			zw.Reset(w)
+			return zw
+		}
+		zw, _ := zlib.NewWriterLevel(w, c.level)
+		return zw
+	}
+}
+
+func (c *compressor) release(zw io.WriteCloser) {
+	switch zw := zw.(type) {
+	case *gzip.Writer:
+		c.gzip.Put(zw)
+	case *zlib.Writer:
+		c.deflate.Put(zw)
+	}
+}
+
+// compressible reports whether a body of contentType is worth compressing.
+func (c *compressor) compressible(contentType string) bool {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	if strings.HasSuffix(mt, "+json") || strings.HasSuffix(mt, "+xml") {
+		return true
+	}
+	return slices.ContainsFunc(c.types, func(t string) bool {
+		if prefix, ok := strings.CutSuffix(t, "/*"); ok {
+			return strings.HasPrefix(mt, prefix+"/")
+		}
+		return mt == t
+	})
+}
+
+// compressEncoder compresses the output of the wrapped encoder.
+type compressEncoder struct {
+	httpx.Encoder
+	c        *compressor
+	encoding string
+}
+
+func (e *compressEncoder) EncodeTo(w http.ResponseWriter, statusCode int, data any) error {
+	se, stream := e.Encoder.(httpx.StreamEncoder)
+	var body []byte
+	if !stream {
+		var contentType string
+		var err error
+		body, contentType, err = e.Encoder.Encode(data)
+		if err != nil {
+			// Nothing is written yet, so httpx.Respond can still answer 500.
+			return err
+		}
+		w.Header().Set("Content-Type", contentType)
+	}
+
+	cw := &compressWriter{ResponseWriter: w, c: e.c, encoding: e.encoding}
+	var err error
+	if stream {
+		err = se.EncodeTo(cw, statusCode, data)
+	} else {
+		cw.WriteHeader(statusCode)
+		_, err = cw.Write(body)
+	}
+	return errors.Join(err, cw.close())
+}
+
+// compressWriter buffers the start of a body until it knows whether to
+// compress it: once MinSize bytes were written, the body is flushed, or it
+// ends.
+type compressWriter struct {
+	http.ResponseWriter
+	c        *compressor
+	encoding string
+
+	status  int
+	buf     []byte
+	decided bool
+	zw      io.WriteCloser
+}
+
+func (w *compressWriter) WriteHeader(statusCode int) {
+	if w.status != 0 || w.decided {
+		return
+	}
+	if statusCode < http.StatusOK {
+		w.ResponseWriter.WriteHeader(statusCode)
+		return
+	}
+	w.status = statusCode
+}
+
+func (w *compressWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	if !w.decided {
+		w.buf = append(w.buf, p...)
+		if len(w.buf) < w.c.minSize {
+			return len(p), nil
+		}
+		if err := w.decide(true); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+	if w.zw != nil {
+		return w.zw.Write(p)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// Flush sends everything written so far to the client.
+func (w *compressWriter) Flush() {
+	_ = w.FlushError()
+}
+
+// FlushError is Flush for http.ResponseController.
+func (w *compressWriter) FlushError() error {
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	if !w.decided {
+		if err := w.decide(true); err != nil {
+			return err
+		}
+	}
+	if zw, ok := w.zw.(interface{ Flush() error }); ok {
+		if err := zw.Flush(); err != nil {
+			return err
+		}
+	}
+	return http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// decide writes the header, compressed if allowed and the response
+// qualifies, followed by the buffered body.
+func (w *compressWriter) decide(allow bool) error {
+	w.decided = true
+	h := w.Header()
+
+	if allow && w.shouldCompress(h) {
+		h.Set("Content-Encoding", w.encoding)
+		h.Del("Content-Length")
+		// The compressed body differs from the identity one, so a strong
+		// validator must not be shared with it.
+		if etag := h.Get("ETag"); strings.HasPrefix(etag, `"`) {
+			h.Set("ETag", "W/"+etag)
+		}
+		w.zw = w.c.writer(w.encoding, w.ResponseWriter)
+	}
+
+	w.ResponseWriter.WriteHeader(w.status)
+	buf := w.buf
+	w.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	if w.zw != nil {
+		_, err := w.zw.Write(buf)
+		return err
+	}
+	_, err := w.ResponseWriter.Write(buf)
+	return err
+}
+
+func (w *compressWriter) shouldCompress(h http.Header) bool {
+	switch {
+	case w.status == http.StatusNoContent || w.status == http.StatusPartialContent:
+		return false
+	case w.status >= http.StatusMultipleChoices:
+		return false
+	case h.Get("Content-Encoding") != "" || h.Get("Content-Range") != "":
+		return false
+	}
+	return w.c.compressible(h.Get("Content-Type"))
+}
+
+// close decides on bodies shorter than MinSize and finishes the compressed
+// stream.
+func (w *compressWriter) close() error {
+	if !w.decided {
+		if w.status == 0 {
+			return nil
+		}
+		if err := w.decide(false); err != nil {
+			return err
+		}
+	}
+	if w.zw == nil {
+		return nil
+	}
+	err := w.zw.Close()
+	w.c.release(w.zw)
+	w.zw = nil
+	return err
+}
@@ -1,26 +1,125 @@
 package middleware
 
 import (
-	"github.com/jwbonnell/go-libs/pkg/web/httpx"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jwbonnell/go-libs/pkg/web/httpx"
 )
 
+// CORSConfig configures cross-origin resource sharing. Zero values are
+// replaced with the defaults noted on each field.
+type CORSConfig struct {
+	// AllowedOrigins lists the origins allowed to make cross-origin requests,
+	// e.g. "https://app.example.com". "*" allows any origin and a pattern
+	// such as "https://*.example.com" allows any subdomain. Matching is case
+	// insensitive.
+	AllowedOrigins []string
+	// AllowedMethods defaults to GET, HEAD, POST, PUT, PATCH and DELETE.
+	AllowedMethods []string
+	// AllowedHeaders lists the request headers a client may send. "*" allows
+	// any header. Defaults to Accept, Authorization, Content-Type and
+	// X-CSRF-Token.
+	AllowedHeaders []string
+	// ExposedHeaders lists the response headers scripts may read beyond the
+	// CORS-safelisted ones.
+	ExposedHeaders []string
+	// AllowCredentials lets the browser send cookies and HTTP auth. It can't
+	// be combined with the "*" origin, which would let any site make
+	// credentialed requests.
+	AllowCredentials bool
+	// MaxAge is how long the browser may cache a preflight result. Defaults
+	// to 24 hours; negative disables caching.
+	MaxAge time.Duration
+}
+
+// CORSPolicy applies a CORSConfig to requests.
+type CORSPolicy struct {
+	cfg        CORSConfig
+	anyOrigin  bool
+	origins    map[string]bool
+	patterns   [][2]string // prefix and suffix around the "*"
+	anyHeader  bool
+	headers    map[string]bool
+	methods    string
+	allHeaders string
+	exposed    string
+	maxAge     string
+}
+
+// NewCORSPolicy returns the policy for cfg. It panics if cfg allows
+// credentials from any origin.
+func NewCORSPolicy(cfg CORSConfig) *CORSPolicy {
+	if cfg.AllowCredentials && slices.Contains(cfg.AllowedOrigins, "*") {
+		panic(`middleware: cors: AllowCredentials can't be combined with the "*" origin`)
+	}
+	if len(cfg.AllowedMethods) == 0 {
+		cfg.AllowedMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+	}
+	if len(cfg.AllowedHeaders) == 0 {
+		cfg.AllowedHeaders = []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"}
+	}
+	if cfg.MaxAge == 0 {
+		cfg.MaxAge = 24 * time.Hour
+	}
+
+	p := &CORSPolicy{
+		cfg:     cfg,
+		origins: map[string]bool{},
+		headers: map[string]bool{},
+		exposed: strings.Join(cfg.ExposedHeaders, ", "),
+	}
+	for _, o := range cfg.AllowedOrigins {
+		o = strings.ToLower(o)
+		switch prefix, suffix, ok := strings.Cut(o, "*"); {
+		case o == "*":
+			p.anyOrigin = true
+		case ok:
+			p.patterns = append(p.patterns, [2]string{prefix, suffix})
+		default:
+			p.origins[o] = true
+		}
+	}
+	p.cfg.AllowedMethods = make([]string, len(cfg.AllowedMethods))
+	for i, m := range cfg.AllowedMethods {
+		p.cfg.AllowedMethods[i] = strings.ToUpper(m)
+	}
+	p.methods = strings.Join(p.cfg.AllowedMethods, ", ")
+	for _, h := range cfg.AllowedHeaders {
+		if h == "*" {
+			p.anyHeader = true
+			continue
+		}
+		p.headers[http.CanonicalHeaderKey(h)] = true
+	}
+	p.allHeaders = strings.Join(cfg.AllowedHeaders, ", ")
+	if cfg.MaxAge > 0 {
+		p.maxAge = strconv.Itoa(int(cfg.MaxAge.Seconds()))
+	}
+	return p
+}
+
+// CORS returns middleware allowing cross-origin requests from origins with
+// the CORSConfig defaults. Use NewCORSPolicy for the other settings.
 func CORS(origins []string) httpx.Middleware {
+	return NewCORSPolicy(CORSConfig{AllowedOrigins: origins}).Middleware()
+}
+
+// Middleware sets the CORS headers on responses and answers preflight
+// requests itself with 204 No Content. The route must accept OPTIONS for
+// preflights to reach it; web.App.WithCORSPolicy answers them for every route.
+func (p *CORSPolicy) Middleware() httpx.Middleware {
 	m := func(next httpx.HandlerFunc) httpx.HandlerFunc {
 		h := func(w http.ResponseWriter, r *http.Request) httpx.Response {
-			origin := r.Header.Get("Origin")
-			for _, allowedOrigin := range origins {
-				if allowedOrigin == "*" || origin == allowedOrigin {
-					w.Header().Set("Access-Control-Allow-Origin", origin)
-					break
-				}
+			if IsPreflight(r) {
+				p.setPreflightHeaders(w.Header(), r)
+				return httpx.Response{StatusCode: http.StatusNoContent}
 			}
 
-			w.Header().Set("Access-Control-Allow-Methods", "POST, PATCH, GET, OPTIONS, PUT, DELETE")
-			w.Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization")
-			w.Header().Set("Access-Control-Max-Age", "86400")
-
-			// Additional CORS headers...
+			p.SetHeaders(w, r)
 			return next(w, r)
 		}
 
@@ -29,3 +128,109 @@ func CORS(origins []string) httpx.Middleware {
 
 	return m
 }
+
+// IsPreflight reports whether r is a CORS preflight request.
+func IsPreflight(r *http.Request) bool {
+	return r.Method == http.MethodOptions && r.Header.Get("Origin") != "" && r.Header.Get("Access-Control-Request-Method") != ""
+}
+
+// AllowOrigin reports whether origin may make cross-origin requests.
+func (p *CORSPolicy) AllowOrigin(origin string) bool {
+	if origin == "" {
+		return false
+	}
+	if p.anyOrigin {
+		return true
+	}
+	origin = strings.ToLower(origin)
+	if p.origins[origin] {
+		return true
+	}
+	for _, pat := range p.patterns {
+		prefix, suffix := pat[0], pat[1]
+		if len(origin) > len(prefix)+len(suffix) && strings.HasPrefix(origin, prefix) && strings.HasSuffix(origin, suffix) {
+			// The wildcard stands for subdomain labels, never for a path or
+			// port.
+			if sub := origin[len(prefix) : len(origin)-len(suffix)]; !strings.ContainsAny(sub, "/:") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// SetHeaders sets the CORS headers of a response to an actual, non-preflight,
+// request.
+func (p *CORSPolicy) SetHeaders(w http.ResponseWriter, r *http.Request) {
+	h := w.Header()
+	h.Add("Vary", "Origin")
+
+	origin := r.Header.Get("Origin")
+	if !p.AllowOrigin(origin) {
+		return
+	}
+	p.setOrigin(h, origin)
+	if p.exposed != "" {
+		h.Set("Access-Control-Expose-Headers", p.exposed)
+	}
+}
+
+// Preflight writes the response to a preflight request: 204 No Content, with
+// the CORS headers when the origin, method and headers requested are allowed.
+func (p *CORSPolicy) Preflight(w http.ResponseWriter, r *http.Request) {
+	p.setPreflightHeaders(w.Header(), r)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (p *CORSPolicy) setPreflightHeaders(h http.Header, r *http.Request) {
+	h.Add("Vary", "Origin")
+	h.Add("Vary", "Access-Control-Request-Method")
+	h.Add("Vary", "Access-Control-Request-Headers")
+
+	origin := r.Header.Get("Origin")
+	if p.allowPreflight(r) {
+		p.setOrigin(h, origin)
+		h.Set("Access-Control-Allow-Methods", p.methods)
+		if reqHeaders := r.Header.Get("Access-Control-Request-Headers"); p.anyHeader && reqHeaders != "" {
+			// "*" isn't honored together with credentials, so echo the
+			// request instead.
+			h.Set("Access-Control-Allow-Headers", reqHeaders)
+		} else if !p.anyHeader {
+			h.Set("Access-Control-Allow-Headers", p.allHeaders)
+		}
+		if p.maxAge != "" {
+			h.Set("Access-Control-Max-Age", p.maxAge)
+		}
+	}
+}
+
+func (p *CORSPolicy) allowPreflight(r *http.Request) bool {
+	if !p.AllowOrigin(r.Header.Get("Origin")) {
+		return false
+	}
+	if !slices.Contains(p.cfg.AllowedMethods, strings.ToUpper(r.Header.Get("Access-Control-Request-Method"))) {
+		return false
+	}
+	if p.anyHeader {
+		return true
+	}
+	for _, v := range r.Header.Values("Access-Control-Request-Headers") {
+		for _, name := range strings.Split(v, ",") {
+			if name = strings.TrimSpace(name); name != "" && !p.headers[http.CanonicalHeaderKey(name)] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (p *CORSPolicy) setOrigin(h http.Header, origin string) {
+	if p.anyOrigin {
+		h.Set("Access-Control-Allow-Origin", "*")
+		return
+	}
+	h.Set("Access-Control-Allow-Origin", origin)
+	if p.cfg.AllowCredentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
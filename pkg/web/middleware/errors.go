@@ -1,60 +1,44 @@
 package middleware
 
 import (
+	"net/http"
+
 	"github.com/jwbonnell/go-libs/pkg/logx"
 	"github.com/jwbonnell/go-libs/pkg/web/httpx"
-	"net/http"
 )
 
-// Errors handles errors coming out of the call chain. It detects normal
-// application errors which are used to respond to the client in a uniform way.
-// Unexpected errors (status >= 500) are logged.
+// Errors handles errors coming out of the call chain. Any response carrying
+// an error is replaced with an application/problem+json body built by
+// httpx.NewProblem, completed with the request path as the instance and the
+// request's trace ID. Unexpected errors (status >= 500) are logged as errors
+// and their details are hidden from the client.
+//
+// The original error is kept on the response so outer middleware can still
+// inspect it.
 func Errors(log *logx.Logger) httpx.Middleware {
+	log = log.WithTraceID(httpx.TraceID)
+
 	m := func(next httpx.HandlerFunc) httpx.HandlerFunc {
 		h := func(w http.ResponseWriter, r *http.Request) httpx.Response {
 			ctx := r.Context()
 			resp := next(w, r)
-			if resp.Err != nil {
-				log.Error(ctx, "ERROR", "trace_id", "TODO", "message", resp.Err)
-
-				/*var er v1.ErrorResponse
-				var status int
-
-				switch {
-				case validate.IsFieldErrors(err):
-					fieldErrors := validate.GetFieldErrors(err)
-					er = v1.ErrorResponse{
-						Error:  "data validation error",
-						Fields: fieldErrors.Fields(),
-					}
-					status = http.StatusBadRequest
-
-				case v1.IsRequestError(err):
-					reqErr := v1.GetRequestError(err)
-					er = v1.ErrorResponse{
-						Error: reqErr.Error(),
-					}
-					status = reqErr.Status
+			if resp.Err == nil {
+				return resp
+			}
 
-				case auth.IsAuthError(err):
-					er = v1.ErrorResponse{
-						Error: http.StatusText(http.StatusUnauthorized),
-					}
-					status = http.StatusUnauthorized
+			p := httpx.NewProblem(resp.Err, resp.StatusCode)
+			p.Instance = r.URL.Path
+			p.TraceID = httpx.TraceID(ctx)
 
-				default:
-					er = v1.ErrorResponse{
-						Error: http.StatusText(http.StatusInternalServerError),
-					}
-					status = http.StatusInternalServerError
-				}
-				*/
-				/*if err := httpx.Respond(ctx, w, er, status); err != nil {
-					return err
-				}*/
+			if p.Status >= http.StatusInternalServerError {
+				log.Error(ctx, "request failed", "status", p.Status, "message", resp.Err)
+			} else {
+				log.Info(ctx, "request error", "status", p.Status, "message", resp.Err)
 			}
 
-			return resp
+			pr := httpx.ProblemResponse(p)
+			pr.Err = resp.Err
+			return pr
 		}
 
 		return h
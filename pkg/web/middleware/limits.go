@@ -0,0 +1,108 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/jwbonnell/go-libs/pkg/web/httpx"
+)
+
+// ErrTimeout is reported for requests whose handler failed after the
+// deadline set by Timeout passed.
+var ErrTimeout = errors.New("request timed out")
+
+// Timeout gives every request a context deadline d from now. Handlers must
+// pass the request context to blocking calls; the deadline doesn't interrupt
+// a handler that ignores it. A handler that fails once the deadline passed is
+// answered with 503 Service Unavailable, and one that fails with
+// context.DeadlineExceeded before it, e.g. because a dependency timed out
+// first, with 504 Gateway Timeout. Responses completed in spite of the
+// deadline are sent as usual.
+//
+// Streamed responses such as event streams keep the context until they end,
+// so they are cut off by the deadline too. A d of zero or less disables the
+// timeout.
+func Timeout(d time.Duration) httpx.Middleware {
+	m := func(next httpx.HandlerFunc) httpx.HandlerFunc {
+		if d <= 0 {
+			return next
+		}
+
+		h := func(w http.ResponseWriter, r *http.Request) httpx.Response {
+			ctx, cancel := context.WithTimeout(r.Context(), d)
+
+			resp := next(w, r.WithContext(ctx))
+
+			if resp.Err != nil {
+				switch {
+				case errors.Is(ctx.Err(), context.DeadlineExceeded):
+					resp = httpx.ErrorResponse(fmt.Errorf("%w after %s: %w", ErrTimeout, d, resp.Err), http.StatusServiceUnavailable)
+				case errors.Is(resp.Err, context.DeadlineExceeded):
+					resp = httpx.ErrorResponse(resp.Err, http.StatusGatewayTimeout)
+				}
+			}
+
+			// Streams are written by httpx.Respond after the middleware
+			// returned, so their context must outlive it. Anything else,
+			// including a 204 that Respond never encodes, is done with it.
+			if _, ok := resp.Encoder.(httpx.StreamEncoder); !ok || resp.StatusCode == http.StatusNoContent {
+				cancel()
+				return resp
+			}
+			resp.Encoder = &cancelEncoder{Encoder: resp.Encoder, cancel: cancel}
+			// The stream may still not be written, e.g. when an outer
+			// middleware replaces its encoder, so the context is released at
+			// the end of the request as well. Cancelling twice is harmless.
+			httpx.AfterResponse(r.Context(), cancel)
+			return resp
+		}
+
+		return h
+	}
+
+	return m
+}
+
+// cancelEncoder cancels a request context once its stream was written.
+type cancelEncoder struct {
+	httpx.Encoder
+	cancel context.CancelFunc
+}
+
+func (e *cancelEncoder) EncodeTo(w http.ResponseWriter, statusCode int, data any) error {
+	defer e.cancel()
+	return e.Encoder.(httpx.StreamEncoder).EncodeTo(w, statusCode, data)
+}
+
+// MaxBodySize limits request bodies to n bytes. Requests declaring a larger
+// Content-Length are rejected with 413 straight away; for the others reading
+// past the limit fails, and httpx.Decode reports it as a 413 RequestError
+// wrapping httpx.ErrBodyTooLarge. A limit of zero or less disables the check.
+//
+// Use a route's MaxBodySize to raise or lower the app wide limit for a single
+// route, e.g. for uploads.
+func MaxBodySize(n int64) httpx.Middleware {
+	m := func(next httpx.HandlerFunc) httpx.HandlerFunc {
+		if n <= 0 {
+			return next
+		}
+
+		h := func(w http.ResponseWriter, r *http.Request) httpx.Response {
+			if r.ContentLength > n {
+				return httpx.ErrorResponse(httpx.NewBodyTooLargeError(n), http.StatusRequestEntityTooLarge)
+			}
+			if r.Body != nil && r.Body != http.NoBody {
+				r.Body = http.MaxBytesReader(w, r.Body, n)
+			}
+
+			return next(w, r)
+		}
+
+		return h
+	}
+
+	return m
+}
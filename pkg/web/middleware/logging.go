@@ -9,7 +9,12 @@ import (
 	"github.com/jwbonnell/go-libs/pkg/web/httpx"
 )
 
+// Logger logs every completed request. Streamed responses, such as event
+// streams, are logged when the stream ends. Each line carries the request's
+// trace ID, see httpx.TraceID.
 func Logger(log *logx.Logger) httpx.Middleware {
+	log = log.WithTraceID(httpx.TraceID)
+
 	m := func(next httpx.HandlerFunc) httpx.HandlerFunc {
 		h := func(w http.ResponseWriter, r *http.Request) httpx.Response {
 			ctx := r.Context()
@@ -20,11 +25,21 @@ func Logger(log *logx.Logger) httpx.Middleware {
 				path = fmt.Sprintf("%s?%s", path, r.URL.RawQuery)
 			}
 
+			completed := func(statusCode int) {
+				log.Info(ctx, "request completed", "method", r.Method, "path", path,
+					"remoteaddr", r.RemoteAddr, "statuscode", statusCode, "since", time.Since(v.Now))
+			}
+
 			resp := next(w, r)
 
-			log.Info(ctx, "request completed", "trace_id", v.TraceID, "method", r.Method, "path", path,
-				"remoteaddr", r.RemoteAddr, "statuscode", v.StatusCode, "since", time.Since(v.Now))
+			// Streams are written by httpx.Respond after the middleware
+			// returned, so they are logged once they end.
+			if _, ok := resp.Encoder.(httpx.StreamEncoder); ok && resp.StatusCode != http.StatusNoContent {
+				resp.Encoder = &logEncoder{Encoder: resp.Encoder, completed: completed}
+				return resp
+			}
 
+			completed(resp.StatusCode)
 			return resp
 		}
 
@@ -33,3 +48,31 @@ func Logger(log *logx.Logger) httpx.Middleware {
 
 	return m
 }
+
+// logEncoder logs a request once its stream was written.
+type logEncoder struct {
+	httpx.Encoder
+	completed func(statusCode int)
+}
+
+func (e *logEncoder) EncodeTo(w http.ResponseWriter, statusCode int, data any) error {
+	sw := &statusRecorder{ResponseWriter: w, status: statusCode}
+	defer func() { e.completed(sw.status) }()
+	return e.Encoder.(httpx.StreamEncoder).EncodeTo(sw, statusCode, data)
+}
+
+// statusRecorder records the status a stream actually wrote.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusRecorder) WriteHeader(statusCode int) {
+	w.status = statusCode
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (w *statusRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -1,12 +1,30 @@
 package middleware
 
 import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
-	"github.com/jwbonnell/go-libs/pkg/web/httpx"
-	"github.com/stretchr/testify/require"
+	"fmt"
+	"io"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/jwbonnell/go-libs/pkg/logx"
+	"github.com/jwbonnell/go-libs/pkg/web/auth"
+	"github.com/jwbonnell/go-libs/pkg/web/httpx"
+	"github.com/jwbonnell/go-libs/pkg/web/ratelimit"
+	"github.com/stretchr/testify/require"
 )
 
 func TestPanics_RecoverFromPanic(t *testing.T) {
@@ -90,8 +108,9 @@ func TestCORS_RejectsOtherOrigin(t *testing.T) {
 	}
 
 	// When origin doesn't match, middleware should not set the header.
-	require.Equal(t, w.Header().Get("Access-Control-Allow-Origin"), "")
-	require.Equal(t, w.Header().Get("Access-Control-Allow-Methods"), "POST, PATCH, GET, OPTIONS, PUT, DELETE")
+	require.Equal(t, "", w.Header().Get("Access-Control-Allow-Origin"))
+	require.Equal(t, "Origin", w.Header().Get("Vary"))
+	require.Equal(t, "ok", w.Body.String())
 }
 
 func TestCORS_AllowsWildcardOrigin(t *testing.T) {
@@ -107,9 +126,9 @@ func TestCORS_AllowsWildcardOrigin(t *testing.T) {
 		t.Fatalf("unexpected error: %v", resp.Err)
 	}
 
-	// When wildcard is configured, the middleware sets header to request origin.
-	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "https://any.origin" {
-		t.Fatalf("Allow-Origin = %q; want %q", got, "https://any.origin")
+	// Without credentials a wildcard policy answers with the literal "*".
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Fatalf("Allow-Origin = %q; want %q", got, "*")
 	}
 }
 
@@ -117,8 +136,9 @@ func TestCORS_PreservesExistingHeadersAndSetsDefaults(t *testing.T) {
 	mw := CORS([]string{"https://example.com"})
 	h := mw(httpx.HandlerFunc(okHandler))
 
-	req := httptest.NewRequest("GET", "http://server/", nil)
+	req := httptest.NewRequest("OPTIONS", "http://server/", nil)
 	req.Header.Set("Origin", "https://example.com")
+	req.Header.Set("Access-Control-Request-Method", "PUT")
 
 	w := httptest.NewRecorder()
 	// pre-set a header before middleware runs (simulate upstream)
@@ -132,18 +152,790 @@ func TestCORS_PreservesExistingHeadersAndSetsDefaults(t *testing.T) {
 	if got := w.Header().Get("X-Custom"); got != "v" {
 		t.Fatalf("existing header lost: got %q want %q", got, "v")
 	}
+	// A preflight is answered without calling the handler.
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+	require.Empty(t, w.Body.String())
 	// check required CORS headers
-	if got := w.Header().Get("Access-Control-Allow-Headers"); got == "" {
-		t.Fatalf("Allow-Headers not set")
-	}
+	require.Equal(t, "https://example.com", w.Header().Get("Access-Control-Allow-Origin"))
+	require.Equal(t, "GET, HEAD, POST, PUT, PATCH, DELETE", w.Header().Get("Access-Control-Allow-Methods"))
+	require.Equal(t, "Accept, Authorization, Content-Type, X-CSRF-Token", w.Header().Get("Access-Control-Allow-Headers"))
 	if got := w.Header().Get("Access-Control-Max-Age"); got != "86400" {
 		t.Fatalf("Max-Age = %q; want %q", got, "86400")
 	}
 }
 
+func TestCORSPolicy_AllowOrigin(t *testing.T) {
+	p := NewCORSPolicy(CORSConfig{AllowedOrigins: []string{"https://app.example.com", "https://*.example.org"}})
+
+	tests := []struct {
+		origin string
+		want   bool
+	}{
+		{"https://app.example.com", true},
+		{"HTTPS://APP.EXAMPLE.COM", true},
+		{"http://app.example.com", false},
+		{"https://a.example.org", true},
+		{"https://a.b.example.org", true},
+		{"https://example.org", false},
+		{"https://.example.org", false},
+		{"https://evil.com/.example.org", false},
+		{"https://a.example.org:8443", false},
+		{"https://a.example.org.evil.com", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		require.Equal(t, tt.want, p.AllowOrigin(tt.origin), tt.origin)
+	}
+}
+
+func TestCORSPolicy_CredentialsAndExposedHeaders(t *testing.T) {
+	p := NewCORSPolicy(CORSConfig{
+		AllowedOrigins:   []string{"https://*.example.com"},
+		ExposedHeaders:   []string{"X-Request-ID", "ETag"},
+		AllowCredentials: true,
+	})
+
+	req := httptest.NewRequest("GET", "http://server/", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	w := httptest.NewRecorder()
+	p.SetHeaders(w, req)
+
+	// Credentials can't be combined with "*", so the origin is echoed.
+	require.Equal(t, "https://app.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+	require.Equal(t, "true", w.Header().Get("Access-Control-Allow-Credentials"))
+	require.Equal(t, "X-Request-ID, ETag", w.Header().Get("Access-Control-Expose-Headers"))
+	require.Empty(t, w.Header().Get("Access-Control-Allow-Methods"))
+}
+
+func TestCORSPolicy_CredentialsWithAnyOriginPanics(t *testing.T) {
+	require.Panics(t, func() {
+		NewCORSPolicy(CORSConfig{AllowedOrigins: []string{"https://example.com", "*"}, AllowCredentials: true})
+	})
+	require.NotPanics(t, func() {
+		NewCORSPolicy(CORSConfig{AllowedOrigins: []string{"*"}})
+	})
+}
+
+func TestCORSPolicy_Preflight(t *testing.T) {
+	p := NewCORSPolicy(CORSConfig{
+		AllowedOrigins: []string{"https://example.com"},
+		AllowedMethods: []string{"get", "post"},
+		AllowedHeaders: []string{"Content-Type", "X-Api-Key"},
+		MaxAge:         -1,
+	})
+
+	tests := []struct {
+		name    string
+		origin  string
+		method  string
+		headers string
+		allowed bool
+	}{
+		{"allowed", "https://example.com", "POST", "content-type, x-api-key", true},
+		{"other origin", "https://other.com", "POST", "", false},
+		{"method not allowed", "https://example.com", "DELETE", "", false},
+		{"header not allowed", "https://example.com", "POST", "Authorization", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("OPTIONS", "http://server/", nil)
+			req.Header.Set("Origin", tt.origin)
+			req.Header.Set("Access-Control-Request-Method", tt.method)
+			if tt.headers != "" {
+				req.Header.Set("Access-Control-Request-Headers", tt.headers)
+			}
+			w := httptest.NewRecorder()
+
+			p.Preflight(w, req)
+
+			require.Equal(t, http.StatusNoContent, w.Code)
+			require.Equal(t, []string{"Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers"}, w.Header().Values("Vary"))
+			require.Empty(t, w.Header().Get("Access-Control-Max-Age"))
+			if !tt.allowed {
+				require.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+				return
+			}
+			require.Equal(t, "https://example.com", w.Header().Get("Access-Control-Allow-Origin"))
+			require.Equal(t, "GET, POST", w.Header().Get("Access-Control-Allow-Methods"))
+			require.Equal(t, "Content-Type, X-Api-Key", w.Header().Get("Access-Control-Allow-Headers"))
+		})
+	}
+}
+
+func TestCORSPolicy_PreflightAnyHeader(t *testing.T) {
+	p := NewCORSPolicy(CORSConfig{AllowedOrigins: []string{"https://example.com"}, AllowedHeaders: []string{"*"}})
+
+	req := httptest.NewRequest("OPTIONS", "http://server/", nil)
+	req.Header.Set("Origin", "https://example.com")
+	req.Header.Set("Access-Control-Request-Method", "GET")
+	req.Header.Set("Access-Control-Request-Headers", "x-anything")
+	w := httptest.NewRecorder()
+
+	p.Preflight(w, req)
+
+	require.Equal(t, "x-anything", w.Header().Get("Access-Control-Allow-Headers"))
+}
+
 // simple handler that records it was called
 func okHandler(w http.ResponseWriter, r *http.Request) httpx.Response {
 	w.WriteHeader(http.StatusOK)
 	_, _ = w.Write([]byte("ok"))
 	return httpx.Response{Err: nil}
 }
+
+func TestErrors_TranslatesToProblem(t *testing.T) {
+	var buf bytes.Buffer
+	log := logx.New(&buf, slog.LevelInfo, "unit-tests", httpx.TraceID)
+
+	tests := []struct {
+		name       string
+		resp       httpx.Response
+		wantStatus int
+		wantBody   string
+		wantLevel  string
+	}{
+		{
+			name:       "validation",
+			resp:       httpx.Response{Err: httpx.NewFieldError("name", errors.New("is required"))},
+			wantStatus: http.StatusBadRequest,
+			wantBody:   `{"type":"about:blank","title":"Bad Request","status":400,"detail":"data validation error","instance":"/users","trace_id":"trace-1","errors":[{"field":"name","error":"is required"}]}`,
+			wantLevel:  "INFO",
+		},
+		{
+			name:       "internal",
+			resp:       httpx.JSONResponse(http.StatusOK, nil),
+			wantStatus: http.StatusInternalServerError,
+			wantBody:   `{"type":"about:blank","title":"Internal Server Error","status":500,"instance":"/users","trace_id":"trace-1"}`,
+			wantLevel:  "ERROR",
+		},
+	}
+	tests[1].resp.Err = errors.New("dial tcp: connection refused")
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			buf.Reset()
+			h := Errors(log)(func(w http.ResponseWriter, r *http.Request) httpx.Response {
+				return tc.resp
+			})
+
+			req := httptest.NewRequest("POST", "/users", nil)
+			ctx := httpx.SetValues(req.Context(), &httpx.Values{TraceID: "trace-1"})
+			req = req.WithContext(ctx)
+
+			w := httptest.NewRecorder()
+			resp := h(w, req)
+			require.Equal(t, tc.resp.Err, resp.Err)
+			require.NoError(t, httpx.Respond(ctx, w, resp))
+
+			require.Equal(t, tc.wantStatus, w.Code)
+			require.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+			require.JSONEq(t, tc.wantBody, w.Body.String())
+
+			var entry map[string]any
+			require.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+			require.Equal(t, tc.wantLevel, entry["level"])
+			require.Equal(t, "trace-1", entry["trace_id"])
+		})
+	}
+}
+
+func TestErrors_PassThroughSuccess(t *testing.T) {
+	h := Errors(logx.NewCILogger("unit-tests"))(okHandler)
+	w := httptest.NewRecorder()
+	resp := h(w, httptest.NewRequest("GET", "/", nil))
+	require.NoError(t, resp.Err)
+	require.Nil(t, resp.Data)
+}
+
+// principalHandler responds with the authenticated principal.
+func principalHandler(w http.ResponseWriter, r *http.Request) httpx.Response {
+	p, ok := auth.FromContext(r.Context())
+	if !ok {
+		return httpx.PlainTextResponse(http.StatusOK, "anonymous")
+	}
+	return httpx.JSONResponse(http.StatusOK, p)
+}
+
+func TestJWT(t *testing.T) {
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	h := JWT(auth.NewJWTVerifier(auth.JWTConfig{Keys: auth.StaticKey(secret)}))(principalHandler)
+
+	token, err := auth.Sign(&auth.Claims{
+		Subject:   "user-1",
+		ExpiresAt: auth.NewNumericDate(time.Now().Add(time.Hour)),
+		Roles:     []string{"admin"},
+		Scope:     "read write",
+	}, auth.HS256, secret, "")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name      string
+		header    string
+		status    int
+		challenge string
+	}{
+		{"valid", "Bearer " + token, http.StatusOK, ""},
+		{"missing", "", http.StatusUnauthorized, "Bearer"},
+		{"wrong scheme", "Basic " + token, http.StatusUnauthorized, "Bearer"},
+		{"invalid", "Bearer " + token + "x", http.StatusUnauthorized, `Bearer error="invalid_token"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+
+			resp := h(w, req)
+
+			require.Equal(t, tt.status, resp.StatusCode)
+			require.Equal(t, tt.challenge, w.Header().Get("WWW-Authenticate"))
+			if tt.status != http.StatusOK {
+				require.True(t, httpx.IsAuthError(resp.Err))
+				return
+			}
+			p := resp.Data.(*auth.Principal)
+			require.Equal(t, "user-1", p.Subject)
+			require.Equal(t, auth.MethodJWT, p.Method)
+			require.Equal(t, []string{"admin"}, p.Roles)
+			require.Equal(t, []string{"read", "write"}, p.Scopes)
+			require.NotNil(t, p.Claims)
+		})
+	}
+}
+
+func TestAPIKey(t *testing.T) {
+	store := auth.NewStaticAPIKeys(map[string]auth.Principal{"k-1": {Subject: "billing", Roles: []string{"service"}}})
+	h := APIKey("X-API-Key", store)(principalHandler)
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-API-Key", "k-1")
+	resp := h(httptest.NewRecorder(), req)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	p := resp.Data.(*auth.Principal)
+	require.Equal(t, "billing", p.Subject)
+	require.Equal(t, auth.MethodAPIKey, p.Method)
+
+	for _, key := range []string{"", "k-2"} {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("X-API-Key", key)
+		resp := h(httptest.NewRecorder(), req)
+		require.Equal(t, http.StatusUnauthorized, resp.StatusCode, key)
+		require.True(t, httpx.IsAuthError(resp.Err))
+	}
+
+	// Store failures aren't the client's fault.
+	failing := APIKey("X-API-Key", auth.APIKeyStoreFunc(func(ctx context.Context, key string) (*auth.Principal, error) {
+		return nil, errors.New("db down")
+	}))(principalHandler)
+	resp = failing(httptest.NewRecorder(), req)
+	require.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+}
+
+func TestBasicAuth(t *testing.T) {
+	h := BasicAuth("admin area", auth.BasicAuthUsers(map[string]string{"ada": "s3cret"}))(principalHandler)
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.SetBasicAuth("ada", "s3cret")
+	resp := h(httptest.NewRecorder(), req)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	p := resp.Data.(*auth.Principal)
+	require.Equal(t, "ada", p.Subject)
+	require.Equal(t, auth.MethodBasic, p.Method)
+
+	req = httptest.NewRequest("GET", "/", nil)
+	req.SetBasicAuth("ada", "wrong")
+	w := httptest.NewRecorder()
+	resp = h(w, req)
+	require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	require.Equal(t, `Basic realm="admin area", charset="UTF-8"`, w.Header().Get("WWW-Authenticate"))
+}
+
+func TestAuth_NilPrincipalIsUnauthorized(t *testing.T) {
+	apiKey := APIKey("X-API-Key", auth.APIKeyStoreFunc(func(ctx context.Context, key string) (*auth.Principal, error) {
+		return nil, nil
+	}))(principalHandler)
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-API-Key", "k-1")
+	resp := apiKey(httptest.NewRecorder(), req)
+	require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	require.True(t, httpx.IsAuthError(resp.Err))
+
+	basic := BasicAuth("admin area", func(ctx context.Context, user, pass string) (*auth.Principal, error) {
+		return nil, nil
+	})(principalHandler)
+	req = httptest.NewRequest("GET", "/", nil)
+	req.SetBasicAuth("ada", "s3cret")
+	w := httptest.NewRecorder()
+	resp = basic(w, req)
+	require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	require.True(t, httpx.IsAuthError(resp.Err))
+	require.NotEmpty(t, w.Header().Get("WWW-Authenticate"))
+}
+
+func withPrincipal(p *auth.Principal) *http.Request {
+	req := httptest.NewRequest("GET", "/orders/7", nil)
+	if p != nil {
+		req = req.WithContext(auth.NewContext(req.Context(), p))
+	}
+	return req
+}
+
+func TestRequireRolesAndScopes(t *testing.T) {
+	admin := &auth.Principal{Subject: "ada", Roles: []string{"admin"}, Scopes: []string{"orders:read", "orders:write"}}
+	viewer := &auth.Principal{Subject: "bob", Roles: []string{"viewer"}, Scopes: []string{"orders:read"}}
+
+	tests := []struct {
+		name   string
+		mw     httpx.Middleware
+		p      *auth.Principal
+		status int
+	}{
+		{"role allowed", RequireRoles("admin", "support"), admin, http.StatusOK},
+		{"role denied", RequireRoles("admin", "support"), viewer, http.StatusForbidden},
+		{"no principal", RequireRoles("admin"), nil, http.StatusUnauthorized},
+		{"all scopes granted", RequireScopes("orders:read", "orders:write"), admin, http.StatusOK},
+		{"scope missing", RequireScopes("orders:read", "orders:write"), viewer, http.StatusForbidden},
+		{"scopes without principal", RequireScopes("orders:read"), nil, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := tt.mw(okHandler)(httptest.NewRecorder(), withPrincipal(tt.p))
+
+			if tt.status == http.StatusOK {
+				require.NoError(t, resp.Err)
+				return
+			}
+			require.Equal(t, tt.status, resp.StatusCode)
+			require.True(t, httpx.IsAuthError(resp.Err))
+		})
+	}
+}
+
+func TestAuthorize_Policy(t *testing.T) {
+	owners := map[string]string{"7": "ada"}
+	ownsOrder := func(r *http.Request, p *auth.Principal) (bool, error) {
+		id := r.URL.Path[len("/orders/"):]
+		owner, ok := owners[id]
+		if !ok {
+			return false, httpx.NewRequestError(fmt.Errorf("order %s: %w", id, httpx.ErrNotFound), http.StatusNotFound)
+		}
+		if id == "boom" {
+			return false, errors.New("db down")
+		}
+		return owner == p.Subject, nil
+	}
+	h := Authorize(ownsOrder, "must own the order")(okHandler)
+
+	resp := h(httptest.NewRecorder(), withPrincipal(&auth.Principal{Subject: "ada"}))
+	require.NoError(t, resp.Err)
+
+	resp = h(httptest.NewRecorder(), withPrincipal(&auth.Principal{Subject: "bob", Method: auth.MethodJWT}))
+	require.Equal(t, http.StatusForbidden, resp.StatusCode)
+	require.ErrorContains(t, resp.Err, "jwt bob: must own the order")
+
+	req := withPrincipal(&auth.Principal{Subject: "ada"})
+	req.URL.Path = "/orders/8"
+	resp = h(httptest.NewRecorder(), req)
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	owners["boom"] = "ada"
+	req.URL.Path = "/orders/boom"
+	resp = h(httptest.NewRecorder(), req)
+	require.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+}
+
+func TestRateLimit(t *testing.T) {
+	l := ratelimit.New(ratelimit.Config{Limit: 2, Period: time.Minute})
+	h := RateLimit(logx.NewCILogger("unit-tests"), l, KeyByIP)(principalHandler)
+
+	call := func(remoteAddr string) (*httptest.ResponseRecorder, httpx.Response) {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		return w, h(w, req)
+	}
+
+	for i := range 2 {
+		w, resp := call("10.0.0.1:1234")
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, "2", w.Header().Get("RateLimit-Limit"))
+		require.Equal(t, fmt.Sprint(1-i), w.Header().Get("RateLimit-Remaining"))
+		require.Equal(t, "2;w=60", w.Header().Get("RateLimit-Policy"))
+	}
+
+	// The port doesn't matter, the address does.
+	w, resp := call("10.0.0.1:5678")
+	require.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	require.ErrorIs(t, resp.Err, ratelimit.ErrLimitExceeded)
+	require.Equal(t, "30", w.Header().Get("Retry-After"))
+	require.Equal(t, "0", w.Header().Get("RateLimit-Remaining"))
+
+	_, resp = call("10.0.0.2:1234")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestRateLimit_FailsOpen(t *testing.T) {
+	store := ratelimit.StoreFunc(func(ctx context.Context, key string, ttl time.Duration, fn func(s *ratelimit.State)) error {
+		return errors.New("db down")
+	})
+	l := ratelimit.New(ratelimit.Config{Limit: 1, Store: store})
+	h := RateLimit(logx.NewCILogger("unit-tests"), l, KeyByIP)(principalHandler)
+
+	w := httptest.NewRecorder()
+	resp := h(w, httptest.NewRequest("GET", "/", nil))
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Empty(t, w.Header().Get("RateLimit-Limit"))
+}
+
+func TestRateLimitKeys(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	require.Equal(t, "ip:192.0.2.1", KeyByIP(req))
+	require.Equal(t, "ip:192.0.2.1", KeyByPrincipal(req))
+	require.Equal(t, "ip:192.0.2.1", KeyByHeader("X-API-Key")(req))
+
+	req.Header.Set("X-API-Key", "k-1")
+	sum := sha256.Sum256([]byte("k-1"))
+	require.Equal(t, "header:X-API-Key:"+hex.EncodeToString(sum[:]), KeyByHeader("X-API-Key")(req))
+
+	req = withPrincipal(&auth.Principal{Subject: "ada", Method: auth.MethodJWT})
+	require.Equal(t, "principal:jwt:ada", KeyByPrincipal(req))
+}
+
+func TestNegotiateEncoding(t *testing.T) {
+	tests := map[string]string{
+		"":                           "",
+		"gzip":                       EncodingGzip,
+		"deflate, gzip":              EncodingGzip,
+		"deflate":                    EncodingDeflate,
+		"gzip;q=0.5, deflate":        EncodingDeflate,
+		"br, x-gzip;q=0.8":           EncodingGzip,
+		"*":                          EncodingGzip,
+		"*;q=0.1, gzip;q=0":          EncodingDeflate,
+		"identity":                   "",
+		"gzip;q=0, deflate;Q=0.0":    "",
+		"GZIP ; q=1.0, deflate;q=.9": EncodingGzip,
+	}
+	for accept, want := range tests {
+		require.Equal(t, want, NegotiateEncoding(accept), accept)
+	}
+}
+
+// compressed runs h through Respond for a request with accept as its
+// Accept-Encoding header.
+func compressed(h httpx.HandlerFunc, accept string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", accept)
+	w := httptest.NewRecorder()
+	_ = httpx.Respond(req.Context(), w, h(w, req))
+	return w
+}
+
+func TestCompress_Responses(t *testing.T) {
+	large := strings.Repeat("compressible ", 200)
+	handler := func(resp httpx.Response) httpx.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) httpx.Response { return resp }
+	}
+	mw := Compress(CompressConfig{})
+
+	w := compressed(mw(handler(httpx.JSONResponse(http.StatusOK, map[string]string{"text": large}))), "gzip")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+	require.Equal(t, "Accept-Encoding", w.Header().Get("Vary"))
+	require.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	require.Less(t, w.Body.Len(), len(large))
+	zr, err := gzip.NewReader(w.Body)
+	require.NoError(t, err)
+	var got map[string]string
+	require.NoError(t, json.NewDecoder(zr).Decode(&got))
+	require.Equal(t, large, got["text"])
+
+	w = compressed(mw(handler(httpx.PlainTextResponse(http.StatusOK, large))), "deflate")
+	require.Equal(t, "deflate", w.Header().Get("Content-Encoding"))
+	fr, err := zlib.NewReader(w.Body)
+	require.NoError(t, err)
+	body, err := io.ReadAll(fr)
+	require.NoError(t, err)
+	require.Equal(t, large, string(body))
+
+	// Small bodies, clients without support, unlisted types and
+	// unsuccessful responses are sent as is.
+	for _, tc := range []struct {
+		resp   httpx.Response
+		accept string
+	}{
+		{httpx.PlainTextResponse(http.StatusOK, "small"), "gzip"},
+		{httpx.PlainTextResponse(http.StatusNotFound, large), "gzip"},
+		{httpx.PlainTextResponse(http.StatusInternalServerError, large), "gzip"},
+		{httpx.PlainTextResponse(http.StatusOK, large), ""},
+		{httpx.Response{StatusCode: http.StatusOK, Data: large, Encoder: binaryEncoder{}}, "gzip"},
+	} {
+		w = compressed(mw(handler(tc.resp)), tc.accept)
+		require.Empty(t, w.Header().Get("Content-Encoding"))
+		require.Equal(t, "Accept-Encoding", w.Header().Get("Vary"))
+		require.Equal(t, tc.resp.Data, w.Body.String())
+	}
+}
+
+func TestCompress_EncodeFailureIsA500(t *testing.T) {
+	h := Compress(CompressConfig{})(func(w http.ResponseWriter, r *http.Request) httpx.Response {
+		return httpx.PlainTextResponse(http.StatusOK, struct{}{})
+	})
+
+	w := compressed(h, "gzip")
+	require.Equal(t, http.StatusInternalServerError, w.Code)
+	require.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+	require.Empty(t, w.Header().Get("Content-Encoding"))
+	require.JSONEq(t, `{"type":"about:blank","title":"Internal Server Error","status":500}`, w.Body.String())
+}
+
+type binaryEncoder struct{}
+
+func (binaryEncoder) Encode(data any) ([]byte, string, error) {
+	return []byte(data.(string)), "application/octet-stream", nil
+}
+
+func TestCompress_FileResponses(t *testing.T) {
+	content := strings.Repeat("file content ", 200)
+	fsys := fstest.MapFS{"notes.txt": {Data: []byte(content)}}
+	h := Compress(CompressConfig{})(func(w http.ResponseWriter, r *http.Request) httpx.Response {
+		return httpx.FSFileResponse(r, fsys, "notes.txt", false)
+	})
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	require.NoError(t, httpx.Respond(req.Context(), w, h(w, req)))
+	require.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+	require.Empty(t, w.Header().Get("Content-Length"))
+
+	// Ranges address the identity body, so they are never compressed.
+	req.Header.Set("Range", "bytes=0-3")
+	w = httptest.NewRecorder()
+	require.NoError(t, httpx.Respond(req.Context(), w, h(w, req)))
+	require.Equal(t, http.StatusPartialContent, w.Code)
+	require.Empty(t, w.Header().Get("Content-Encoding"))
+	require.Equal(t, "file", w.Body.String())
+}
+
+func TestCompress_StreamsEvents(t *testing.T) {
+	events := make(chan httpx.Event)
+	h := Compress(CompressConfig{})(func(w http.ResponseWriter, r *http.Request) httpx.Response {
+		return httpx.SSEResponse(r, events)
+	})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = httpx.Respond(r.Context(), w, h(w, r))
+	}))
+	defer srv.Close()
+
+	req, err := http.NewRequest("GET", srv.URL, nil)
+	require.NoError(t, err)
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, "gzip", resp.Header.Get("Content-Encoding"))
+	require.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	// Each event must reach the client before the stream ends.
+	events <- httpx.Event{ID: "1", Data: "hello"}
+	zr, err := gzip.NewReader(resp.Body)
+	require.NoError(t, err)
+	sc := bufio.NewScanner(zr)
+	require.True(t, sc.Scan())
+	require.Equal(t, "id: 1", sc.Text())
+	require.True(t, sc.Scan())
+	require.Equal(t, "data: hello", sc.Text())
+	close(events)
+}
+
+func TestCompress_DecompressesRequests(t *testing.T) {
+	echo := func(w http.ResponseWriter, r *http.Request) httpx.Response {
+		var v map[string]string
+		if err := httpx.Decode(r, &v); err != nil {
+			return httpx.ErrorResponse(httpx.NewRequestError(err, http.StatusBadRequest), http.StatusBadRequest)
+		}
+		return httpx.JSONResponse(http.StatusOK, v)
+	}
+	h := Compress(CompressConfig{DecompressRequests: true})(echo)
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, _ = zw.Write([]byte(`{"name":"ada"}`))
+	require.NoError(t, zw.Close())
+
+	req := httptest.NewRequest("POST", "/", bytes.NewReader(buf.Bytes()))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Encoding", "gzip")
+	resp := h(httptest.NewRecorder(), req)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, map[string]string{"name": "ada"}, resp.Data)
+	require.Empty(t, req.Header.Get("Content-Encoding"))
+
+	for encoding, status := range map[string]int{"gzip": http.StatusBadRequest, "br": http.StatusUnsupportedMediaType} {
+		req := httptest.NewRequest("POST", "/", strings.NewReader(`{"name":"ada"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Content-Encoding", encoding)
+		resp := h(httptest.NewRecorder(), req)
+		require.Equal(t, status, resp.StatusCode, encoding)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	slow := func(w http.ResponseWriter, r *http.Request) httpx.Response {
+		<-r.Context().Done()
+		return httpx.ErrorResponse(r.Context().Err(), http.StatusInternalServerError)
+	}
+	resp := Timeout(10*time.Millisecond)(slow)(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	require.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	require.ErrorIs(t, resp.Err, ErrTimeout)
+	require.Equal(t, "application/problem+json", mustEncode(t, resp))
+
+	// A dependency timing out before the request deadline.
+	upstream := func(w http.ResponseWriter, r *http.Request) httpx.Response {
+		return httpx.ErrorResponse(fmt.Errorf("query: %w", context.DeadlineExceeded), http.StatusInternalServerError)
+	}
+	resp = Timeout(time.Minute)(upstream)(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	require.Equal(t, http.StatusGatewayTimeout, resp.StatusCode)
+
+	// Handlers see the deadline; successful responses pass through.
+	var deadline time.Time
+	h := Timeout(time.Minute)(func(w http.ResponseWriter, r *http.Request) httpx.Response {
+		deadline, _ = r.Context().Deadline()
+		return httpx.PlainTextResponse(http.StatusOK, "ok")
+	})
+	resp = h(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.WithinDuration(t, time.Now().Add(time.Minute), deadline, time.Second)
+
+	// Disabled.
+	resp = Timeout(0)(okHandler)(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	require.NoError(t, resp.Err)
+}
+
+func mustEncode(t *testing.T, resp httpx.Response) string {
+	t.Helper()
+	_, contentType, err := resp.Encoder.Encode(resp.Data)
+	require.NoError(t, err)
+	return contentType
+}
+
+func TestTimeout_StreamsKeepContextUntilWritten(t *testing.T) {
+	events := make(chan httpx.Event, 1)
+	var req *http.Request
+	h := Timeout(time.Minute)(func(w http.ResponseWriter, r *http.Request) httpx.Response {
+		req = r
+		return httpx.SSEResponse(r, events)
+	})
+
+	w := httptest.NewRecorder()
+	resp := h(w, httptest.NewRequest("GET", "/", nil))
+	require.NoError(t, req.Context().Err())
+
+	events <- httpx.Event{Data: "hello"}
+	close(events)
+	require.NoError(t, httpx.Respond(req.Context(), w, resp))
+	require.Contains(t, w.Body.String(), "data: hello")
+	require.ErrorIs(t, req.Context().Err(), context.Canceled)
+}
+
+func TestTimeout_NoContentStreamReleasesContext(t *testing.T) {
+	var req *http.Request
+	h := Timeout(time.Minute)(func(w http.ResponseWriter, r *http.Request) httpx.Response {
+		req = r
+		resp := httpx.SSEResponse(r, make(chan httpx.Event))
+		resp.StatusCode = http.StatusNoContent
+		return resp
+	})
+
+	// Respond never encodes a 204, so the context is released right away.
+	resp := h(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+	require.ErrorIs(t, req.Context().Err(), context.Canceled)
+}
+
+func TestMaxBodySize(t *testing.T) {
+	decode := func(w http.ResponseWriter, r *http.Request) httpx.Response {
+		var v map[string]string
+		if err := httpx.DecodeAndValidate(r, &v); err != nil {
+			return httpx.ErrorResponse(err, http.StatusBadRequest)
+		}
+		return httpx.JSONResponse(http.StatusOK, v)
+	}
+	h := MaxBodySize(16)(decode)
+
+	req := httptest.NewRequest("POST", "/", strings.NewReader(`{"a":"b"}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp := h(httptest.NewRecorder(), req)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// Declared too large.
+	req = httptest.NewRequest("POST", "/", strings.NewReader(`{"a":"a long value"}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp = h(httptest.NewRecorder(), req)
+	require.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+	require.ErrorIs(t, resp.Err, httpx.ErrBodyTooLarge)
+
+	// Found too large while reading.
+	req = httptest.NewRequest("POST", "/", strings.NewReader(`{"a":"a long value"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.ContentLength = -1
+	resp = h(httptest.NewRecorder(), req)
+	require.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+	require.ErrorIs(t, resp.Err, httpx.ErrBodyTooLarge)
+}
+
+func TestSecureHeaders(t *testing.T) {
+	s := NewSecureHeaders(SecureHeadersConfig{
+		HSTSMaxAge:                365 * 24 * time.Hour,
+		ContentSecurityPolicy:     "default-src 'self'",
+		CSPReportOnly:             true,
+		PermissionsPolicy:         "camera=()",
+		CrossOriginEmbedderPolicy: "require-corp",
+	})
+
+	w := httptest.NewRecorder()
+	w.Header().Set("X-Frame-Options", "DENY")
+	r := s.Apply(w, httptest.NewRequest("GET", "https://example.test/", nil))
+
+	require.Equal(t, "max-age=31536000", w.Header().Get("Strict-Transport-Security"))
+	require.Equal(t, "default-src 'self'", w.Header().Get("Content-Security-Policy-Report-Only"))
+	require.Empty(t, w.Header().Get("Content-Security-Policy"))
+	require.Equal(t, "camera=()", w.Header().Get("Permissions-Policy"))
+	require.Equal(t, "require-corp", w.Header().Get("Cross-Origin-Embedder-Policy"))
+	// Headers the policy leaves out are removed.
+	require.Empty(t, w.Header().Get("X-Frame-Options"))
+	require.Empty(t, CSPNonce(r.Context()))
+}
+
+func TestSecureHeaders_HSTSOnlyOverTLS(t *testing.T) {
+	cfg := SecureHeadersConfig{HSTSMaxAge: time.Hour}
+
+	w := httptest.NewRecorder()
+	w.Header().Set("Strict-Transport-Security", "max-age=60")
+	NewSecureHeaders(cfg).Apply(w, httptest.NewRequest("GET", "http://example.test/", nil))
+	require.Empty(t, w.Header().Get("Strict-Transport-Security"))
+
+	// Behind a proxy terminating TLS.
+	cfg.HSTSWithoutTLS = true
+	w = httptest.NewRecorder()
+	NewSecureHeaders(cfg).Apply(w, httptest.NewRequest("GET", "http://example.test/", nil))
+	require.Equal(t, "max-age=3600", w.Header().Get("Strict-Transport-Security"))
+}
+
+func TestSecureHeaders_MiddlewareNonce(t *testing.T) {
+	s := NewSecureHeaders(SecureHeadersConfig{ContentSecurityPolicy: "script-src 'nonce-{nonce}'; style-src 'nonce-{nonce}'"})
+	h := s.Middleware()(func(w http.ResponseWriter, r *http.Request) httpx.Response {
+		return httpx.PlainTextResponse(http.StatusOK, CSPNonce(r.Context()))
+	})
+
+	w := httptest.NewRecorder()
+	resp := h(w, httptest.NewRequest("GET", "/", nil))
+
+	nonce := resp.Data.(string)
+	require.Len(t, nonce, 24)
+	require.Equal(t, "script-src 'nonce-"+nonce+"'; style-src 'nonce-"+nonce+"'", w.Header().Get("Content-Security-Policy"))
+}
@@ -25,7 +25,14 @@ func Panics() httpx.Middleware {
 				}
 			}()
 
-			return next(w, r)
+			resp = next(w, r)
+
+			// Streams are written by httpx.Respond after the middleware
+			// returned, so recover from their panics there too.
+			if _, ok := resp.Encoder.(httpx.StreamEncoder); ok {
+				resp.Encoder = &panicEncoder{Encoder: resp.Encoder}
+			}
+			return resp
 		}
 
 		return h
@@ -33,3 +40,18 @@ func Panics() httpx.Middleware {
 
 	return m
 }
+
+// panicEncoder recovers from a panic while a stream is written and returns
+// it as an error. The status and whatever was streamed are already sent.
+type panicEncoder struct {
+	httpx.Encoder
+}
+
+func (e *panicEncoder) EncodeTo(w http.ResponseWriter, statusCode int, data any) (err error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			err = fmt.Errorf("PANIC [%v] TRACE[%s]", rec, string(debug.Stack()))
+		}
+	}()
+	return e.Encoder.(httpx.StreamEncoder).EncodeTo(w, statusCode, data)
+}
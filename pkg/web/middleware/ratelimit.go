@@ -0,0 +1,100 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jwbonnell/go-libs/pkg/logx"
+	"github.com/jwbonnell/go-libs/pkg/web/auth"
+	"github.com/jwbonnell/go-libs/pkg/web/httpx"
+	"github.com/jwbonnell/go-libs/pkg/web/ratelimit"
+)
+
+// KeyFunc returns the key a request is rate limited by. Requests with an
+// empty key aren't limited.
+type KeyFunc func(r *http.Request) string
+
+// KeyByIP limits by the client's IP address taken from r.RemoteAddr. Behind a
+// proxy, rewrite RemoteAddr from a trusted forwarding header first or use a
+// custom KeyFunc.
+func KeyByIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// KeyByPrincipal limits authenticated requests by their principal and the
+// others by IP. It must run after an authentication middleware.
+func KeyByPrincipal(r *http.Request) string {
+	if p, ok := auth.FromContext(r.Context()); ok {
+		return "principal:" + p.Method + ":" + p.Subject
+	}
+	return KeyByIP(r)
+}
+
+// KeyByHeader limits by the value of header, e.g. an API key in "X-API-Key".
+// The value is hashed with SHA-256 so secrets such as API keys don't end up
+// in the store or the logs. Requests without the header are limited by IP.
+func KeyByHeader(header string) KeyFunc {
+	return func(r *http.Request) string {
+		if v := r.Header.Get(header); v != "" {
+			sum := sha256.Sum256([]byte(v))
+			return "header:" + header + ":" + hex.EncodeToString(sum[:])
+		}
+		return KeyByIP(r)
+	}
+}
+
+// RateLimit limits requests per key with l. Every response gets the
+// RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset and RateLimit-Policy
+// headers; rejected requests get 429 and Retry-After. If the store fails the
+// request is allowed and the error logged, so an outage of a shared store
+// doesn't take the service down.
+func RateLimit(log *logx.Logger, l *ratelimit.Limiter, key KeyFunc) httpx.Middleware {
+	log = log.WithTraceID(httpx.TraceID)
+
+	m := func(next httpx.HandlerFunc) httpx.HandlerFunc {
+		h := func(w http.ResponseWriter, r *http.Request) httpx.Response {
+			k := key(r)
+			if k == "" {
+				return next(w, r)
+			}
+
+			res, err := l.Allow(r.Context(), k)
+			if err != nil {
+				log.Error(r.Context(), "rate limit", "key", k, "err", err)
+				return next(w, r)
+			}
+
+			hdr := w.Header()
+			hdr.Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+			hdr.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+			hdr.Set("RateLimit-Reset", seconds(res.Reset))
+			hdr.Set("RateLimit-Policy", l.Policy())
+
+			if !res.Allowed {
+				hdr.Set("Retry-After", seconds(res.RetryAfter))
+				err := httpx.NewRequestError(ratelimit.ErrLimitExceeded, http.StatusTooManyRequests)
+				return httpx.ErrorResponse(err, http.StatusTooManyRequests)
+			}
+
+			return next(w, r)
+		}
+
+		return h
+	}
+
+	return m
+}
+
+// seconds formats d as whole seconds, rounded up.
+func seconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
@@ -0,0 +1,185 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jwbonnell/go-libs/pkg/web/httpx"
+)
+
+// NoncePlaceholder is replaced with a fresh nonce for every request in a
+// SecureHeadersConfig.ContentSecurityPolicy, e.g.
+// "script-src 'self' 'nonce-{nonce}'". Templates read the nonce with
+// CSPNonce.
+const NoncePlaceholder = "{nonce}"
+
+// SecureHeadersConfig configures the security headers set by a
+// SecureHeaders policy. Empty fields leave their header out, so the zero
+// value sets none.
+type SecureHeadersConfig struct {
+	// HSTSMaxAge enables Strict-Transport-Security with this max-age. It is
+	// only sent over TLS, so plain-HTTP development servers don't get it.
+	HSTSMaxAge            time.Duration
+	HSTSIncludeSubdomains bool
+	// HSTSPreload asks for inclusion in the browsers' HSTS preload lists,
+	// which requires a max-age of at least a year and HSTSIncludeSubdomains.
+	HSTSPreload bool
+	// HSTSWithoutTLS sends Strict-Transport-Security on plain-HTTP requests
+	// too, for servers behind a proxy that terminates TLS.
+	HSTSWithoutTLS bool
+
+	// ContentSecurityPolicy is sent as Content-Security-Policy, or as
+	// Content-Security-Policy-Report-Only with CSPReportOnly. Any
+	// NoncePlaceholder in it is replaced with a per request nonce.
+	ContentSecurityPolicy string
+	CSPReportOnly         bool
+
+	// ContentTypeNosniff sets X-Content-Type-Options: nosniff.
+	ContentTypeNosniff bool
+	// FrameOptions is sent as X-Frame-Options, "DENY" or "SAMEORIGIN".
+	FrameOptions string
+	// ReferrerPolicy is sent as Referrer-Policy, e.g.
+	// "strict-origin-when-cross-origin".
+	ReferrerPolicy string
+	// PermissionsPolicy is sent as Permissions-Policy, e.g.
+	// "camera=(), geolocation=()".
+	PermissionsPolicy string
+	// CrossOriginOpenerPolicy is sent as Cross-Origin-Opener-Policy, e.g.
+	// "same-origin".
+	CrossOriginOpenerPolicy string
+	// CrossOriginEmbedderPolicy is sent as Cross-Origin-Embedder-Policy, e.g.
+	// "require-corp".
+	CrossOriginEmbedderPolicy string
+}
+
+// DefaultSecureHeadersConfig returns a recommended policy to pass to
+// App.WithSecureHeaders: two years of HSTS with subdomains and preload,
+// nosniff, DENY framing, a strict-origin-when-cross-origin referrer policy
+// and a same-origin opener policy. Content-Security-Policy depends on the
+// app's pages and Cross-Origin-Embedder-Policy can break cross-origin
+// resources, so neither is set. Without it an App sends only HSTS, over TLS.
+func DefaultSecureHeadersConfig() SecureHeadersConfig {
+	return SecureHeadersConfig{
+		// Max-age is set to 2 years, and is suffixed with preload, which is
+		// necessary for inclusion in all major web browsers' HSTS preload
+		// lists, like Chromium, Edge, and Firefox.
+		HSTSMaxAge:              2 * 365 * 24 * time.Hour,
+		HSTSIncludeSubdomains:   true,
+		HSTSPreload:             true,
+		ContentTypeNosniff:      true,
+		FrameOptions:            "DENY",
+		ReferrerPolicy:          "strict-origin-when-cross-origin",
+		CrossOriginOpenerPolicy: "same-origin",
+	}
+}
+
+// SecureHeaders is a security header policy. Apply it to every request with
+// App.WithSecureHeaders, and to single routes with Middleware, which replaces
+// the app's headers with the route's.
+type SecureHeaders struct {
+	headers        [][2]string
+	hstsWithoutTLS bool
+	csp            string
+	cspHeader      string
+}
+
+// NewSecureHeaders returns the policy for cfg.
+func NewSecureHeaders(cfg SecureHeadersConfig) *SecureHeaders {
+	s := &SecureHeaders{hstsWithoutTLS: cfg.HSTSWithoutTLS, csp: cfg.ContentSecurityPolicy, cspHeader: "Content-Security-Policy"}
+	if cfg.CSPReportOnly {
+		s.cspHeader = "Content-Security-Policy-Report-Only"
+	}
+
+	var hsts string
+	if cfg.HSTSMaxAge > 0 {
+		hsts = "max-age=" + strconv.FormatInt(int64(cfg.HSTSMaxAge.Seconds()), 10)
+		if cfg.HSTSIncludeSubdomains {
+			hsts += "; includeSubDomains"
+		}
+		if cfg.HSTSPreload {
+			hsts += "; preload"
+		}
+	}
+	var nosniff string
+	if cfg.ContentTypeNosniff {
+		nosniff = "nosniff"
+	}
+
+	s.headers = [][2]string{
+		{"Strict-Transport-Security", hsts},
+		{"X-Content-Type-Options", nosniff},
+		{"X-Frame-Options", cfg.FrameOptions},
+		{"Referrer-Policy", cfg.ReferrerPolicy},
+		{"Permissions-Policy", cfg.PermissionsPolicy},
+		{"Cross-Origin-Opener-Policy", cfg.CrossOriginOpenerPolicy},
+		{"Cross-Origin-Embedder-Policy", cfg.CrossOriginEmbedderPolicy},
+	}
+	return s
+}
+
+// Middleware applies the policy to the route's responses, replacing headers
+// set by the app's policy.
+func (s *SecureHeaders) Middleware() httpx.Middleware {
+	m := func(next httpx.HandlerFunc) httpx.HandlerFunc {
+		h := func(w http.ResponseWriter, r *http.Request) httpx.Response {
+			return next(w, s.Apply(w, r))
+		}
+
+		return h
+	}
+
+	return m
+}
+
+// Apply sets the policy's headers on w, removing the ones it leaves out,
+// and returns r with the request's CSP nonce in its context if the policy
+// uses one.
+func (s *SecureHeaders) Apply(w http.ResponseWriter, r *http.Request) *http.Request {
+	plainHTTP := r.TLS == nil && !s.hstsWithoutTLS
+	h := w.Header()
+	for _, kv := range s.headers {
+		if kv[1] == "" || (plainHTTP && kv[0] == "Strict-Transport-Security") {
+			h.Del(kv[0])
+		} else {
+			h.Set(kv[0], kv[1])
+		}
+	}
+
+	h.Del("Content-Security-Policy")
+	h.Del("Content-Security-Policy-Report-Only")
+	if !strings.Contains(s.csp, NoncePlaceholder) {
+		if s.csp != "" {
+			h.Set(s.cspHeader, s.csp)
+		}
+		// Drop the nonce of a policy this one replaces.
+		if CSPNonce(r.Context()) != "" {
+			r = r.WithContext(context.WithValue(r.Context(), nonceKey{}, ""))
+		}
+		return r
+	}
+
+	nonce := newNonce()
+	h.Set(s.cspHeader, strings.ReplaceAll(s.csp, NoncePlaceholder, nonce))
+	return r.WithContext(context.WithValue(r.Context(), nonceKey{}, nonce))
+}
+
+type nonceKey struct{}
+
+// CSPNonce returns the nonce of the request's Content-Security-Policy, for
+// use in nonce attributes of inline scripts and styles, or "" if the policy
+// has none.
+func CSPNonce(ctx context.Context) string {
+	nonce, _ := ctx.Value(nonceKey{}).(string)
+	return nonce
+}
+
+func newNonce() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return base64.StdEncoding.EncodeToString(b)
+}
@@ -0,0 +1,121 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jwbonnell/go-libs/pkg/db"
+	"github.com/jwbonnell/go-libs/pkg/db/queriers"
+)
+
+// DefaultTable is the table PostgresStore uses when none is given.
+const DefaultTable = "rate_limits"
+
+// PostgresStore keeps state in a Postgres table so every instance using the
+// same database shares the limits. Each Update locks the key's row for the
+// duration of a short transaction. Create the table with CreateTable or an
+// equivalent migration and remove stale rows with DeleteExpired.
+type PostgresStore struct {
+	q     queriers.Querier
+	table string
+}
+
+// NewPostgresStore returns a store using table (DefaultTable if empty),
+// e.g. NewPostgresStore(d.Pool(), "") for a *db.DB d.
+func NewPostgresStore(q queriers.Querier, table string) *PostgresStore {
+	if table == "" {
+		table = DefaultTable
+	}
+	return &PostgresStore{q: q, table: pgx.Identifier{table}.Sanitize()}
+}
+
+// CreateTable creates the store's table and its expiry index if they don't
+// exist.
+func (s *PostgresStore) CreateTable(ctx context.Context) error {
+	stmts := []string{
+		`CREATE TABLE IF NOT EXISTS ` + s.table + ` (
+			key         text PRIMARY KEY,
+			value       double precision NOT NULL DEFAULT 0,
+			prev        double precision NOT NULL DEFAULT 0,
+			window_time timestamptz,
+			expires_at  timestamptz NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS ` + pgx.Identifier{s.unquotedTable() + "_expires_at_idx"}.Sanitize() +
+			` ON ` + s.table + ` (expires_at)`,
+	}
+	for _, stmt := range stmts {
+		if _, err := s.q.Exec(ctx, stmt); err != nil {
+			return fmt.Errorf("create rate limit table: %w", err)
+		}
+	}
+	return nil
+}
+
+// DeleteExpired removes the state of keys that haven't been used for their
+// ttl and returns how many were removed. Run it periodically.
+func (s *PostgresStore) DeleteExpired(ctx context.Context) (int64, error) {
+	tag, err := s.q.Exec(ctx, `DELETE FROM `+s.table+` WHERE expires_at < @now`, pgx.NamedArgs{"now": time.Now()})
+	if err != nil {
+		return 0, fmt.Errorf("delete expired rate limits: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+type stateRow struct {
+	Value      float64    `db:"value"`
+	Prev       float64    `db:"prev"`
+	WindowTime *time.Time `db:"window_time"`
+	ExpiresAt  time.Time  `db:"expires_at"`
+}
+
+func (s *PostgresStore) Update(ctx context.Context, key string, ttl time.Duration, fn func(st *State)) error {
+	now := time.Now()
+	expires := now.Add(ttl)
+
+	tx, err := s.q.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin: %w", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	// Make sure the row exists so it can be locked.
+	_, err = tx.Exec(ctx, `INSERT INTO `+s.table+` (key, expires_at) VALUES (@key, @expires_at) ON CONFLICT (key) DO NOTHING`,
+		pgx.NamedArgs{"key": key, "expires_at": expires})
+	if err != nil {
+		return fmt.Errorf("insert: %w", err)
+	}
+
+	var row stateRow
+	err = db.QueryOne(ctx, tx, `SELECT value, prev, window_time, expires_at FROM `+s.table+` WHERE key = @key FOR UPDATE`, &row,
+		pgx.NamedArgs{"key": key})
+	if err != nil {
+		return fmt.Errorf("select: %w", err)
+	}
+
+	var st State
+	if row.ExpiresAt.After(now) && row.WindowTime != nil {
+		st = State{Value: row.Value, Prev: row.Prev, Time: *row.WindowTime}
+	}
+	fn(&st)
+
+	var windowTime *time.Time
+	if !st.Time.IsZero() {
+		windowTime = &st.Time
+	}
+	_, err = tx.Exec(ctx, `UPDATE `+s.table+` SET value = @value, prev = @prev, window_time = @window_time, expires_at = @expires_at WHERE key = @key`,
+		pgx.NamedArgs{"key": key, "value": st.Value, "prev": st.Prev, "window_time": windowTime, "expires_at": expires})
+	if err != nil {
+		return fmt.Errorf("update: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+	return nil
+}
+
+func (s *PostgresStore) unquotedTable() string {
+	return s.table[1 : len(s.table)-1]
+}
@@ -0,0 +1,222 @@
+// Package ratelimit implements token bucket and sliding window rate limiting
+// on top of a pluggable Store: MemoryStore for a single instance and
+// PostgresStore to share limits between instances. middleware.RateLimit
+// applies a Limiter to requests.
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+)
+
+// ErrLimitExceeded is reported for requests rejected by a Limiter.
+var ErrLimitExceeded = errors.New("rate limit exceeded")
+
+// Algorithm selects how a Limiter counts requests.
+type Algorithm int
+
+const (
+	// TokenBucket allows bursts of up to Burst requests and refills at Limit
+	// requests per Period.
+	TokenBucket Algorithm = iota
+	// SlidingWindow allows Limit requests in any Period, estimated from the
+	// counts of the current and the previous fixed window.
+	SlidingWindow
+)
+
+// State is the per-key state a Store keeps for an algorithm.
+type State struct {
+	// Value holds the tokens left in a bucket, or the count of the current
+	// window.
+	Value float64
+	// Prev holds the count of the previous window.
+	Prev float64
+	// Time is when a bucket was last updated, or when the current window
+	// started. It is zero for a key without state.
+	Time time.Time
+}
+
+// Store keeps the state of every key. Update must apply fn to the state of
+// key atomically, also across instances for shared stores, and may forget
+// the state once it hasn't been updated for ttl.
+type Store interface {
+	Update(ctx context.Context, key string, ttl time.Duration, fn func(s *State)) error
+}
+
+// StoreFunc adapts a function to a Store.
+type StoreFunc func(ctx context.Context, key string, ttl time.Duration, fn func(s *State)) error
+
+func (f StoreFunc) Update(ctx context.Context, key string, ttl time.Duration, fn func(s *State)) error {
+	return f(ctx, key, ttl, fn)
+}
+
+// Config configures a Limiter. Zero values are replaced with the defaults
+// noted on each field.
+type Config struct {
+	Algorithm Algorithm
+	// Limit is the number of requests allowed per Period. Required.
+	Limit int
+	// Period defaults to one minute.
+	Period time.Duration
+	// Burst is the capacity of a token bucket. Defaults to Limit.
+	Burst int
+	// Store defaults to a new MemoryStore.
+	Store Store
+	// Prefix namespaces the keys of this limiter in a shared store, so
+	// several limiters can use the same one.
+	Prefix string
+	// Now defaults to time.Now.
+	Now func() time.Time
+}
+
+// Limiter decides whether requests identified by a key are within their
+// rate.
+type Limiter struct {
+	cfg Config
+}
+
+// New returns a Limiter for cfg. It panics if cfg.Limit isn't positive.
+func New(cfg Config) *Limiter {
+	if cfg.Limit <= 0 {
+		panic("ratelimit: Limit must be positive")
+	}
+	if cfg.Period <= 0 {
+		cfg.Period = time.Minute
+	}
+	if cfg.Burst <= 0 {
+		cfg.Burst = cfg.Limit
+	}
+	if cfg.Store == nil {
+		cfg.Store = NewMemoryStore()
+	}
+	if cfg.Now == nil {
+		cfg.Now = time.Now
+	}
+	return &Limiter{cfg: cfg}
+}
+
+// Result is the outcome of Allow.
+type Result struct {
+	Allowed bool
+	// Limit is the number of requests allowed per period, the burst size for
+	// a token bucket.
+	Limit int
+	// Remaining is the number of requests still allowed right now.
+	Remaining int
+	// Reset is how long until the limit is restored: until the bucket is
+	// full, or the current window ends.
+	Reset time.Duration
+	// RetryAfter is how long a rejected client should wait before trying
+	// again. It is zero for allowed requests.
+	RetryAfter time.Duration
+}
+
+// Allow counts a request for key and reports whether it is within the
+// limit. Rejected requests aren't counted.
+func (l *Limiter) Allow(ctx context.Context, key string) (Result, error) {
+	now := l.cfg.Now()
+
+	var res Result
+	var fn func(s *State)
+	var ttl time.Duration
+	switch l.cfg.Algorithm {
+	case TokenBucket:
+		fn = func(s *State) { res = l.tokenBucket(s, now) }
+		ttl = l.refillTime(float64(l.cfg.Burst))
+	case SlidingWindow:
+		fn = func(s *State) { res = l.slidingWindow(s, now) }
+		ttl = 2 * l.cfg.Period
+	default:
+		return Result{}, fmt.Errorf("ratelimit: unknown algorithm %d", l.cfg.Algorithm)
+	}
+
+	if err := l.cfg.Store.Update(ctx, l.cfg.Prefix+key, ttl, fn); err != nil {
+		return Result{}, fmt.Errorf("ratelimit: update %q: %w", key, err)
+	}
+	return res, nil
+}
+
+// Policy describes the limit in the format of the RateLimit-Policy header,
+// e.g. "100;w=60".
+func (l *Limiter) Policy() string {
+	p := strconv.Itoa(l.cfg.Limit) + ";w=" + strconv.Itoa(int(math.Ceil(l.cfg.Period.Seconds())))
+	if l.cfg.Algorithm == TokenBucket && l.cfg.Burst != l.cfg.Limit {
+		p += ";burst=" + strconv.Itoa(l.cfg.Burst)
+	}
+	return p
+}
+
+func (l *Limiter) tokenBucket(s *State, now time.Time) Result {
+	burst := float64(l.cfg.Burst)
+
+	tokens := burst
+	if !s.Time.IsZero() {
+		elapsed := max(now.Sub(s.Time), 0)
+		tokens = min(burst, s.Value+l.refill(elapsed))
+	}
+
+	res := Result{Limit: l.cfg.Burst}
+	if tokens >= 1 {
+		tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = l.refillTime(1 - tokens)
+	}
+	s.Value, s.Time = tokens, now
+
+	res.Remaining = int(tokens)
+	res.Reset = l.refillTime(burst - tokens)
+	return res
+}
+
+// refill returns the tokens added to a bucket in d.
+func (l *Limiter) refill(d time.Duration) float64 {
+	return d.Seconds() * float64(l.cfg.Limit) / l.cfg.Period.Seconds()
+}
+
+// refillTime returns how long it takes to add tokens to a bucket.
+func (l *Limiter) refillTime(tokens float64) time.Duration {
+	return time.Duration(math.Ceil(tokens * float64(l.cfg.Period) / float64(l.cfg.Limit)))
+}
+
+func (l *Limiter) slidingWindow(s *State, now time.Time) Result {
+	period := l.cfg.Period
+	start := now.Truncate(period)
+
+	switch {
+	case s.Time.Equal(start):
+	case s.Time.Equal(start.Add(-period)):
+		s.Prev, s.Value = s.Value, 0
+	default:
+		s.Prev, s.Value = 0, 0
+	}
+	s.Time = start
+
+	limit := float64(l.cfg.Limit)
+	elapsed := now.Sub(start)
+	weight := 1 - float64(elapsed)/float64(period)
+	estimate := s.Prev*weight + s.Value
+
+	res := Result{Limit: l.cfg.Limit, Reset: period - elapsed}
+	if estimate+1 <= limit {
+		s.Value++
+		estimate++
+		res.Allowed = true
+	} else {
+		// The estimate drops as the previous window slides out. If the
+		// current window alone is full, wait for the next one.
+		wait := period - elapsed
+		if s.Prev > 0 && s.Value+1 <= limit {
+			// Solve Prev*(1-t/period) + Value + 1 <= limit for t.
+			t := float64(period) * (1 - (limit-s.Value-1)/s.Prev)
+			wait = time.Duration(math.Ceil(t)) - elapsed
+		}
+		res.RetryAfter = max(wait, time.Nanosecond)
+	}
+	res.Remaining = max(int(limit-estimate), 0)
+	return res
+}
@@ -0,0 +1,195 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jwbonnell/go-libs/pkg/db/queriers/fake"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type clock struct{ now time.Time }
+
+func (c *clock) Now() time.Time          { return c.now }
+func (c *clock) Advance(d time.Duration) { c.now = c.now.Add(d) }
+
+func newClock() *clock {
+	return &clock{now: time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)}
+}
+
+func TestTokenBucket(t *testing.T) {
+	ctx := context.Background()
+	c := newClock()
+	l := New(Config{Algorithm: TokenBucket, Limit: 10, Period: time.Minute, Burst: 3, Now: c.Now})
+
+	for i := range 3 {
+		res, err := l.Allow(ctx, "k")
+		require.NoError(t, err)
+		assert.True(t, res.Allowed, i)
+		assert.Equal(t, 2-i, res.Remaining)
+	}
+
+	res, err := l.Allow(ctx, "k")
+	require.NoError(t, err)
+	assert.False(t, res.Allowed)
+	assert.Equal(t, 3, res.Limit)
+	assert.Equal(t, 6*time.Second, res.RetryAfter)
+	assert.Equal(t, 18*time.Second, res.Reset)
+
+	// Other keys have their own bucket.
+	res, err = l.Allow(ctx, "other")
+	require.NoError(t, err)
+	assert.True(t, res.Allowed)
+
+	// One token refills every six seconds.
+	c.Advance(6 * time.Second)
+	res, err = l.Allow(ctx, "k")
+	require.NoError(t, err)
+	assert.True(t, res.Allowed)
+	assert.Equal(t, 0, res.Remaining)
+
+	c.Advance(time.Hour)
+	res, err = l.Allow(ctx, "k")
+	require.NoError(t, err)
+	assert.Equal(t, 2, res.Remaining)
+
+	assert.Equal(t, "10;w=60;burst=3", l.Policy())
+}
+
+func TestSlidingWindow(t *testing.T) {
+	ctx := context.Background()
+	c := newClock()
+	l := New(Config{Algorithm: SlidingWindow, Limit: 4, Period: time.Minute, Now: c.Now})
+
+	for range 4 {
+		res, err := l.Allow(ctx, "k")
+		require.NoError(t, err)
+		assert.True(t, res.Allowed)
+	}
+	res, err := l.Allow(ctx, "k")
+	require.NoError(t, err)
+	assert.False(t, res.Allowed)
+	assert.Equal(t, 0, res.Remaining)
+	assert.Equal(t, time.Minute, res.RetryAfter)
+
+	// A quarter into the next window the previous one still weighs 3/4, so
+	// one more request fits.
+	c.Advance(75 * time.Second)
+	res, err = l.Allow(ctx, "k")
+	require.NoError(t, err)
+	assert.True(t, res.Allowed)
+	assert.Equal(t, 45*time.Second, res.Reset)
+
+	res, err = l.Allow(ctx, "k")
+	require.NoError(t, err)
+	assert.False(t, res.Allowed)
+	assert.Equal(t, 15*time.Second, res.RetryAfter)
+
+	c.Advance(15 * time.Second)
+	res, err = l.Allow(ctx, "k")
+	require.NoError(t, err)
+	assert.True(t, res.Allowed)
+
+	assert.Equal(t, "4;w=60", l.Policy())
+}
+
+func TestNew_PanicsWithoutLimit(t *testing.T) {
+	assert.Panics(t, func() { New(Config{}) })
+}
+
+func TestAllow_StoreError(t *testing.T) {
+	l := New(Config{Limit: 1, Store: StoreFunc(func(ctx context.Context, key string, ttl time.Duration, fn func(s *State)) error {
+		return errors.New("connection refused")
+	})})
+
+	_, err := l.Allow(context.Background(), "k")
+
+	assert.ErrorContains(t, err, `ratelimit: update "k": connection refused`)
+}
+
+func TestMemoryStore_PrefixAndExpiry(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	a := New(Config{Limit: 1, Store: store, Prefix: "a:"})
+	b := New(Config{Limit: 1, Store: store, Prefix: "b:"})
+
+	res, err := a.Allow(ctx, "k")
+	require.NoError(t, err)
+	assert.True(t, res.Allowed)
+	res, err = b.Allow(ctx, "k")
+	require.NoError(t, err)
+	assert.True(t, res.Allowed)
+	assert.Equal(t, 2, store.Len())
+
+	require.NoError(t, store.Update(ctx, "short", time.Nanosecond, func(s *State) { s.Value = 5 }))
+	time.Sleep(time.Millisecond)
+	require.NoError(t, store.Update(ctx, "short", time.Minute, func(s *State) {
+		assert.Equal(t, State{}, *s)
+	}))
+}
+
+func TestPostgresStore_Update(t *testing.T) {
+	ctx := context.Background()
+	windowTime := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	q := fake.New(t)
+	q.ExpectBegin()
+	q.ExpectExec(`INSERT INTO "rate_limits" .* ON CONFLICT \(key\) DO NOTHING`).
+		WithArgs(pgx.NamedArgs{"key": "k", "expires_at": fake.AnyArg()})
+	q.ExpectQuery(`SELECT value, prev, window_time, expires_at FROM "rate_limits" WHERE key = @key FOR UPDATE`).
+		WithArgs(pgx.NamedArgs{"key": "k"}).
+		WillReturnRows(fake.NewRows("value", "prev", "window_time", "expires_at").
+			AddRow(2.0, 1.0, windowTime, time.Now().Add(time.Hour)))
+	q.ExpectExec(`UPDATE "rate_limits" SET`).
+		WithArgs(pgx.NamedArgs{"key": "k", "value": 3.0, "prev": 1.0, "window_time": fake.AnyArg(), "expires_at": fake.AnyArg()}).
+		WillReturnResult(pgconn.NewCommandTag("UPDATE 1"))
+	q.ExpectCommit()
+
+	store := NewPostgresStore(q, "")
+	err := store.Update(ctx, "k", time.Minute, func(s *State) {
+		assert.Equal(t, State{Value: 2, Prev: 1, Time: windowTime}, *s)
+		s.Value++
+	})
+
+	require.NoError(t, err)
+	require.NoError(t, q.ExpectationsWereMet())
+}
+
+func TestPostgresStore_ExpiredStateIsReset(t *testing.T) {
+	ctx := context.Background()
+
+	q := fake.New(t)
+	q.ExpectBegin()
+	q.ExpectExec(`INSERT INTO "limits"`)
+	q.ExpectQuery(`FROM "limits"`).
+		WillReturnRows(fake.NewRows("value", "prev", "window_time", "expires_at").
+			AddRow(0.0, 0.0, time.Now(), time.Now().Add(-time.Second)))
+	q.ExpectExec(`UPDATE "limits"`)
+	q.ExpectCommit()
+
+	err := NewPostgresStore(q, "limits").Update(ctx, "k", time.Minute, func(s *State) {
+		assert.True(t, s.Time.IsZero())
+	})
+
+	require.NoError(t, err)
+}
+
+func TestPostgresStore_RollsBackOnError(t *testing.T) {
+	ctx := context.Background()
+
+	q := fake.New(t)
+	q.ExpectBegin()
+	q.ExpectExec(`INSERT INTO "rate_limits"`).WillReturnError(errors.New("relation does not exist"))
+	q.ExpectRollback()
+
+	l := New(Config{Limit: 1, Store: NewPostgresStore(q, "")})
+	_, err := l.Allow(ctx, "k")
+
+	assert.ErrorContains(t, err, "insert: relation does not exist")
+	require.NoError(t, q.ExpectationsWereMet())
+}
@@ -1,32 +1,137 @@
 package web
 
 import (
+	"io/fs"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
 	"github.com/jwbonnell/go-libs/pkg/web/httpx"
+	"github.com/jwbonnell/go-libs/pkg/web/middleware"
 )
 
+// Route describes a single route for table driven registration with
+// App.Routes or RouteGroup.Routes.
 type Route struct {
 	Method  string
 	Path    string
 	Handler httpx.HandlerFunc
 	Mw      []httpx.Middleware
+
+	// Roles, if set, restricts the route to principals with at least one of
+	// them, see middleware.RequireRoles.
+	Roles []string
+	// Scopes, if set, must all have been granted to the principal, see
+	// middleware.RequireScopes.
+	Scopes []string
+
+	// Timeout overrides the app's request timeout, see App.WithTimeout. A
+	// negative value disables it, e.g. for event streams.
+	Timeout time.Duration
+	// MaxBodySize overrides the app's request body limit in bytes, see
+	// App.WithMaxBodySize. A negative value disables it.
+	MaxBodySize int64
+	// SecureHeaders, if set, replaces the app's security headers, see
+	// App.WithSecureHeaders.
+	SecureHeaders *middleware.SecureHeaders
 }
 
-/*type RouteGroup struct {
+// RouteInfo describes a registered route and the permissions it requires.
+type RouteInfo struct {
+	Method string   `json:"method"`
+	Path   string   `json:"path"`
+	Roles  []string `json:"roles,omitempty"`
+	Scopes []string `json:"scopes,omitempty"`
+}
+
+// RouteGroup registers routes under a common path prefix with middleware
+// shared by every route in the group. Middleware runs in the order
+// app → group (outer to inner for nested groups) → route.
+type RouteGroup struct {
+	app    *App
 	prefix string
 	mw     []httpx.Middleware
 }
 
-func NewRouteGroup(prefix string, mw []httpx.Middleware) *RouteGroup {
-	return &RouteGroup{prefix: prefix, mw: mw}
+// Group returns a RouteGroup whose routes are registered on the app under
+// prefix and wrapped by mw.
+func (a *App) Group(prefix string, mw ...httpx.Middleware) *RouteGroup {
+	return &RouteGroup{app: a, prefix: cleanPrefix(prefix), mw: mw}
+}
+
+// Group returns a nested RouteGroup. Its prefix is appended to the parent's
+// and its middleware runs after the parent's.
+func (rg *RouteGroup) Group(prefix string, mw ...httpx.Middleware) *RouteGroup {
+	return &RouteGroup{
+		app:    rg.app,
+		prefix: rg.prefix + cleanPrefix(prefix),
+		mw:     slices.Concat(rg.mw, mw),
+	}
+}
+
+// HandleFunc registers handler for method and the group prefix joined with
+// path. Route middleware runs after the group's middleware.
+func (rg *RouteGroup) HandleFunc(method string, path string, handler httpx.HandlerFunc, mw ...httpx.Middleware) {
+	rg.app.HandleFunc(method, rg.prefix+path, handler, slices.Concat(rg.mw, mw)...)
+}
+
+// Routes registers every route in routes on the group.
+func (rg *RouteGroup) Routes(routes []Route) {
+	for _, r := range routes {
+		r.Path = rg.prefix + r.Path
+		r.Mw = slices.Concat(rg.mw, r.Mw)
+		rg.app.handle(r)
+	}
+}
+
+// Mount serves h for every request below the group prefix joined with prefix.
+// See App.Mount.
+func (rg *RouteGroup) Mount(prefix string, h http.Handler) {
+	rg.app.Mount(rg.prefix+cleanPrefix(prefix), h)
+}
+
+// Routes registers every route in routes on the app. The permission checks
+// declared by a route run after its middleware, so authentication can be
+// part of the app, group or route middleware.
+func (a *App) Routes(routes []Route) {
+	for _, r := range routes {
+		a.handle(r)
+	}
+}
+
+// RegisteredRoutes returns every route registered with HandleFunc, Routes,
+// Static or WebSocket, directly or through a group, in registration order,
+// with the permissions they require. Mounted handlers aren't included.
+func (a *App) RegisteredRoutes() []RouteInfo {
+	return slices.Clone(a.routes)
+}
+
+// Mount serves h, for any method, for every request below prefix. The prefix
+// is stripped from the request path before h sees it, which suits third party
+// handlers such as http.FileServer. Mounted handlers write their own
+// responses, so the app's httpx middleware doesn't apply to them.
+func (a *App) Mount(prefix string, h http.Handler) {
+	prefix = cleanPrefix(prefix)
+	a.mux.Handle(prefix+"/", http.StripPrefix(prefix, h))
+}
+
+// Static serves the files of fsys for GET and HEAD requests below prefix,
+// e.g. app.Static("/assets", os.DirFS("public")). Unlike a mounted
+// http.FileServer the responses go through the app's middleware, support
+// range and conditional requests, and never list directories.
+func (a *App) Static(prefix string, fsys fs.FS, mw ...httpx.Middleware) {
+	a.HandleFunc("GET", cleanPrefix(prefix)+"/{path...}", func(w http.ResponseWriter, r *http.Request) httpx.Response {
+		return httpx.FSFileResponse(r, fsys, r.PathValue("path"), false)
+	}, mw...)
 }
 
-func (rg *RouteGroup) HandleFunc(method string, path string, handler http.Handler, mw ...httpx.Middleware) {
-	//combine route group middleware with route middleware
-	mw = append(rg.mw, mw...)
-	//add group prefix to route path
-	if rg.prefix != "" {
-		path = rg.prefix + path
+// cleanPrefix makes sure prefix starts with a slash and has no trailing one,
+// so prefixes and paths can simply be concatenated.
+func cleanPrefix(prefix string) string {
+	prefix = strings.TrimRight(prefix, "/")
+	if prefix != "" && !strings.HasPrefix(prefix, "/") {
+		prefix = "/" + prefix
 	}
-	rg.router.HandleFunc(method, path, handler, mw...)
+	return prefix
 }
-*/
@@ -0,0 +1,212 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/jwbonnell/go-libs/pkg/web/auth"
+	"github.com/jwbonnell/go-libs/pkg/web/httpx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// tagMw prefixes the string response data with tag, recording the order in
+// which middleware ran around the handler.
+func tagMw(tag string) httpx.Middleware {
+	return func(next httpx.HandlerFunc) httpx.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) httpx.Response {
+			resp := next(w, r)
+			resp.Data = tag + resp.Data.(string)
+			return resp
+		}
+	}
+}
+
+func textHandler(body string) httpx.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) httpx.Response {
+		return httpx.PlainTextResponse(http.StatusOK, body)
+	}
+}
+
+func serve(app *App, method, target string) *httptest.ResponseRecorder {
+	rr := httptest.NewRecorder()
+	app.ServeHTTP(rr, httptest.NewRequest(method, target, nil))
+	return rr
+}
+
+func TestGroup_PrefixAndMiddlewareOrder(t *testing.T) {
+	app := NewApp(testLogger(t), tagMw("A"))
+
+	api := app.Group("/api", tagMw("G"))
+	api.HandleFunc("GET", "/users/{id}", func(w http.ResponseWriter, r *http.Request) httpx.Response {
+		return httpx.PlainTextResponse(http.StatusOK, "H"+r.PathValue("id"))
+	}, tagMw("R"))
+
+	rr := serve(app, "GET", "/api/users/42")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "AGRH42", rr.Body.String())
+
+	rr = serve(app, "GET", "/users/42")
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+func TestGroup_Nested(t *testing.T) {
+	app := NewApp(testLogger(t))
+
+	v1 := app.Group("api/v1/", tagMw("1"))
+	admin := v1.Group("/admin", tagMw("2"))
+	admin.HandleFunc("DELETE", "/users", textHandler("H"), tagMw("3"))
+
+	// Registering on the parent after creating the child must not leak the
+	// child's middleware into the parent.
+	v1.HandleFunc("GET", "/status", textHandler("H"))
+
+	rr := serve(app, "DELETE", "/api/v1/admin/users")
+	assert.Equal(t, "123H", rr.Body.String())
+
+	rr = serve(app, "GET", "/api/v1/status")
+	assert.Equal(t, "1H", rr.Body.String())
+}
+
+func TestRoutes_TableDriven(t *testing.T) {
+	app := NewApp(testLogger(t))
+	app.Routes([]Route{
+		{Method: "GET", Path: "/a", Handler: textHandler("a")},
+		{Method: "POST", Path: "/b", Handler: textHandler("b"), Mw: []httpx.Middleware{tagMw("R")}},
+	})
+	app.Group("/g", tagMw("G")).Routes([]Route{
+		{Method: "GET", Path: "/c", Handler: textHandler("c")},
+	})
+
+	assert.Equal(t, "a", serve(app, "GET", "/a").Body.String())
+	assert.Equal(t, "Rb", serve(app, "POST", "/b").Body.String())
+	assert.Equal(t, "Gc", serve(app, "GET", "/g/c").Body.String())
+	assert.Equal(t, http.StatusMethodNotAllowed, serve(app, "GET", "/b").Code)
+}
+
+func TestRoutes_PermissionsAndRegisteredRoutes(t *testing.T) {
+	authenticate := func(next httpx.HandlerFunc) httpx.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) httpx.Response {
+			p := &auth.Principal{Subject: r.Header.Get("X-User"), Roles: r.Header.Values("X-Role"), Scopes: r.Header.Values("X-Scope")}
+			return next(w, r.WithContext(auth.NewContext(r.Context(), p)))
+		}
+	}
+
+	app := NewApp(testLogger(t))
+	app.HandleFunc("GET", "/health", textHandler("ok"))
+	app.Group("/admin").Routes([]Route{
+		{Method: "DELETE", Path: "/users/{id}", Handler: textHandler("deleted"), Mw: []httpx.Middleware{authenticate}, Roles: []string{"admin"}},
+		{Method: "GET", Path: "/reports", Handler: textHandler("report"), Mw: []httpx.Middleware{authenticate}, Scopes: []string{"reports:read"}},
+	})
+
+	req := func(method, target string, header http.Header) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, target, nil)
+		r.Header = header
+		rr := httptest.NewRecorder()
+		app.ServeHTTP(rr, r)
+		return rr
+	}
+
+	assert.Equal(t, http.StatusForbidden, req("DELETE", "/admin/users/1", http.Header{"X-Role": {"viewer"}}).Code)
+	assert.Equal(t, "deleted", req("DELETE", "/admin/users/1", http.Header{"X-Role": {"admin"}}).Body.String())
+	assert.Equal(t, http.StatusForbidden, req("GET", "/admin/reports", http.Header{}).Code)
+	assert.Equal(t, "report", req("GET", "/admin/reports", http.Header{"X-Scope": {"reports:read"}}).Body.String())
+
+	assert.Equal(t, []RouteInfo{
+		{Method: "GET", Path: "/health"},
+		{Method: "DELETE", Path: "/admin/users/{id}", Roles: []string{"admin"}},
+		{Method: "GET", Path: "/admin/reports", Scopes: []string{"reports:read"}},
+	}, app.RegisteredRoutes())
+}
+
+func TestMount_StripsPrefix(t *testing.T) {
+	app := NewApp(testLogger(t))
+
+	var gotPath string
+	third := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		w.WriteHeader(http.StatusAccepted)
+	})
+	app.Mount("/vendor/", third)
+	app.Group("/api").Mount("/legacy", third)
+
+	rr := serve(app, "PUT", "/vendor/x/y")
+	require.Equal(t, http.StatusAccepted, rr.Code)
+	assert.Equal(t, "/x/y", gotPath)
+
+	rr = serve(app, "GET", "/api/legacy/z")
+	require.Equal(t, http.StatusAccepted, rr.Code)
+	assert.Equal(t, "/z", gotPath)
+}
+
+func TestStatic_ServesThroughMiddleware(t *testing.T) {
+	var seen string
+	mw := func(next httpx.HandlerFunc) httpx.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) httpx.Response {
+			seen = r.URL.Path
+			return next(w, r)
+		}
+	}
+
+	app := NewApp(testLogger(t))
+	app.Static("/assets/", fstest.MapFS{"css/site.css": {Data: []byte("body{}")}}, mw)
+
+	rr := serve(app, "GET", "/assets/css/site.css")
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "body{}", rr.Body.String())
+	assert.Equal(t, "text/css; charset=utf-8", rr.Header().Get("Content-Type"))
+	assert.Equal(t, "/assets/css/site.css", seen)
+
+	rr = serve(app, "HEAD", "/assets/css/site.css")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Empty(t, rr.Body.String())
+
+	rr = serve(app, "GET", "/assets/css")
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+func TestRoutes_TimeoutAndBodySizeOverrides(t *testing.T) {
+	deadline := func(w http.ResponseWriter, r *http.Request) httpx.Response {
+		d, ok := r.Context().Deadline()
+		if !ok {
+			return httpx.PlainTextResponse(http.StatusOK, "none")
+		}
+		return httpx.PlainTextResponse(http.StatusOK, time.Until(d).Round(time.Minute).String())
+	}
+	upload := func(w http.ResponseWriter, r *http.Request) httpx.Response {
+		var v map[string]string
+		if err := httpx.DecodeAndValidate(r, &v); err != nil {
+			return httpx.ErrorResponse(err, http.StatusBadRequest)
+		}
+		return httpx.PlainTextResponse(http.StatusOK, "stored")
+	}
+
+	app := NewApp(testLogger(t))
+	app.WithTimeout(5 * time.Minute)
+	app.WithMaxBodySize(8)
+	app.HandleFunc("GET", "/default", deadline)
+	app.HandleFunc("POST", "/default", upload)
+	app.Routes([]Route{
+		{Method: "GET", Path: "/slow", Handler: deadline, Timeout: 30 * time.Minute},
+		{Method: "GET", Path: "/stream", Handler: deadline, Timeout: -1},
+		{Method: "POST", Path: "/upload", Handler: upload, MaxBodySize: 1 << 20},
+	})
+
+	assert.Equal(t, "5m0s", serve(app, "GET", "/default").Body.String())
+	assert.Equal(t, "30m0s", serve(app, "GET", "/slow").Body.String())
+	assert.Equal(t, "none", serve(app, "GET", "/stream").Body.String())
+
+	post := func(target string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", target, strings.NewReader(`{"name":"a long name"}`))
+		r.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		app.ServeHTTP(rr, r)
+		return rr
+	}
+	assert.Equal(t, http.StatusRequestEntityTooLarge, post("/default").Code)
+	assert.Equal(t, "stored", post("/upload").Body.String())
+}
@@ -0,0 +1,202 @@
+package web
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/jwbonnell/go-libs/pkg/logx"
+	"github.com/jwbonnell/go-libs/pkg/web/httpx"
+)
+
+// ServerOptions configures the http.Server started by App.Run. Zero values
+// are replaced with the defaults noted on each field.
+type ServerOptions struct {
+	// ReadTimeout defaults to 5 seconds.
+	ReadTimeout time.Duration
+	// ReadHeaderTimeout defaults to ReadTimeout.
+	ReadHeaderTimeout time.Duration
+	// WriteTimeout defaults to 10 seconds. It bounds the whole response, so
+	// it would cut off long-lived ones: event streams (httpx.SSEResponse) and
+	// file downloads (httpx.FileResponse) lift it while they are written, as
+	// do WebSocket upgrades. Other streaming encoders must do the same with
+	// http.ResponseController.SetWriteDeadline.
+	WriteTimeout time.Duration
+	// IdleTimeout defaults to 120 seconds.
+	IdleTimeout time.Duration
+
+	// ShutdownDelay is how long the app keeps serving after readiness starts
+	// failing, giving load balancers time to stop sending traffic. Defaults to
+	// no delay.
+	ShutdownDelay time.Duration
+	// ShutdownTimeout bounds how long in-flight requests are given to drain,
+	// and separately how long shutdown hooks are given to run. Defaults to 20
+	// seconds.
+	ShutdownTimeout time.Duration
+
+	// TLSCertFile and TLSKeyFile enable TLS. Alternatively set TLSConfig with
+	// its Certificates or GetCertificate populated.
+	TLSCertFile string
+	TLSKeyFile  string
+	TLSConfig   *tls.Config
+}
+
+func (o *ServerOptions) setDefaults() {
+	if o.ReadTimeout == 0 {
+		o.ReadTimeout = 5 * time.Second
+	}
+	if o.ReadHeaderTimeout == 0 {
+		o.ReadHeaderTimeout = o.ReadTimeout
+	}
+	if o.WriteTimeout == 0 {
+		o.WriteTimeout = 10 * time.Second
+	}
+	if o.IdleTimeout == 0 {
+		o.IdleTimeout = 120 * time.Second
+	}
+	if o.ShutdownTimeout == 0 {
+		o.ShutdownTimeout = 20 * time.Second
+	}
+}
+
+// ShutdownHook releases a resource, such as a db.DB, when the server stops.
+type ShutdownHook func(ctx context.Context) error
+
+// OnShutdown registers hook to run after the server has stopped serving.
+// Hooks run in reverse registration order, like deferred calls, so resources
+// opened first are released last. Register hooks before calling Run.
+func (a *App) OnShutdown(hook ShutdownHook) {
+	a.shutdownHooks = append(a.shutdownHooks, hook)
+}
+
+// Ready reports whether the app is serving and not shutting down.
+func (a *App) Ready() bool {
+	return a.ready.Load()
+}
+
+// Readiness is a handler for readiness probes. It responds 200 while Run is
+// serving and 503 once shutdown has started.
+func (a *App) Readiness(w http.ResponseWriter, r *http.Request) httpx.Response {
+	if !a.Ready() {
+		return httpx.JSONResponse(http.StatusServiceUnavailable, map[string]string{"status": "not ready"})
+	}
+	return httpx.JSONResponse(http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// Run serves the app on addr until ctx is cancelled or the process receives
+// SIGINT or SIGTERM, then shuts down gracefully: readiness starts failing,
+// in-flight requests are drained and open WebSocket connections closed within
+// ShutdownTimeout, and the registered shutdown hooks run.
+//
+// addr is a TCP address such as ":8080", or "unix:" followed by the path of a
+// unix socket. A clean shutdown returns nil. Otherwise the error reports why
+// the server stopped, whether draining timed out and any hook failures.
+func (a *App) Run(ctx context.Context, addr string, opts ServerOptions) error {
+	opts.setDefaults()
+
+	ctx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	ln, err := listen(addr)
+	if err != nil {
+		return fmt.Errorf("listen: %w", err)
+	}
+
+	srv := &http.Server{
+		Handler:           a,
+		ReadTimeout:       opts.ReadTimeout,
+		ReadHeaderTimeout: opts.ReadHeaderTimeout,
+		WriteTimeout:      opts.WriteTimeout,
+		IdleTimeout:       opts.IdleTimeout,
+		TLSConfig:         opts.TLSConfig,
+		ErrorLog:          logx.NewStdLogger(a.log, slog.LevelError),
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		if opts.TLSConfig != nil || opts.TLSCertFile != "" {
+			serveErr <- srv.ServeTLS(ln, opts.TLSCertFile, opts.TLSKeyFile)
+			return
+		}
+		serveErr <- srv.Serve(ln)
+	}()
+
+	a.ready.Store(true)
+	a.log.Info(ctx, "web: server started", "addr", ln.Addr().String())
+
+	select {
+	case err := <-serveErr:
+		a.ready.Store(false)
+		return errors.Join(fmt.Errorf("serve: %w", err), a.runShutdownHooks(opts.ShutdownTimeout))
+	case <-ctx.Done():
+	}
+
+	a.ready.Store(false)
+	a.log.Info(context.Background(), "web: shutdown started", "cause", context.Cause(ctx))
+
+	if opts.ShutdownDelay > 0 {
+		time.Sleep(opts.ShutdownDelay)
+	}
+
+	var errs []error
+	drainCtx, cancel := context.WithTimeout(context.Background(), opts.ShutdownTimeout)
+	defer cancel()
+	// Hijacked WebSocket connections aren't drained by Shutdown, so close
+	// them alongside it.
+	wsErr := make(chan error, 1)
+	go func() { wsErr <- a.wsConns.closeAll(drainCtx) }()
+	if err := srv.Shutdown(drainCtx); err != nil {
+		errs = append(errs, fmt.Errorf("drain in-flight requests: %w", err))
+		_ = srv.Close()
+	}
+	if err := <-wsErr; err != nil {
+		errs = append(errs, err)
+	}
+	if err := <-serveErr; err != nil && !errors.Is(err, http.ErrServerClosed) {
+		errs = append(errs, fmt.Errorf("serve: %w", err))
+	}
+
+	errs = append(errs, a.runShutdownHooks(opts.ShutdownTimeout))
+	a.log.Info(context.Background(), "web: shutdown complete")
+
+	return errors.Join(errs...)
+}
+
+func (a *App) runShutdownHooks(timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var errs []error
+	for i := len(a.shutdownHooks) - 1; i >= 0; i-- {
+		if err := a.shutdownHooks[i](ctx); err != nil {
+			errs = append(errs, fmt.Errorf("shutdown hook: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func listen(addr string) (net.Listener, error) {
+	path, ok := strings.CutPrefix(addr, "unix:")
+	if !ok {
+		return net.Listen("tcp", addr)
+	}
+
+	// Remove a socket left behind by a previous process that didn't exit
+	// cleanly, but never anything that isn't a socket.
+	if fi, err := os.Stat(path); err == nil && fi.Mode().Type() == fs.ModeSocket {
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	return net.Listen("unix", path)
+}
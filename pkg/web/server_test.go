@@ -0,0 +1,141 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/jwbonnell/go-libs/pkg/web/httpx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// runApp starts app.Run on a unix socket and returns a client for it and a
+// channel receiving Run's result.
+func runApp(t *testing.T, ctx context.Context, app *App, opts ServerOptions) (*http.Client, <-chan error) {
+	t.Helper()
+	sock := filepath.Join(t.TempDir(), "app.sock")
+
+	done := make(chan error, 1)
+	go func() { done <- app.Run(ctx, "unix:"+sock, opts) }()
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", sock)
+		},
+	}}
+
+	require.Eventually(t, app.Ready, 2*time.Second, 5*time.Millisecond)
+	return client, done
+}
+
+func get(t *testing.T, client *http.Client, path string) (int, string) {
+	t.Helper()
+	resp, err := client.Get("http://app" + path)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp.StatusCode, string(body)
+}
+
+func TestRun_ServesAndShutsDownGracefully(t *testing.T) {
+	app := NewApp(testLogger(t))
+	app.HandleFunc("GET", "/readiness", app.Readiness)
+
+	started := make(chan struct{})
+	app.HandleFunc("GET", "/slow", func(w http.ResponseWriter, r *http.Request) httpx.Response {
+		close(started)
+		time.Sleep(200 * time.Millisecond)
+		return httpx.PlainTextResponse(http.StatusOK, "done")
+	})
+
+	var order []string
+	app.OnShutdown(func(ctx context.Context) error { order = append(order, "db"); return nil })
+	app.OnShutdown(func(ctx context.Context) error { order = append(order, "logs"); return nil })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client, done := runApp(t, ctx, app, ServerOptions{})
+
+	code, body := get(t, client, "/readiness")
+	assert.Equal(t, http.StatusOK, code)
+	assert.JSONEq(t, `{"status":"ok"}`, body)
+
+	// An in-flight request is drained, not dropped, when shutdown starts.
+	slow := make(chan string, 1)
+	go func() {
+		resp, err := client.Get("http://app/slow")
+		if err != nil {
+			slow <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		slow <- string(body)
+	}()
+	<-started
+	cancel()
+
+	require.NoError(t, <-done)
+	assert.Equal(t, "done", <-slow)
+	assert.False(t, app.Ready())
+	assert.Equal(t, []string{"logs", "db"}, order)
+
+	rr := serve(app, "GET", "/readiness")
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+}
+
+func TestRun_SIGTERM(t *testing.T) {
+	app := NewApp(testLogger(t))
+	_, done := runApp(t, context.Background(), app, ServerOptions{})
+
+	require.NoError(t, syscall.Kill(syscall.Getpid(), syscall.SIGTERM))
+
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("server did not stop on SIGTERM")
+	}
+}
+
+func TestRun_DrainTimeoutAndHookErrors(t *testing.T) {
+	app := NewApp(testLogger(t))
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	app.HandleFunc("GET", "/stuck", func(w http.ResponseWriter, r *http.Request) httpx.Response {
+		close(started)
+		<-release
+		return httpx.PlainTextResponse(http.StatusOK, "late")
+	})
+	defer close(release)
+
+	hookErr := errors.New("flush failed")
+	app.OnShutdown(func(ctx context.Context) error { return hookErr })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	client, done := runApp(t, ctx, app, ServerOptions{ShutdownTimeout: 50 * time.Millisecond})
+
+	go func() { _, _ = client.Get("http://app/stuck") }()
+	<-started
+	cancel()
+
+	err := <-done
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.ErrorIs(t, err, hookErr)
+	assert.Contains(t, err.Error(), "drain in-flight requests")
+}
+
+func TestRun_ListenError(t *testing.T) {
+	app := NewApp(testLogger(t))
+	err := app.Run(context.Background(), "unix:"+filepath.Join(t.TempDir(), "missing", "app.sock"), ServerOptions{})
+	require.ErrorContains(t, err, "listen")
+}
@@ -0,0 +1,41 @@
+package web
+
+import (
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/jwbonnell/go-libs/pkg/tracing"
+)
+
+// RequestIDHeader carries the trace ID of a request. It is accepted from
+// clients and always echoed back on the response.
+const RequestIDHeader = "X-Request-ID"
+
+// traceparentHeader is the W3C Trace Context propagation header.
+const traceparentHeader = "traceparent"
+
+// traceIDFromRequest returns the trace ID a client sent, taken from a valid
+// W3C traceparent header or else from X-Request-ID, or a new random ID.
+func traceIDFromRequest(r *http.Request) string {
+	if sc, ok := tracing.ParseTraceparent(r.Header.Get(traceparentHeader)); ok {
+		return sc.TraceID.String()
+	}
+	if id := r.Header.Get(RequestIDHeader); validRequestID(id) {
+		return id
+	}
+	return uuid.NewString()
+}
+
+// validRequestID accepts client supplied IDs of reasonable length made of
+// visible ASCII, so they are safe to log and echo back.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, c := range id {
+		if c < '!' || c > '~' {
+			return false
+		}
+	}
+	return true
+}
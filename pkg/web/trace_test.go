@@ -0,0 +1,92 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jwbonnell/go-libs/pkg/logx"
+	"github.com/jwbonnell/go-libs/pkg/tracing"
+	"github.com/jwbonnell/go-libs/pkg/web/httpx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithTracing_ServerSpanPerRoute(t *testing.T) {
+	var buf bytes.Buffer
+	logger := logx.New(&buf, slog.LevelInfo, "unit-tests", httpx.TraceID).WithContextAttrs(tracing.LogAttrs)
+
+	exp := tracing.NewInMemoryExporter()
+	tracer := tracing.NewTracer("unit-tests", exp)
+
+	app := NewApp(logger)
+	app.WithTracing(tracer)
+	app.HandleFunc("GET", "/users/{id}", func(w http.ResponseWriter, r *http.Request) httpx.Response {
+		_, child := tracer.Start(r.Context(), "load user")
+		child.End()
+		logger.Info(r.Context(), "inside handler")
+		return httpx.PlainTextResponse(http.StatusOK, "ok")
+	})
+
+	req := httptest.NewRequest("GET", "/users/42", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	rr := httptest.NewRecorder()
+	app.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	spans := exp.Spans()
+	require.Len(t, spans, 2)
+	child, server := spans[0], spans[1]
+
+	assert.Equal(t, "GET /users/{id}", server.Name)
+	assert.Equal(t, tracing.SpanKindServer, server.Kind)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", server.SpanContext.TraceID.String())
+	assert.Equal(t, "00f067aa0ba902b7", server.Parent.String())
+	assert.Equal(t, "/users/42", server.Attributes["url.path"])
+	assert.Equal(t, http.StatusOK, server.Attributes["http.response.status_code"])
+	assert.Equal(t, server.SpanContext.SpanID, child.Parent)
+
+	// The response continues the trace from the server span.
+	sc, ok := tracing.ParseTraceparent(rr.Header().Get("traceparent"))
+	require.True(t, ok)
+	assert.Equal(t, server.SpanContext.TraceID, sc.TraceID)
+	assert.Equal(t, server.SpanContext.SpanID, sc.SpanID)
+	assert.Equal(t, sc.TraceID.String(), rr.Header().Get(RequestIDHeader))
+
+	var entry map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+	assert.Equal(t, sc.TraceID.String(), entry["trace_id"])
+	assert.Equal(t, sc.SpanID.String(), entry["span_id"])
+}
+
+func TestWithTracing_NewTraceAndErrorStatus(t *testing.T) {
+	exp := tracing.NewInMemoryExporter()
+	app := NewApp(testLogger(t))
+	app.WithTracing(tracing.NewTracer("unit-tests", exp))
+	app.HandleFunc("POST", "/fail", func(w http.ResponseWriter, r *http.Request) httpx.Response {
+		return httpx.ErrorResponse(errors.New("db down"), http.StatusInternalServerError)
+	})
+
+	rr := serve(app, "POST", "/fail")
+	require.Equal(t, http.StatusInternalServerError, rr.Code)
+
+	spans := exp.Spans()
+	require.Len(t, spans, 1)
+	assert.False(t, spans[0].Parent.IsValid())
+	assert.Equal(t, tracing.StatusError, spans[0].Status)
+	assert.Equal(t, "db down", spans[0].StatusMessage)
+	assert.Equal(t, spans[0].SpanContext.TraceID.String(), rr.Header().Get(RequestIDHeader))
+}
+
+func TestHandleFunc_NoTracing(t *testing.T) {
+	app := NewApp(testLogger(t))
+	app.HandleFunc("GET", "/x", textHandler("x"))
+
+	rr := serve(app, "GET", "/x")
+	assert.Empty(t, rr.Header().Get("traceparent"))
+	assert.NotEmpty(t, rr.Header().Get(RequestIDHeader))
+}
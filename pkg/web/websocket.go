@@ -0,0 +1,175 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/jwbonnell/go-libs/pkg/web/httpx"
+	"github.com/jwbonnell/go-libs/pkg/web/websocket"
+)
+
+// WebSocketHandler runs a WebSocket session. ctx carries the request values
+// and is cancelled when the connection closes. Returning nil closes the
+// connection normally; returning an error logs it and closes the connection
+// with websocket.CloseInternalError. Handlers may also close conn themselves.
+type WebSocketHandler func(ctx context.Context, conn *websocket.Conn) error
+
+// WebSocket registers handler for WebSocket upgrade requests on path. The
+// app's and the route's middleware run on the upgrade request, so auth,
+// logging and trace IDs work as for any other route, and a middleware
+// rejecting the request prevents the upgrade. Requests that aren't valid
+// upgrades are answered with an error response. Open connections are closed
+// with websocket.CloseGoingAway when Run shuts down.
+func (a *App) WebSocket(path string, handler WebSocketHandler, mw ...httpx.Middleware) {
+	h := func(w http.ResponseWriter, r *http.Request) httpx.Response {
+		if err := websocket.CheckHandshake(r, a.wsOpts); err != nil {
+			status := http.StatusBadRequest
+			if he := new(websocket.HandshakeError); errors.As(err, &he) {
+				status = he.Status
+			}
+			if status == http.StatusUpgradeRequired {
+				w.Header().Set("Upgrade", "websocket")
+				w.Header().Set("Sec-WebSocket-Version", "13")
+			}
+			return httpx.ErrorResponse(httpx.NewRequestError(err, status), status)
+		}
+
+		return httpx.Response{
+			StatusCode: http.StatusSwitchingProtocols,
+			Data:       wsSession{request: r, handler: handler},
+			Encoder:    &wsUpgrader{app: a},
+		}
+	}
+
+	// Sessions last as long as the peers want, so the request timeout
+	// doesn't apply.
+	a.handle(Route{Method: http.MethodGet, Path: path, Handler: h, Mw: mw, Timeout: -1})
+}
+
+// WithWebSocketOptions configures the connections of routes registered with
+// WebSocket.
+func (a *App) WithWebSocketOptions(opts websocket.Options) {
+	a.wsOpts = opts
+}
+
+type wsSession struct {
+	request *http.Request
+	handler WebSocketHandler
+}
+
+// wsUpgrader performs the upgrade once the middleware chain has accepted the
+// request and runs the session to completion.
+type wsUpgrader struct {
+	app *App
+}
+
+func (u *wsUpgrader) Encode(data any) ([]byte, string, error) {
+	return nil, "", fmt.Errorf("websocket: upgrades can't be buffered")
+}
+
+func (u *wsUpgrader) EncodeTo(w http.ResponseWriter, statusCode int, data any) error {
+	s, ok := data.(wsSession)
+	if !ok {
+		return fmt.Errorf("encoder data is not a websocket session")
+	}
+
+	conn, err := websocket.Upgrade(w, s.request, u.app.wsOpts)
+	if err != nil {
+		return fmt.Errorf("websocket upgrade: %w", err)
+	}
+	httpx.SetStatusCode(s.request.Context(), http.StatusSwitchingProtocols)
+
+	if !u.app.wsConns.add(conn) {
+		return conn.Close(websocket.CloseGoingAway, "server shutting down")
+	}
+	defer u.app.wsConns.remove(conn)
+
+	// The request context lives on after a hijack, so tie the session's
+	// context to the connection instead.
+	ctx, cancel := context.WithCancel(s.request.Context())
+	defer cancel()
+	go func() {
+		select {
+		case <-conn.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	if err := s.handler(ctx, conn); err != nil && !isClosed(err) {
+		u.app.log.Error(ctx, "websocket", "ERROR", err)
+		return conn.Close(websocket.CloseInternalError, "internal error")
+	}
+	return conn.Close(websocket.CloseNormalClosure, "")
+}
+
+// isClosed reports whether err only says that the connection was closed.
+func isClosed(err error) bool {
+	var ce *websocket.CloseError
+	return errors.Is(err, websocket.ErrClosed) || errors.As(err, &ce)
+}
+
+// wsConns tracks open connections so shutdown can close them.
+type wsConns struct {
+	mu       sync.Mutex
+	conns    map[*websocket.Conn]struct{}
+	sessions sync.WaitGroup
+	closing  bool
+}
+
+func (t *wsConns) add(c *websocket.Conn) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closing {
+		return false
+	}
+	if t.conns == nil {
+		t.conns = map[*websocket.Conn]struct{}{}
+	}
+	t.conns[c] = struct{}{}
+	t.sessions.Add(1)
+	return true
+}
+
+func (t *wsConns) remove(c *websocket.Conn) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.conns, c)
+	t.sessions.Done()
+}
+
+// closeAll closes every open connection with CloseGoingAway and waits for
+// their handlers to return or ctx to end, after which the remaining
+// connections are dropped.
+func (t *wsConns) closeAll(ctx context.Context) error {
+	t.mu.Lock()
+	t.closing = true
+	conns := make([]*websocket.Conn, 0, len(t.conns))
+	for c := range t.conns {
+		conns = append(conns, c)
+	}
+	t.mu.Unlock()
+
+	for _, c := range conns {
+		go c.Close(websocket.CloseGoingAway, "server shutting down")
+	}
+
+	done := make(chan struct{})
+	go func() {
+		t.sessions.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		for _, c := range conns {
+			_ = c.CloseNow()
+		}
+		return fmt.Errorf("close websockets: %w", ctx.Err())
+	}
+}
@@ -0,0 +1,379 @@
+package websocket
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xA
+
+	finBit  = 0x80
+	rsvBits = 0x70
+	maskBit = 0x80
+
+	maxControlPayload = 125
+)
+
+// Conn is a server-side WebSocket connection. One goroutine may read while
+// others write; writes are serialized internally.
+type Conn struct {
+	conn        net.Conn
+	br          *bufio.Reader
+	opts        Options
+	subprotocol string
+
+	rmu sync.Mutex // held while reading frames
+
+	wmu       sync.Mutex // serializes frame writes
+	closeSent bool
+
+	closeOnce  sync.Once
+	closed     chan struct{} // closed once the underlying connection is closed
+	peerClosed chan struct{} // closed when the client's close frame arrives
+	peerOnce   sync.Once
+}
+
+func newConn(netConn net.Conn, br *bufio.Reader, subprotocol string, opts Options) *Conn {
+	c := &Conn{
+		conn:        netConn,
+		br:          br,
+		opts:        opts,
+		subprotocol: subprotocol,
+		closed:      make(chan struct{}),
+		peerClosed:  make(chan struct{}),
+	}
+	if opts.PingInterval > 0 {
+		c.extendReadDeadline()
+		go c.keepalive()
+	}
+	return c
+}
+
+// Subprotocol returns the negotiated subprotocol, or "" if none.
+func (c *Conn) Subprotocol() string {
+	return c.subprotocol
+}
+
+// RemoteAddr returns the client's network address.
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+// Done returns a channel that is closed when the connection is closed.
+func (c *Conn) Done() <-chan struct{} {
+	return c.closed
+}
+
+// ReadMessage reads the next data message, reassembling fragments. Pings are
+// answered and pongs consumed along the way. When the client closes the
+// connection the error is a *CloseError; protocol violations and messages
+// over the read limit close the connection with the matching close code.
+func (c *Conn) ReadMessage() (MessageType, []byte, error) {
+	c.rmu.Lock()
+	defer c.rmu.Unlock()
+
+	var (
+		typ     MessageType
+		message []byte
+	)
+	for {
+		fin, op, payload, err := c.readFrame(c.opts.ReadLimit - int64(len(message)))
+		if err != nil {
+			return 0, nil, c.readFailed(err)
+		}
+
+		switch op {
+		case opPing:
+			if err := c.writeFrame(opPong, payload); err != nil && !errors.Is(err, ErrClosed) {
+				return 0, nil, err
+			}
+			continue
+		case opPong:
+			continue
+		case opClose:
+			return 0, nil, c.peerClose(payload)
+		case opContinuation:
+			if typ == 0 {
+				return 0, nil, c.fail(CloseProtocolError, "unexpected continuation frame")
+			}
+		case opText, opBinary:
+			if typ != 0 {
+				return 0, nil, c.fail(CloseProtocolError, "expected continuation frame")
+			}
+			typ = MessageType(op)
+		default:
+			return 0, nil, c.fail(CloseProtocolError, fmt.Sprintf("unknown opcode %d", op))
+		}
+
+		message = append(message, payload...)
+		if !fin {
+			continue
+		}
+		if typ == TextMessage && !utf8.Valid(message) {
+			return 0, nil, c.fail(CloseInvalidPayload, "invalid UTF-8 in text message")
+		}
+		return typ, message, nil
+	}
+}
+
+// WriteMessage sends data as a single message of type typ.
+func (c *Conn) WriteMessage(typ MessageType, data []byte) error {
+	if typ != TextMessage && typ != BinaryMessage {
+		return fmt.Errorf("websocket: invalid message type %d", typ)
+	}
+	return c.writeFrame(byte(typ), data)
+}
+
+// ReadJSON reads the next message and decodes it as JSON into v.
+func (c *Conn) ReadJSON(v any) error {
+	_, data, err := c.ReadMessage()
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("websocket: decode message: %w", err)
+	}
+	return nil
+}
+
+// WriteJSON encodes v as JSON and sends it as a text message.
+func (c *Conn) WriteJSON(v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("websocket: encode message: %w", err)
+	}
+	return c.WriteMessage(TextMessage, data)
+}
+
+// Close performs the closing handshake: it sends a close frame with code and
+// reason, waits up to CloseTimeout for the client to answer and closes the
+// connection. It is safe to call concurrently with ReadMessage and more than
+// once.
+func (c *Conn) Close(code int, reason string) error {
+	err := c.sendClose(code, reason)
+	if errors.Is(err, ErrClosed) {
+		return nil
+	}
+	if err != nil {
+		c.closeConn()
+		return err
+	}
+
+	// Wait for the client's close frame. If nobody is reading, read and
+	// discard frames until it arrives; otherwise the reader will see it.
+	deadline := time.Now().Add(c.opts.CloseTimeout)
+	_ = c.conn.SetReadDeadline(deadline)
+	if c.rmu.TryLock() {
+		for {
+			_, op, _, err := c.readFrame(c.opts.ReadLimit)
+			if err != nil || op == opClose || time.Now().After(deadline) {
+				break
+			}
+		}
+		c.rmu.Unlock()
+	} else {
+		select {
+		case <-c.peerClosed:
+		case <-c.closed:
+		case <-time.After(time.Until(deadline)):
+		}
+	}
+
+	c.closeConn()
+	return nil
+}
+
+// CloseNow closes the connection without a closing handshake.
+func (c *Conn) CloseNow() error {
+	c.closeConn()
+	return nil
+}
+
+// keepalive pings the client every PingInterval until the connection closes.
+func (c *Conn) keepalive() {
+	t := time.NewTicker(c.opts.PingInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-c.closed:
+			return
+		case <-t.C:
+			if err := c.writeFrame(opPing, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (c *Conn) extendReadDeadline() {
+	if c.opts.PingInterval > 0 {
+		_ = c.conn.SetReadDeadline(time.Now().Add(c.opts.PingInterval + c.opts.PongTimeout))
+	}
+}
+
+// readFrame reads a single frame and unmasks its payload. Data frames larger
+// than limit and malformed frames are reported as a *CloseError to send.
+func (c *Conn) readFrame(limit int64) (fin bool, op byte, payload []byte, err error) {
+	var head [2]byte
+	if _, err := io.ReadFull(c.br, head[:]); err != nil {
+		return false, 0, nil, err
+	}
+	c.extendReadDeadline()
+
+	fin = head[0]&finBit != 0
+	op = head[0] & 0x0F
+	if head[0]&rsvBits != 0 {
+		return false, 0, nil, &CloseError{Code: CloseProtocolError, Reason: "reserved bits set"}
+	}
+	if head[1]&maskBit == 0 {
+		return false, 0, nil, &CloseError{Code: CloseProtocolError, Reason: "client frames must be masked"}
+	}
+
+	length := int64(head[1] & 0x7F)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = int64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		u := binary.BigEndian.Uint64(ext[:])
+		if u > 1<<62 {
+			return false, 0, nil, &CloseError{Code: CloseProtocolError, Reason: "invalid frame length"}
+		}
+		length = int64(u)
+	}
+
+	if op >= opClose {
+		if !fin || length > maxControlPayload {
+			return false, 0, nil, &CloseError{Code: CloseProtocolError, Reason: "invalid control frame"}
+		}
+	} else if length > limit {
+		return false, 0, nil, &CloseError{Code: CloseMessageTooBig, Reason: "message too big"}
+	}
+
+	var mask [4]byte
+	if _, err := io.ReadFull(c.br, mask[:]); err != nil {
+		return false, 0, nil, err
+	}
+	payload = make([]byte, length)
+	if _, err := io.ReadFull(c.br, payload); err != nil {
+		return false, 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return fin, op, payload, nil
+}
+
+// writeFrame writes a single unmasked, final frame.
+func (c *Conn) writeFrame(op byte, payload []byte) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if c.closeSent {
+		return ErrClosed
+	}
+
+	frame := make([]byte, 0, len(payload)+10)
+	frame = append(frame, finBit|op)
+	switch n := len(payload); {
+	case n <= 125:
+		frame = append(frame, byte(n))
+	case n <= 0xFFFF:
+		frame = append(frame, 126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(n))
+	default:
+		frame = append(frame, 127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(n))
+	}
+	frame = append(frame, payload...)
+
+	_ = c.conn.SetWriteDeadline(time.Now().Add(c.opts.WriteTimeout))
+	if _, err := c.conn.Write(frame); err != nil {
+		c.closeSent = true
+		return fmt.Errorf("websocket: write: %w", err)
+	}
+	if op == opClose {
+		c.closeSent = true
+	}
+	return nil
+}
+
+// sendClose writes a close frame unless one was already sent.
+func (c *Conn) sendClose(code int, reason string) error {
+	var payload []byte
+	if code != CloseNoStatusReceived {
+		payload = binary.BigEndian.AppendUint16(nil, uint16(code))
+		if len(reason) > maxControlPayload-2 {
+			reason = reason[:maxControlPayload-2]
+		}
+		payload = append(payload, reason...)
+	}
+	return c.writeFrame(opClose, payload)
+}
+
+// peerClose answers the client's close frame and closes the connection.
+func (c *Conn) peerClose(payload []byte) error {
+	ce := &CloseError{Code: CloseNoStatusReceived}
+	if len(payload) >= 2 {
+		ce.Code = int(binary.BigEndian.Uint16(payload))
+		ce.Reason = string(payload[2:])
+	}
+	c.peerOnce.Do(func() { close(c.peerClosed) })
+
+	// Echo the code unless we started the closing handshake ourselves.
+	_ = c.sendClose(ce.Code, "")
+	c.closeConn()
+	return ce
+}
+
+// fail closes the connection after a protocol violation by the client.
+func (c *Conn) fail(code int, reason string) error {
+	_ = c.sendClose(code, reason)
+	c.closeConn()
+	return &CloseError{Code: code, Reason: reason}
+}
+
+// readFailed turns a read error into the error returned by ReadMessage.
+func (c *Conn) readFailed(err error) error {
+	if ce := new(CloseError); errors.As(err, &ce) {
+		return c.fail(ce.Code, ce.Reason)
+	}
+
+	select {
+	case <-c.closed:
+		return ErrClosed
+	default:
+	}
+	c.closeConn()
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return &CloseError{Code: CloseAbnormalClosure, Reason: "unexpected EOF"}
+	}
+	return fmt.Errorf("websocket: read: %w", err)
+}
+
+func (c *Conn) closeConn() {
+	c.closeOnce.Do(func() {
+		close(c.closed)
+		_ = c.conn.Close()
+	})
+}
@@ -0,0 +1,229 @@
+// Package websocket implements the server side of the WebSocket protocol
+// (RFC 6455) without extensions: the opening handshake, message framing and
+// fragmentation, ping/pong keepalive, read limits and the closing handshake.
+//
+// Most applications register endpoints with web.App.WebSocket rather than
+// calling Upgrade directly.
+package websocket
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// MessageType is the type of a data message.
+type MessageType int
+
+const (
+	TextMessage   MessageType = 1
+	BinaryMessage MessageType = 2
+)
+
+// Close codes defined by RFC 6455, section 7.4.1.
+const (
+	CloseNormalClosure    = 1000
+	CloseGoingAway        = 1001
+	CloseProtocolError    = 1002
+	CloseUnsupportedData  = 1003
+	CloseNoStatusReceived = 1005
+	CloseAbnormalClosure  = 1006
+	CloseInvalidPayload   = 1007
+	ClosePolicyViolation  = 1008
+	CloseMessageTooBig    = 1009
+	CloseInternalError    = 1011
+)
+
+// ErrClosed is returned by operations on a connection that has been closed.
+var ErrClosed = errors.New("websocket: connection closed")
+
+// CloseError is returned by ReadMessage when the peer closes the connection.
+type CloseError struct {
+	Code   int
+	Reason string
+}
+
+func (ce *CloseError) Error() string {
+	return fmt.Sprintf("websocket: closed with code %d %s", ce.Code, ce.Reason)
+}
+
+// HandshakeError reports an invalid upgrade request and the HTTP status to
+// answer it with.
+type HandshakeError struct {
+	Status  int
+	Message string
+}
+
+func (he *HandshakeError) Error() string {
+	return "websocket: " + he.Message
+}
+
+// Options configures connections. Zero values are replaced with the defaults
+// noted on each field.
+type Options struct {
+	// ReadLimit is the maximum size of a message in bytes. Larger messages
+	// close the connection with CloseMessageTooBig. Defaults to 1 MiB.
+	ReadLimit int64
+	// PingInterval is how often the server pings the client. A connection
+	// that receives nothing, not even a pong, for PingInterval plus
+	// PongTimeout is closed. Defaults to 30 seconds; negative disables
+	// keepalive.
+	PingInterval time.Duration
+	// PongTimeout defaults to PingInterval.
+	PongTimeout time.Duration
+	// WriteTimeout bounds each write. Defaults to 10 seconds.
+	WriteTimeout time.Duration
+	// CloseTimeout bounds how long Close waits for the client to acknowledge
+	// the closing handshake. Defaults to 5 seconds.
+	CloseTimeout time.Duration
+	// CheckOrigin decides whether to accept a browser request from another
+	// origin. By default only requests without an Origin header or with one
+	// matching the Host header are accepted.
+	CheckOrigin func(r *http.Request) bool
+	// Subprotocols the server supports, in order of preference.
+	Subprotocols []string
+}
+
+func (o *Options) setDefaults() {
+	if o.ReadLimit == 0 {
+		o.ReadLimit = 1 << 20
+	}
+	if o.PingInterval == 0 {
+		o.PingInterval = 30 * time.Second
+	}
+	if o.PongTimeout == 0 {
+		o.PongTimeout = o.PingInterval
+	}
+	if o.WriteTimeout == 0 {
+		o.WriteTimeout = 10 * time.Second
+	}
+	if o.CloseTimeout == 0 {
+		o.CloseTimeout = 5 * time.Second
+	}
+	if o.CheckOrigin == nil {
+		o.CheckOrigin = sameOrigin
+	}
+}
+
+// CheckHandshake validates r as a WebSocket opening handshake without
+// responding to it, so callers can reject bad requests with a regular HTTP
+// response.
+func CheckHandshake(r *http.Request, opts Options) error {
+	opts.setDefaults()
+
+	if r.Method != http.MethodGet {
+		return &HandshakeError{Status: http.StatusMethodNotAllowed, Message: "upgrade requires GET"}
+	}
+	if !headerContainsToken(r.Header, "Connection", "upgrade") || !headerContainsToken(r.Header, "Upgrade", "websocket") {
+		return &HandshakeError{Status: http.StatusUpgradeRequired, Message: "not a websocket upgrade request"}
+	}
+	if r.Header.Get("Sec-Websocket-Version") != "13" {
+		return &HandshakeError{Status: http.StatusUpgradeRequired, Message: "unsupported websocket version"}
+	}
+	key, err := base64.StdEncoding.DecodeString(r.Header.Get("Sec-Websocket-Key"))
+	if err != nil || len(key) != 16 {
+		return &HandshakeError{Status: http.StatusBadRequest, Message: "invalid Sec-WebSocket-Key"}
+	}
+	if !opts.CheckOrigin(r) {
+		return &HandshakeError{Status: http.StatusForbidden, Message: "origin not allowed"}
+	}
+	return nil
+}
+
+// Upgrade completes the opening handshake by hijacking the connection behind
+// w and returns the WebSocket connection. Headers already set on w are
+// included in the handshake response. On a HandshakeError nothing has been
+// written to w, so the caller can still respond.
+func Upgrade(w http.ResponseWriter, r *http.Request, opts Options) (*Conn, error) {
+	opts.setDefaults()
+	if err := CheckHandshake(r, opts); err != nil {
+		if he := new(HandshakeError); errors.As(err, &he) && he.Status == http.StatusUpgradeRequired {
+			w.Header().Set("Sec-WebSocket-Version", "13")
+		}
+		return nil, err
+	}
+
+	subprotocol := selectSubprotocol(r, opts.Subprotocols)
+
+	// Headers set on w by earlier handlers, such as a request ID or a
+	// cookie, are sent with the handshake response.
+	extra := w.Header().Clone()
+	for _, k := range []string{"Upgrade", "Connection", "Sec-Websocket-Accept", "Sec-Websocket-Protocol", "Content-Type", "Content-Length"} {
+		extra.Del(k)
+	}
+
+	netConn, brw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		return nil, fmt.Errorf("websocket: hijack: %w", err)
+	}
+
+	var b strings.Builder
+	b.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n")
+	b.WriteString("Sec-WebSocket-Accept: " + acceptKey(r.Header.Get("Sec-Websocket-Key")) + "\r\n")
+	if subprotocol != "" {
+		b.WriteString("Sec-WebSocket-Protocol: " + subprotocol + "\r\n")
+	}
+	_ = extra.Write(&b)
+	b.WriteString("\r\n")
+
+	_ = netConn.SetDeadline(time.Time{})
+	_ = netConn.SetWriteDeadline(time.Now().Add(opts.WriteTimeout))
+	if _, err := netConn.Write([]byte(b.String())); err != nil {
+		_ = netConn.Close()
+		return nil, fmt.Errorf("websocket: write handshake: %w", err)
+	}
+
+	// Bytes the client sent right after the handshake may already be
+	// buffered by the HTTP server.
+	br := brw.Reader
+	if br.Buffered() == 0 {
+		br = bufio.NewReader(netConn)
+	}
+
+	return newConn(netConn, br, subprotocol, opts), nil
+}
+
+const acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+func acceptKey(key string) string {
+	h := sha1.Sum([]byte(key + acceptGUID))
+	return base64.StdEncoding.EncodeToString(h[:])
+}
+
+func headerContainsToken(h http.Header, name, token string) bool {
+	for _, v := range h.Values(name) {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func selectSubprotocol(r *http.Request, supported []string) string {
+	for _, v := range r.Header.Values("Sec-Websocket-Protocol") {
+		for _, p := range strings.Split(v, ",") {
+			if p = strings.TrimSpace(p); slices.Contains(supported, p) {
+				return p
+			}
+		}
+	}
+	return ""
+}
+
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
@@ -0,0 +1,328 @@
+package websocket
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testClient speaks just enough of the client side of the protocol.
+type testClient struct {
+	conn net.Conn
+	br   *bufio.Reader
+}
+
+func dial(t *testing.T, srv *httptest.Server, header http.Header) (*testClient, *http.Response) {
+	t.Helper()
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	req, err := http.NewRequest("GET", srv.URL+"/ws", nil)
+	require.NoError(t, err)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	require.NoError(t, req.Write(conn))
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	require.NoError(t, err)
+	return &testClient{conn: conn, br: br}, resp
+}
+
+func (c *testClient) writeFrame(t *testing.T, fin bool, op byte, payload []byte, masked bool) {
+	t.Helper()
+	b0 := op
+	if fin {
+		b0 |= finBit
+	}
+	frame := []byte{b0}
+	var maskFlag byte
+	if masked {
+		maskFlag = maskBit
+	}
+	switch n := len(payload); {
+	case n <= 125:
+		frame = append(frame, maskFlag|byte(n))
+	case n <= 0xFFFF:
+		frame = append(frame, maskFlag|126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(n))
+	default:
+		frame = append(frame, maskFlag|127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(n))
+	}
+	if masked {
+		mask := [4]byte{1, 2, 3, 4}
+		frame = append(frame, mask[:]...)
+		for i, b := range payload {
+			frame = append(frame, b^mask[i%4])
+		}
+	} else {
+		frame = append(frame, payload...)
+	}
+	_, err := c.conn.Write(frame)
+	require.NoError(t, err)
+}
+
+func (c *testClient) readFrame(t *testing.T) (byte, []byte) {
+	t.Helper()
+	require.NoError(t, c.conn.SetReadDeadline(time.Now().Add(2*time.Second)))
+	var head [2]byte
+	_, err := io.ReadFull(c.br, head[:])
+	require.NoError(t, err)
+	require.Zero(t, head[1]&maskBit, "server frames must not be masked")
+
+	n := int(head[1] & 0x7F)
+	switch n {
+	case 126:
+		var ext [2]byte
+		_, err = io.ReadFull(c.br, ext[:])
+		require.NoError(t, err)
+		n = int(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		_, err = io.ReadFull(c.br, ext[:])
+		require.NoError(t, err)
+		n = int(binary.BigEndian.Uint64(ext[:]))
+	}
+	payload := make([]byte, n)
+	_, err = io.ReadFull(c.br, payload)
+	require.NoError(t, err)
+	return head[0] & 0x0F, payload
+}
+
+func (c *testClient) readClose(t *testing.T) int {
+	t.Helper()
+	op, payload := c.readFrame(t)
+	require.Equal(t, byte(opClose), op)
+	require.GreaterOrEqual(t, len(payload), 2)
+	return int(binary.BigEndian.Uint16(payload))
+}
+
+// serve runs handler on every upgraded connection and reports its error.
+func serve(t *testing.T, opts Options, handler func(c *Conn) error) (*httptest.Server, <-chan error) {
+	t.Helper()
+	errs := make(chan error, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := Upgrade(w, r, opts)
+		if err != nil {
+			if he := new(HandshakeError); errors.As(err, &he) {
+				http.Error(w, err.Error(), he.Status)
+			}
+			errs <- err
+			return
+		}
+		errs <- handler(c)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, errs
+}
+
+func echo(c *Conn) error {
+	for {
+		typ, msg, err := c.ReadMessage()
+		if err != nil {
+			return err
+		}
+		if err := c.WriteMessage(typ, msg); err != nil {
+			return err
+		}
+	}
+}
+
+func TestUpgrade_Handshake(t *testing.T) {
+	srv, _ := serve(t, Options{Subprotocols: []string{"chat.v2", "chat.v1"}}, echo)
+
+	_, resp := dial(t, srv, http.Header{"Sec-Websocket-Protocol": {"chat.v1, chat.v3"}})
+
+	assert.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+	// The example from RFC 6455, section 1.3.
+	assert.Equal(t, "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=", resp.Header.Get("Sec-WebSocket-Accept"))
+	assert.Equal(t, "chat.v1", resp.Header.Get("Sec-WebSocket-Protocol"))
+}
+
+func TestUpgrade_RejectsInvalidRequests(t *testing.T) {
+	tests := []struct {
+		name   string
+		header http.Header
+		status int
+	}{
+		{"wrong version", http.Header{"Sec-Websocket-Version": {"8"}}, http.StatusUpgradeRequired},
+		{"bad key", http.Header{"Sec-Websocket-Key": {"short"}}, http.StatusBadRequest},
+		{"cross origin", http.Header{"Origin": {"https://evil.example"}}, http.StatusForbidden},
+		{"no upgrade", http.Header{"Upgrade": {"h2c"}}, http.StatusUpgradeRequired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, errs := serve(t, Options{}, echo)
+
+			_, resp := dial(t, srv, tt.header)
+
+			assert.Equal(t, tt.status, resp.StatusCode)
+			var he *HandshakeError
+			assert.ErrorAs(t, <-errs, &he)
+		})
+	}
+}
+
+func TestUpgrade_CheckOrigin(t *testing.T) {
+	srv, _ := serve(t, Options{CheckOrigin: func(r *http.Request) bool {
+		return r.Header.Get("Origin") == "https://app.example"
+	}}, echo)
+
+	_, resp := dial(t, srv, http.Header{"Origin": {"https://app.example"}})
+
+	assert.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+}
+
+func TestConn_JSONAndFragments(t *testing.T) {
+	type msg struct {
+		Text string `json:"text"`
+	}
+	srv, errs := serve(t, Options{}, func(c *Conn) error {
+		var m msg
+		if err := c.ReadJSON(&m); err != nil {
+			return err
+		}
+		m.Text = strings.ToUpper(m.Text)
+		if err := c.WriteJSON(m); err != nil {
+			return err
+		}
+		return echo(c)
+	})
+	client, _ := dial(t, srv, nil)
+
+	client.writeFrame(t, true, opText, []byte(`{"text":"hi"}`), true)
+	op, payload := client.readFrame(t)
+	assert.Equal(t, byte(opText), op)
+	assert.JSONEq(t, `{"text":"HI"}`, string(payload))
+
+	// A fragmented message with a ping in between.
+	client.writeFrame(t, false, opBinary, []byte("ab"), true)
+	client.writeFrame(t, true, opPing, []byte("p"), true)
+	client.writeFrame(t, true, opContinuation, []byte("cd"), true)
+	op, payload = client.readFrame(t)
+	assert.Equal(t, byte(opPong), op)
+	assert.Equal(t, "p", string(payload))
+	op, payload = client.readFrame(t)
+	assert.Equal(t, byte(opBinary), op)
+	assert.Equal(t, "abcd", string(payload))
+
+	// Large messages use the extended length fields.
+	big := strings.Repeat("x", 70000)
+	client.writeFrame(t, true, opText, []byte(big), true)
+	_, payload = client.readFrame(t)
+	assert.Equal(t, big, string(payload))
+
+	client.writeFrame(t, true, opClose, binary.BigEndian.AppendUint16(nil, CloseNormalClosure), true)
+	assert.Equal(t, CloseNormalClosure, client.readClose(t))
+
+	var ce *CloseError
+	require.ErrorAs(t, <-errs, &ce)
+	assert.Equal(t, CloseNormalClosure, ce.Code)
+}
+
+func TestConn_ProtocolViolations(t *testing.T) {
+	tests := []struct {
+		name  string
+		write func(t *testing.T, c *testClient)
+		code  int
+	}{
+		{"unmasked frame", func(t *testing.T, c *testClient) {
+			c.writeFrame(t, true, opText, []byte("hi"), false)
+		}, CloseProtocolError},
+		{"over read limit", func(t *testing.T, c *testClient) {
+			c.writeFrame(t, true, opBinary, make([]byte, 17), true)
+		}, CloseMessageTooBig},
+		{"fragments over read limit", func(t *testing.T, c *testClient) {
+			c.writeFrame(t, false, opBinary, make([]byte, 10), true)
+			c.writeFrame(t, true, opContinuation, make([]byte, 10), true)
+		}, CloseMessageTooBig},
+		{"invalid utf-8", func(t *testing.T, c *testClient) {
+			c.writeFrame(t, true, opText, []byte{0xff, 0xfe}, true)
+		}, CloseInvalidPayload},
+		{"unexpected continuation", func(t *testing.T, c *testClient) {
+			c.writeFrame(t, true, opContinuation, []byte("x"), true)
+		}, CloseProtocolError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, errs := serve(t, Options{ReadLimit: 16}, echo)
+			client, _ := dial(t, srv, nil)
+
+			tt.write(t, client)
+
+			assert.Equal(t, tt.code, client.readClose(t))
+			var ce *CloseError
+			require.ErrorAs(t, <-errs, &ce)
+			assert.Equal(t, tt.code, ce.Code)
+		})
+	}
+}
+
+func TestConn_ServerClose(t *testing.T) {
+	srv, errs := serve(t, Options{}, func(c *Conn) error {
+		return c.Close(CloseGoingAway, "bye")
+	})
+	client, _ := dial(t, srv, nil)
+
+	op, payload := client.readFrame(t)
+	require.Equal(t, byte(opClose), op)
+	assert.Equal(t, CloseGoingAway, int(binary.BigEndian.Uint16(payload)))
+	assert.Equal(t, "bye", string(payload[2:]))
+
+	client.writeFrame(t, true, opClose, payload[:2], true)
+	assert.NoError(t, <-errs)
+}
+
+func TestConn_CloseWhileReading(t *testing.T) {
+	ready := make(chan *Conn, 1)
+	srv, errs := serve(t, Options{}, func(c *Conn) error {
+		ready <- c
+		return echo(c)
+	})
+	client, _ := dial(t, srv, nil)
+	c := <-ready
+
+	closed := make(chan error, 1)
+	go func() { closed <- c.Close(CloseNormalClosure, "") }()
+
+	assert.Equal(t, CloseNormalClosure, client.readClose(t))
+	client.writeFrame(t, true, opClose, binary.BigEndian.AppendUint16(nil, CloseNormalClosure), true)
+
+	assert.NoError(t, <-closed)
+	var ce *CloseError
+	assert.ErrorAs(t, <-errs, &ce)
+	<-c.Done()
+}
+
+func TestConn_Keepalive(t *testing.T) {
+	srv, errs := serve(t, Options{PingInterval: 20 * time.Millisecond, PongTimeout: 20 * time.Millisecond}, echo)
+	client, _ := dial(t, srv, nil)
+
+	op, _ := client.readFrame(t)
+	assert.Equal(t, byte(opPing), op)
+
+	// A client that never answers is dropped.
+	select {
+	case err := <-errs:
+		assert.Error(t, err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("unresponsive client was not dropped")
+	}
+}
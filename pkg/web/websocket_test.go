@@ -0,0 +1,198 @@
+package web
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jwbonnell/go-libs/pkg/web/httpx"
+	"github.com/jwbonnell/go-libs/pkg/web/middleware"
+	"github.com/jwbonnell/go-libs/pkg/web/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// wsDial performs the opening handshake for path over conn.
+func wsDial(t *testing.T, conn net.Conn, path string, header http.Header) (*bufio.Reader, *http.Response) {
+	t.Helper()
+	req, err := http.NewRequest("GET", "http://app"+path, nil)
+	require.NoError(t, err)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	require.NoError(t, req.Write(conn))
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	require.NoError(t, err)
+	return br, resp
+}
+
+// wsWrite writes a single masked frame; payloads must be under 126 bytes.
+func wsWrite(t *testing.T, conn net.Conn, op byte, payload []byte) {
+	t.Helper()
+	frame := []byte{0x80 | op, 0x80 | byte(len(payload)), 0, 0, 0, 0}
+	frame = append(frame, payload...)
+	_, err := conn.Write(frame)
+	require.NoError(t, err)
+}
+
+// wsRead reads a single short unmasked frame.
+func wsRead(t *testing.T, conn net.Conn, br *bufio.Reader) (byte, []byte) {
+	t.Helper()
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(2*time.Second)))
+	var head [2]byte
+	_, err := io.ReadFull(br, head[:])
+	require.NoError(t, err)
+	payload := make([]byte, head[1]&0x7F)
+	_, err = io.ReadFull(br, payload)
+	require.NoError(t, err)
+	return head[0] & 0x0F, payload
+}
+
+func TestWebSocket_MiddlewareRunsBeforeUpgrade(t *testing.T) {
+	auth := func(next httpx.HandlerFunc) httpx.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) httpx.Response {
+			if r.Header.Get("Authorization") != "Bearer secret" {
+				return httpx.ErrorResponse(httpx.NewAuthError("missing token"), http.StatusUnauthorized)
+			}
+			return next(w, r)
+		}
+	}
+	log := testLogger(t)
+	app := NewApp(log, middleware.Logger(log), middleware.Errors(log), middleware.Panics())
+	app.WebSocket("/ws", func(ctx context.Context, conn *websocket.Conn) error {
+		var in struct {
+			Name string `json:"name"`
+		}
+		if err := conn.ReadJSON(&in); err != nil {
+			return err
+		}
+		return conn.WriteJSON(map[string]string{
+			"hello":    in.Name,
+			"trace_id": httpx.GetValues(ctx).TraceID,
+		})
+	}, auth)
+
+	srv := httptest.NewServer(app)
+	defer srv.Close()
+
+	t.Run("rejected", func(t *testing.T) {
+		conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+		require.NoError(t, err)
+		defer conn.Close()
+
+		_, resp := wsDial(t, conn, "/ws", nil)
+
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+		assert.Equal(t, "application/problem+json", resp.Header.Get("Content-Type"))
+	})
+
+	t.Run("upgraded", func(t *testing.T) {
+		conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+		require.NoError(t, err)
+		defer conn.Close()
+
+		br, resp := wsDial(t, conn, "/ws", http.Header{"Authorization": {"Bearer secret"}})
+		require.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+		traceID := resp.Header.Get(RequestIDHeader)
+		assert.NotEmpty(t, traceID)
+
+		wsWrite(t, conn, 0x1, []byte(`{"name":"ada"}`))
+		op, payload := wsRead(t, conn, br)
+		assert.Equal(t, byte(0x1), op)
+		assert.JSONEq(t, `{"hello":"ada","trace_id":"`+traceID+`"}`, string(payload))
+
+		// The handler returned, so the server closes normally.
+		op, payload = wsRead(t, conn, br)
+		assert.Equal(t, byte(0x8), op)
+		assert.Equal(t, websocket.CloseNormalClosure, int(binary.BigEndian.Uint16(payload)))
+	})
+}
+
+func TestWebSocket_UpgradesThroughCompress(t *testing.T) {
+	app := NewApp(testLogger(t), middleware.Compress(middleware.CompressConfig{}))
+	app.WebSocket("/ws", func(ctx context.Context, conn *websocket.Conn) error {
+		return conn.WriteMessage(websocket.TextMessage, []byte("hi"))
+	})
+	srv := httptest.NewServer(app)
+	defer srv.Close()
+
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	br, resp := wsDial(t, conn, "/ws", http.Header{"Accept-Encoding": {"gzip"}})
+	require.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+	assert.Empty(t, resp.Header.Get("Content-Encoding"))
+
+	op, payload := wsRead(t, conn, br)
+	assert.Equal(t, byte(0x1), op)
+	assert.Equal(t, "hi", string(payload))
+}
+
+func TestWebSocket_RejectsPlainRequests(t *testing.T) {
+	app := NewApp(testLogger(t))
+	app.WebSocket("/ws", func(ctx context.Context, conn *websocket.Conn) error {
+		t.Error("handler called without an upgrade")
+		return nil
+	})
+
+	rr := serve(app, "GET", "/ws")
+
+	assert.Equal(t, http.StatusUpgradeRequired, rr.Code)
+	assert.Equal(t, "websocket", rr.Header().Get("Upgrade"))
+	assert.Equal(t, "13", rr.Header().Get("Sec-WebSocket-Version"))
+}
+
+func TestRun_ClosesWebSocketsOnShutdown(t *testing.T) {
+	app := NewApp(testLogger(t))
+	opened := make(chan struct{})
+	app.WebSocket("/ws", func(ctx context.Context, conn *websocket.Conn) error {
+		close(opened)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return err
+			}
+		}
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sock := filepath.Join(t.TempDir(), "app.sock")
+	done := make(chan error, 1)
+	go func() { done <- app.Run(ctx, "unix:"+sock, ServerOptions{}) }()
+	require.Eventually(t, app.Ready, 2*time.Second, 5*time.Millisecond)
+
+	conn, err := net.Dial("unix", sock)
+	require.NoError(t, err)
+	defer conn.Close()
+	br, resp := wsDial(t, conn, "/ws", nil)
+	require.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+	<-opened
+
+	cancel()
+
+	op, payload := wsRead(t, conn, br)
+	require.Equal(t, byte(0x8), op)
+	assert.Equal(t, websocket.CloseGoingAway, int(binary.BigEndian.Uint16(payload)))
+	wsWrite(t, conn, 0x8, payload[:2])
+
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return")
+	}
+}